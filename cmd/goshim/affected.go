@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// listedPackage is the subset of go list -json output used to build the
+// import graph
+type listedPackage struct {
+	ImportPath      string
+	Dir             string
+	DepOnly         bool
+	Standard        bool
+	Imports         []string
+	TestImports     []string
+	XTestImports    []string
+	EmbedFiles      []string
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
+}
+
+// listWorkspacePackages lists the packages of every workspace module and
+// their dependencies with go list -deps -json
+func (cfg *GoShimConfig) listWorkspacePackages(ctx context.Context) ([]listedPackage, error) {
+	modules, err := cfg.workspaceModuleDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	var pkgs []listedPackage
+	for _, dir := range modules {
+		cmd := exec.CommandContext(ctx, goPath, "list", "-e", "-deps", "-json", "./...")
+		cmd.Dir = dir
+		cmd.Env = os.Environ()
+		cmd.Stderr = stderr
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to run go list: %w", err)
+		}
+
+		dec := json.NewDecoder(out)
+		for {
+			var p listedPackage
+			if err := dec.Decode(&p); err == io.EOF {
+				break
+			} else if err != nil {
+				cmd.Wait()
+				return nil, fmt.Errorf("failed to parse go list output: %w", err)
+			}
+			// a package matched by one module may be a dependency of another
+			if i, ok := index[p.ImportPath]; ok {
+				pkgs[i].DepOnly = pkgs[i].DepOnly && p.DepOnly
+				continue
+			}
+			index[p.ImportPath] = len(pkgs)
+			pkgs = append(pkgs, p)
+		}
+
+		if err := cmd.Wait(); err != nil {
+			return nil, fmt.Errorf("go list failed in %s: %w", cfg.relativeToWorkspace(dir), err)
+		}
+	}
+	return pkgs, nil
+}
+
+// affectedPackage is a package selected for testing and why
+type affectedPackage struct {
+	ImportPath string
+	Reason     string
+}
+
+// moduleFiles change the build of every package when they change
+var moduleFiles = map[string]bool{
+	"go.mod":      true,
+	"go.sum":      true,
+	"go.work":     true,
+	"go.work.sum": true,
+}
+
+// selectAffectedPackages returns the workspace packages (those not DepOnly)
+// that transitively depend on the changed files, including through test
+// imports. If a module file changed, every package is selected and the
+// returned fallback names the file.
+func selectAffectedPackages(pkgs []listedPackage, changedFiles []string) ([]affectedPackage, string) {
+	var workspacePkgs []string
+	byDir := map[string]string{}
+	embedded := map[string]string{}
+	for _, p := range pkgs {
+		if p.DepOnly || p.Standard {
+			continue
+		}
+		workspacePkgs = append(workspacePkgs, p.ImportPath)
+		if p.Dir == "" {
+			continue
+		}
+		byDir[p.Dir] = p.ImportPath
+		for _, files := range [][]string{p.EmbedFiles, p.TestEmbedFiles, p.XTestEmbedFiles} {
+			for _, f := range files {
+				embedded[filepath.Join(p.Dir, f)] = p.ImportPath
+			}
+		}
+	}
+	sort.Strings(workspacePkgs)
+
+	for _, file := range changedFiles {
+		if moduleFiles[filepath.Base(file)] {
+			var all []affectedPackage
+			for _, pkg := range workspacePkgs {
+				all = append(all, affectedPackage{ImportPath: pkg, Reason: "all packages"})
+			}
+			return all, file
+		}
+	}
+
+	// packages directly containing a change
+	reasons := map[string]string{}
+	var queue []string
+	mark := func(pkg, reason string) {
+		if _, ok := reasons[pkg]; !ok {
+			reasons[pkg] = reason
+			queue = append(queue, pkg)
+		}
+	}
+	for _, file := range changedFiles {
+		if pkg, ok := changedFilePackage(file, byDir, embedded); ok {
+			mark(pkg, "changed: "+filepath.Base(file))
+		}
+	}
+
+	// walk the reverse import graph, test imports only count for the
+	// importing package itself since test code is never imported
+	importedBy := map[string][]string{}
+	testImportedBy := map[string][]string{}
+	for _, p := range pkgs {
+		for _, imp := range p.Imports {
+			importedBy[imp] = append(importedBy[imp], p.ImportPath)
+		}
+		for _, imp := range append(append([]string{}, p.TestImports...), p.XTestImports...) {
+			testImportedBy[imp] = append(testImportedBy[imp], p.ImportPath)
+		}
+	}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		for _, importer := range importedBy[pkg] {
+			mark(importer, "imports "+pkg)
+		}
+		for _, importer := range testImportedBy[pkg] {
+			if _, ok := reasons[importer]; !ok {
+				// tests of importer are affected, but nothing depends on tests
+				reasons[importer] = "test imports " + pkg
+			}
+		}
+	}
+
+	var selected []affectedPackage
+	for _, pkg := range workspacePkgs {
+		if reason, ok := reasons[pkg]; ok {
+			selected = append(selected, affectedPackage{ImportPath: pkg, Reason: reason})
+		}
+	}
+	return selected, ""
+}
+
+// changedFilePackage maps a changed file to the package it belongs to: Go
+// files (and other sources) by directory, testdata by the package owning the
+// testdata directory, and embedded files by their embedding package
+func changedFilePackage(file string, byDir, embedded map[string]string) (string, bool) {
+	if pkg, ok := embedded[file]; ok {
+		return pkg, true
+	}
+
+	sep := string(filepath.Separator)
+	if idx := strings.Index(file, sep+"testdata"+sep); idx >= 0 {
+		pkg, ok := byDir[file[:idx]]
+		return pkg, ok
+	}
+
+	switch filepath.Ext(file) {
+	case ".go", ".s", ".c", ".h", ".syso":
+		pkg, ok := byDir[filepath.Dir(file)]
+		return pkg, ok
+	}
+	return "", false
+}
+
+// printAffectedPackages explains the package selection
+func printAffectedPackages(out io.Writer, ref string, selected []affectedPackage, fallback string, root string) {
+	if fallback != "" {
+		if rel, err := filepath.Rel(root, fallback); err == nil {
+			fallback = rel
+		}
+		fmt.Fprintf(out, "🔍 %s changed since %s, testing all %d %s\n",
+			fallback, ref, len(selected), pluralize(len(selected), "package", "packages"))
+		return
+	}
+
+	if len(selected) == 0 {
+		fmt.Fprintf(out, "🔍 No packages affected by changes since %s\n", ref)
+		return
+	}
+
+	fmt.Fprintf(out, "🔍 %d %s affected by changes since %s:\n",
+		len(selected), pluralize(len(selected), "package", "packages"), ref)
+	width := 0
+	for _, p := range selected {
+		width = max(width, len(p.ImportPath))
+	}
+	for _, p := range selected {
+		fmt.Fprintf(out, "  %-*s  %s\n", width, p.ImportPath, p.Reason)
+	}
+	fmt.Fprintln(out)
+}
+
+// changedPackages selects the packages affected by changes since ref
+func (cfg *GoShimConfig) changedPackages(ctx context.Context, ref string) ([]string, error) {
+	files, err := gitChangedFiles(ctx, cfg.WorkspaceRoot, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changes since %s: %w", ref, err)
+	}
+
+	pkgs, err := cfg.listWorkspacePackages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, fallback := selectAffectedPackages(pkgs, files)
+	printAffectedPackages(stdout, ref, selected, fallback, cfg.WorkspaceRoot)
+
+	var paths []string
+	for _, p := range selected {
+		paths = append(paths, p.ImportPath)
+	}
+	return paths, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleListedPackages(root string) []listedPackage {
+	return []listedPackage{
+		{ImportPath: "fmt", Standard: true, DepOnly: true},
+		{ImportPath: "example.com/dep", Dir: "/mod/dep", DepOnly: true},
+		{ImportPath: "example.com/a", Dir: filepath.Join(root, "a"), Imports: []string{"fmt"}, EmbedFiles: []string{"assets/x.txt"}},
+		{ImportPath: "example.com/b", Dir: filepath.Join(root, "b"), Imports: []string{"example.com/a"}},
+		{ImportPath: "example.com/c", Dir: filepath.Join(root, "c"), TestImports: []string{"example.com/b"}},
+		{ImportPath: "example.com/d", Dir: filepath.Join(root, "d"), XTestImports: []string{"example.com/c"}},
+		{ImportPath: "example.com/e", Dir: filepath.Join(root, "e"), Imports: []string{"example.com/dep"}},
+	}
+}
+
+func TestSelectAffectedPackages(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "ws")
+	pkgs := sampleListedPackages(root)
+
+	tests := []struct {
+		name         string
+		changed      []string
+		want         []affectedPackage
+		wantFallback bool
+	}{
+		{
+			name:    "reverse imports and test imports",
+			changed: []string{filepath.Join(root, "a", "a.go")},
+			want: []affectedPackage{
+				{ImportPath: "example.com/a", Reason: "changed: a.go"},
+				{ImportPath: "example.com/b", Reason: "imports example.com/a"},
+				{ImportPath: "example.com/c", Reason: "test imports example.com/b"},
+			},
+		},
+		{
+			name:    "embedded file",
+			changed: []string{filepath.Join(root, "a", "assets", "x.txt")},
+			want: []affectedPackage{
+				{ImportPath: "example.com/a", Reason: "changed: x.txt"},
+				{ImportPath: "example.com/b", Reason: "imports example.com/a"},
+				{ImportPath: "example.com/c", Reason: "test imports example.com/b"},
+			},
+		},
+		{
+			name:    "testdata belongs to its package only",
+			changed: []string{filepath.Join(root, "c", "testdata", "golden", "out.txt")},
+			want: []affectedPackage{
+				{ImportPath: "example.com/c", Reason: "changed: out.txt"},
+				{ImportPath: "example.com/d", Reason: "test imports example.com/c"},
+			},
+		},
+		{
+			name:    "unrelated files select nothing",
+			changed: []string{filepath.Join(root, "README.md"), filepath.Join(root, "a", "notes.md")},
+		},
+		{
+			name:         "module file falls back to everything",
+			changed:      []string{filepath.Join(root, "a", "a.go"), filepath.Join(root, "go.mod")},
+			wantFallback: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fallback := selectAffectedPackages(pkgs, tt.changed)
+			if tt.wantFallback {
+				assert.Equal(t, filepath.Join(root, "go.mod"), fallback)
+				assert.Len(t, got, 5, "every workspace package should be selected")
+				return
+			}
+			assert.Empty(t, fallback)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPrintAffectedPackages(t *testing.T) {
+	var buf bytes.Buffer
+	printAffectedPackages(&buf, "main", []affectedPackage{
+		{ImportPath: "example.com/a", Reason: "changed: a.go"},
+		{ImportPath: "example.com/bb", Reason: "imports example.com/a"},
+	}, "", "/ws")
+
+	assert.Equal(t, "🔍 2 packages affected by changes since main:\n"+
+		"  example.com/a   changed: a.go\n"+
+		"  example.com/bb  imports example.com/a\n\n", buf.String())
+
+	buf.Reset()
+	printAffectedPackages(&buf, "main", []affectedPackage{{ImportPath: "example.com/a"}}, "/ws/go.work", "/ws")
+	assert.Equal(t, "🔍 go.work changed since main, testing all 1 package\n", buf.String())
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config sources, from lowest to highest precedence
+const (
+	sourceDefault   = "default"
+	sourceUser      = "user"
+	sourceWorkspace = "workspace"
+	sourceEnv       = "env"
+	sourceFlag      = "flag"
+)
+
+// workspaceConfigNames are the config file names looked up in the workspace root
+var workspaceConfigNames = []string{".goshim.yaml", ".goshim.yml", ".goshim.json"}
+
+// CodesignDefaults holds the defaults used by goshim test -codesign
+type CodesignDefaults struct {
+	Entitlements []string
+	Identity     string
+	Force        bool
+}
+
+// fileConfig is the on-disk shape of a goshim config file. Pointer fields
+// distinguish "not set" from zero values so layers only override what they
+// actually specify.
+type fileConfig struct {
+	Verbose           *bool             `yaml:"verbose" json:"verbose"`
+	LogFormat         *string           `yaml:"log_format" json:"log_format"`
+	PipeStdioToFile   *bool             `yaml:"pipe_stdio_to_file" json:"pipe_stdio_to_file"`
+	MaxLines          *int              `yaml:"max_lines" json:"max_lines"`
+	ErrorsToSuppress  *[]string         `yaml:"errors_to_suppress" json:"errors_to_suppress"`
+	StdoutsToSuppress *[]string         `yaml:"stdouts_to_suppress" json:"stdouts_to_suppress"`
+	Test              *fileTestConfig   `yaml:"test" json:"test"`
+	Codesign          *fileCodesign     `yaml:"codesign" json:"codesign"`
+	ToolEnv           map[string]string `yaml:"tool_env" json:"tool_env"`
+}
+
+type fileTestConfig struct {
+	Flags *[]string `yaml:"flags" json:"flags"`
+}
+
+type fileCodesign struct {
+	Entitlements *[]string `yaml:"entitlements" json:"entitlements"`
+	Identity     *string   `yaml:"identity" json:"identity"`
+	Force        *bool     `yaml:"force" json:"force"`
+}
+
+// configFile records a config file that was considered while loading
+type configFile struct {
+	Source string
+	Path   string
+	Found  bool
+}
+
+// userConfigPaths returns the candidate user-level config files
+func userConfigPaths() []string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(dir, "goshim", "config.yaml"),
+		filepath.Join(dir, "goshim", "config.yml"),
+		filepath.Join(dir, "goshim", "config.json"),
+	}
+}
+
+// workspaceConfigPaths returns the candidate workspace config files
+func (cfg *GoShimConfig) workspaceConfigPaths() []string {
+	paths := make([]string, 0, len(workspaceConfigNames))
+	for _, name := range workspaceConfigNames {
+		paths = append(paths, filepath.Join(cfg.WorkspaceRoot, name))
+	}
+	return paths
+}
+
+// loadConfig layers the user config file, the workspace config file and
+// GOSHIM_* environment variables on top of the defaults. Global flags are
+// applied afterwards in main.
+func (cfg *GoShimConfig) loadConfig() error {
+	layers := []struct {
+		source string
+		paths  []string
+	}{
+		{sourceUser, userConfigPaths()},
+		{sourceWorkspace, cfg.workspaceConfigPaths()},
+	}
+
+	for _, layer := range layers {
+		path := firstExisting(layer.paths)
+		if path == "" {
+			if len(layer.paths) > 0 {
+				cfg.configFiles = append(cfg.configFiles, configFile{Source: layer.source, Path: layer.paths[0]})
+			}
+			continue
+		}
+
+		fc, err := readConfigFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to load %s config: %w", layer.source, err)
+		}
+		cfg.configFiles = append(cfg.configFiles, configFile{Source: layer.source, Path: path, Found: true})
+		cfg.applyFileConfig(fc, layer.source+": "+path)
+	}
+
+	return cfg.applyEnvConfig(os.LookupEnv)
+}
+
+// firstExisting returns the first path that exists
+func firstExisting(paths []string) string {
+	for _, path := range paths {
+		if fileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// readConfigFile decodes a YAML or JSON config file
+func readConfigFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var fc fileConfig
+	if strings.HasSuffix(path, ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&fc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return &fc, nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &fc, nil
+}
+
+// applyFileConfig overrides every value set in fc and records its source
+func (cfg *GoShimConfig) applyFileConfig(fc *fileConfig, source string) {
+	if fc.Verbose != nil {
+		cfg.Verbose = *fc.Verbose
+		cfg.setSource("verbose", source)
+	}
+	if fc.LogFormat != nil {
+		cfg.LogFormat = *fc.LogFormat
+		cfg.setSource("log_format", source)
+	}
+	if fc.PipeStdioToFile != nil {
+		cfg.PipeStdioToFile = *fc.PipeStdioToFile
+		cfg.setSource("pipe_stdio_to_file", source)
+	}
+	if fc.MaxLines != nil {
+		cfg.MaxLines = *fc.MaxLines
+		cfg.setSource("max_lines", source)
+	}
+	if fc.ErrorsToSuppress != nil {
+		cfg.ErrorsToSuppress = *fc.ErrorsToSuppress
+		cfg.setSource("errors_to_suppress", source)
+	}
+	if fc.StdoutsToSuppress != nil {
+		cfg.StdoutsToSuppress = *fc.StdoutsToSuppress
+		cfg.setSource("stdouts_to_suppress", source)
+	}
+	if fc.Test != nil && fc.Test.Flags != nil {
+		cfg.TestFlags = *fc.Test.Flags
+		cfg.setSource("test.flags", source)
+	}
+	if fc.Codesign != nil {
+		if fc.Codesign.Entitlements != nil {
+			cfg.Codesign.Entitlements = *fc.Codesign.Entitlements
+			cfg.setSource("codesign.entitlements", source)
+		}
+		if fc.Codesign.Identity != nil {
+			cfg.Codesign.Identity = *fc.Codesign.Identity
+			cfg.setSource("codesign.identity", source)
+		}
+		if fc.Codesign.Force != nil {
+			cfg.Codesign.Force = *fc.Codesign.Force
+			cfg.setSource("codesign.force", source)
+		}
+	}
+	for key, value := range fc.ToolEnv {
+		if cfg.ToolEnv == nil {
+			cfg.ToolEnv = map[string]string{}
+		}
+		cfg.ToolEnv[key] = value
+		cfg.setSource("tool_env."+key, source)
+	}
+}
+
+// applyEnvConfig applies GOSHIM_* environment variables. List values are
+// newline separated for suppressions (so regexes may contain commas),
+// whitespace separated for test flags and comma separated for entitlements.
+func (cfg *GoShimConfig) applyEnvConfig(lookup func(string) (string, bool)) error {
+	if v, ok := lookup("GOSHIM_VERBOSE"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid GOSHIM_VERBOSE %q: %w", v, err)
+		}
+		cfg.Verbose = b
+		cfg.setSource("verbose", sourceEnv+": GOSHIM_VERBOSE")
+	}
+	if v, ok := lookup("GOSHIM_LOG_FORMAT"); ok {
+		cfg.LogFormat = v
+		cfg.setSource("log_format", sourceEnv+": GOSHIM_LOG_FORMAT")
+	}
+	if v, ok := lookup("GOSHIM_PIPE_STDIO_TO_FILE"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid GOSHIM_PIPE_STDIO_TO_FILE %q: %w", v, err)
+		}
+		cfg.PipeStdioToFile = b
+		cfg.setSource("pipe_stdio_to_file", sourceEnv+": GOSHIM_PIPE_STDIO_TO_FILE")
+	}
+	if v, ok := lookup("GOSHIM_MAX_LINES"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid GOSHIM_MAX_LINES %q: %w", v, err)
+		}
+		cfg.MaxLines = n
+		cfg.setSource("max_lines", sourceEnv+": GOSHIM_MAX_LINES")
+	}
+	if v, ok := lookup("GOSHIM_ERRORS_TO_SUPPRESS"); ok {
+		cfg.ErrorsToSuppress = splitNonEmpty(v, "\n")
+		cfg.setSource("errors_to_suppress", sourceEnv+": GOSHIM_ERRORS_TO_SUPPRESS")
+	}
+	if v, ok := lookup("GOSHIM_STDOUTS_TO_SUPPRESS"); ok {
+		cfg.StdoutsToSuppress = splitNonEmpty(v, "\n")
+		cfg.setSource("stdouts_to_suppress", sourceEnv+": GOSHIM_STDOUTS_TO_SUPPRESS")
+	}
+	if v, ok := lookup("GOSHIM_TEST_FLAGS"); ok {
+		cfg.TestFlags = strings.Fields(v)
+		cfg.setSource("test.flags", sourceEnv+": GOSHIM_TEST_FLAGS")
+	}
+	if v, ok := lookup("GOSHIM_CODESIGN_ENTITLEMENTS"); ok {
+		cfg.Codesign.Entitlements = splitNonEmpty(v, ",")
+		cfg.setSource("codesign.entitlements", sourceEnv+": GOSHIM_CODESIGN_ENTITLEMENTS")
+	}
+	if v, ok := lookup("GOSHIM_CODESIGN_IDENTITY"); ok {
+		cfg.Codesign.Identity = v
+		cfg.setSource("codesign.identity", sourceEnv+": GOSHIM_CODESIGN_IDENTITY")
+	}
+	if v, ok := lookup("GOSHIM_CODESIGN_FORCE"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid GOSHIM_CODESIGN_FORCE %q: %w", v, err)
+		}
+		cfg.Codesign.Force = b
+		cfg.setSource("codesign.force", sourceEnv+": GOSHIM_CODESIGN_FORCE")
+	}
+	return nil
+}
+
+// splitNonEmpty splits s by sep and drops empty entries
+func splitNonEmpty(s, sep string) []string {
+	var out []string
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// setSource records where the effective value of key came from
+func (cfg *GoShimConfig) setSource(key, source string) {
+	if cfg.sources == nil {
+		cfg.sources = map[string]string{}
+	}
+	cfg.sources[key] = source
+}
+
+// source returns where the effective value of key came from
+func (cfg *GoShimConfig) source(key string) string {
+	if s, ok := cfg.sources[key]; ok {
+		return s
+	}
+	return sourceDefault
+}
+
+// handleConfig processes config commands
+func (cfg *GoShimConfig) handleConfig(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("config subcommand required")
+	}
+
+	switch args[1] {
+	case "show":
+		cfg.printConfig()
+		return nil
+	default:
+		return fmt.Errorf("unknown config subcommand: %s", args[1])
+	}
+}
+
+// printConfig prints the effective configuration with the source of each value
+func (cfg *GoShimConfig) printConfig() {
+	scalar := func(key string, value any) {
+		fmt.Fprintf(stdout, "%-24s %-32v (%s)\n", key+":", value, cfg.source(key))
+	}
+	list := func(key string, values []string) {
+		fmt.Fprintf(stdout, "%-24s %-32s (%s)\n", key+":", "", cfg.source(key))
+		for _, v := range values {
+			fmt.Fprintf(stdout, "  - %q\n", v)
+		}
+	}
+
+	fmt.Fprintln(stdout, "goshim effective configuration")
+	fmt.Fprintln(stdout, "------------------------------------------------")
+	fmt.Fprintf(stdout, "%-24s %s\n", "workspace_root:", cfg.WorkspaceRoot)
+	scalar("verbose", cfg.Verbose)
+	scalar("log_format", cfg.LogFormat)
+	scalar("pipe_stdio_to_file", cfg.PipeStdioToFile)
+	scalar("max_lines", cfg.MaxLines)
+	list("errors_to_suppress", cfg.ErrorsToSuppress)
+	list("stdouts_to_suppress", cfg.StdoutsToSuppress)
+	list("test.flags", cfg.TestFlags)
+	list("codesign.entitlements", cfg.Codesign.Entitlements)
+	scalar("codesign.identity", strconv.Quote(cfg.Codesign.Identity))
+	scalar("codesign.force", cfg.Codesign.Force)
+
+	keys := make([]string, 0, len(cfg.ToolEnv))
+	for key := range cfg.ToolEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintln(stdout, "tool_env:")
+	for _, key := range keys {
+		fmt.Fprintf(stdout, "  %-22s %-32s (%s)\n", key, cfg.ToolEnv[key], cfg.source("tool_env."+key))
+	}
+
+	fmt.Fprintln(stdout, "------------------------------------------------")
+	fmt.Fprintln(stdout, "config files:")
+	for _, f := range cfg.configFiles {
+		status := "loaded"
+		if !f.Found {
+			status = "not found"
+		}
+		fmt.Fprintf(stdout, "  %-10s %s (%s)\n", f.Source, f.Path, status)
+	}
+}
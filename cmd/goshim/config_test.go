@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		wantErr  bool
+		validate func(t *testing.T, fc *fileConfig)
+	}{
+		{
+			name: "yaml config",
+			file: ".goshim.yaml",
+			content: `max_lines: 200
+errors_to_suppress:
+  - "^ld: warning:"
+test:
+  flags: ["-race", "-count=1"]
+codesign:
+  entitlements: [hypervisor]
+  force: true
+tool_env:
+  FOO: bar
+`,
+			validate: func(t *testing.T, fc *fileConfig) {
+				require.NotNil(t, fc.MaxLines, "max_lines should be set")
+				assert.Equal(t, 200, *fc.MaxLines)
+				require.NotNil(t, fc.ErrorsToSuppress, "errors_to_suppress should be set")
+				assert.Equal(t, []string{"^ld: warning:"}, *fc.ErrorsToSuppress)
+				assert.Nil(t, fc.StdoutsToSuppress, "unset lists should stay nil")
+				assert.Equal(t, []string{"-race", "-count=1"}, *fc.Test.Flags)
+				assert.Equal(t, []string{"hypervisor"}, *fc.Codesign.Entitlements)
+				assert.True(t, *fc.Codesign.Force)
+				assert.Nil(t, fc.Codesign.Identity, "unset identity should stay nil")
+				assert.Equal(t, map[string]string{"FOO": "bar"}, fc.ToolEnv)
+			},
+		},
+		{
+			name:    "json config",
+			file:    ".goshim.json",
+			content: `{"max_lines": 0, "stdouts_to_suppress": []}`,
+			validate: func(t *testing.T, fc *fileConfig) {
+				assert.Equal(t, 0, *fc.MaxLines, "explicit zero should be kept")
+				require.NotNil(t, fc.StdoutsToSuppress, "explicit empty list should be set")
+				assert.Empty(t, *fc.StdoutsToSuppress)
+			},
+		},
+		{
+			name:    "empty yaml file",
+			file:    ".goshim.yaml",
+			content: "",
+			validate: func(t *testing.T, fc *fileConfig) {
+				assert.Nil(t, fc.MaxLines)
+			},
+		},
+		{
+			name:    "unknown yaml key",
+			file:    ".goshim.yaml",
+			content: "max_line: 10\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown json key",
+			file:    ".goshim.json",
+			content: `{"maxlines": 10}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			fc, err := readConfigFile(path)
+			if tt.wantErr {
+				assert.Error(t, err, "invalid config should fail")
+				return
+			}
+			require.NoError(t, err, "config should parse")
+			tt.validate(t, fc)
+		})
+	}
+}
+
+func TestGoShimConfig_loadConfigPrecedence(t *testing.T) {
+	userDir := t.TempDir()
+	workspace := t.TempDir()
+
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	t.Setenv("HOME", userDir)
+	t.Setenv("GOSHIM_MAX_LINES", "42")
+
+	configDir, err := os.UserConfigDir()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(configDir, "goshim"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "goshim", "config.yaml"), []byte(`max_lines: 10
+test:
+  flags: ["-short"]
+codesign:
+  identity: user-identity
+tool_env:
+  A: user
+  B: user
+`), 0644))
+
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, ".goshim.yaml"), []byte(`max_lines: 20
+codesign:
+  identity: workspace-identity
+tool_env:
+  B: workspace
+`), 0644))
+
+	cfg := NewGoShimConfig()
+	cfg.WorkspaceRoot = workspace
+	require.NoError(t, cfg.loadConfig(), "config should load")
+
+	assert.Equal(t, 42, cfg.MaxLines, "env should override files")
+	assert.Equal(t, "env: GOSHIM_MAX_LINES", cfg.source("max_lines"))
+
+	assert.Equal(t, "workspace-identity", cfg.Codesign.Identity, "workspace should override user")
+	assert.Contains(t, cfg.source("codesign.identity"), "workspace: ")
+
+	assert.Equal(t, []string{"-short"}, cfg.TestFlags, "user value should apply when nothing overrides it")
+	assert.Contains(t, cfg.source("test.flags"), "user: ")
+
+	assert.Equal(t, map[string]string{"A": "user", "B": "workspace"}, cfg.ToolEnv, "tool env should merge per key")
+
+	assert.Equal(t, []string{"virtualization"}, cfg.Codesign.Entitlements, "defaults should remain")
+	assert.Equal(t, sourceDefault, cfg.source("codesign.entitlements"))
+
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	require.NoError(t, cfg.handleConfig([]string{"config", "show"}))
+	assert.Contains(t, buf.String(), "env: GOSHIM_MAX_LINES", "show should include sources")
+	assert.Contains(t, buf.String(), filepath.Join(workspace, ".goshim.yaml"), "show should list config files")
+}
+
+func TestGoShimConfig_applyEnvConfig(t *testing.T) {
+	env := map[string]string{
+		"GOSHIM_VERBOSE":               "true",
+		"GOSHIM_ERRORS_TO_SUPPRESS":    "^a,b$\n\n^c$",
+		"GOSHIM_TEST_FLAGS":            "-race  -count=1",
+		"GOSHIM_CODESIGN_ENTITLEMENTS": "virtualization, hypervisor",
+		"GOSHIM_LOG_FORMAT":            "json",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	cfg := NewGoShimConfig()
+	require.NoError(t, cfg.applyEnvConfig(lookup))
+
+	assert.True(t, cfg.Verbose)
+	assert.Equal(t, []string{"^a,b$", "^c$"}, cfg.ErrorsToSuppress, "suppressions are newline separated")
+	assert.Equal(t, []string{"-race", "-count=1"}, cfg.TestFlags)
+	assert.Equal(t, []string{"virtualization", "hypervisor"}, cfg.Codesign.Entitlements)
+	assert.Equal(t, logFormatJSON, cfg.LogFormat)
+
+	env["GOSHIM_MAX_LINES"] = "lots"
+	assert.Error(t, cfg.applyEnvConfig(lookup), "invalid integer should fail")
+}
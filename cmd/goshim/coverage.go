@@ -0,0 +1,550 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// coverBlock is one block of a coverprofile, see go tool cover
+type coverBlock struct {
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	NumStmt   int
+	Count     int
+}
+
+// coverProfile is a parsed coverprofile. Blocks are keyed by file name as
+// written by go test, i.e. "<import path>/<file>.go".
+type coverProfile struct {
+	Mode   string
+	Files  map[string][]coverBlock
+	order  []string
+	blocks map[string]map[coverBlockKey]int // file -> block -> index into Files
+}
+
+type coverBlockKey struct {
+	startLine, startCol, endLine, endCol int
+}
+
+func newCoverProfile(mode string) *coverProfile {
+	return &coverProfile{
+		Mode:   mode,
+		Files:  map[string][]coverBlock{},
+		blocks: map[string]map[coverBlockKey]int{},
+	}
+}
+
+// add records a block; blocks seen before (e.g. from -coverpkg runs of
+// several packages) are merged, summing counts or, in set mode, or-ing them
+func (cp *coverProfile) add(file string, b coverBlock) {
+	idx, ok := cp.blocks[file]
+	if !ok {
+		idx = map[coverBlockKey]int{}
+		cp.blocks[file] = idx
+		cp.order = append(cp.order, file)
+	}
+
+	key := coverBlockKey{b.StartLine, b.StartCol, b.EndLine, b.EndCol}
+	if i, ok := idx[key]; ok {
+		existing := &cp.Files[file][i]
+		if cp.Mode == "set" {
+			if b.Count > 0 {
+				existing.Count = 1
+			}
+		} else {
+			existing.Count += b.Count
+		}
+		return
+	}
+
+	idx[key] = len(cp.Files[file])
+	cp.Files[file] = append(cp.Files[file], b)
+}
+
+// FileNames returns the profile's files in the order they first appeared
+func (cp *coverProfile) FileNames() []string {
+	return cp.order
+}
+
+// parseCoverProfile parses a coverprofile written by go test -coverprofile
+func parseCoverProfile(r io.Reader) (*coverProfile, error) {
+	var cp *coverProfile
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if mode, ok := strings.CutPrefix(line, "mode: "); ok {
+			if cp == nil {
+				cp = newCoverProfile(mode)
+			}
+			continue // merged profiles repeat the mode line
+		}
+		if cp == nil {
+			return nil, fmt.Errorf("line %d: missing mode line", lineNum)
+		}
+
+		file, b, err := parseCoverLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		cp.add(file, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cp == nil {
+		return nil, fmt.Errorf("empty coverprofile")
+	}
+	return cp, nil
+}
+
+// parseCoverLine parses "file.go:startLine.startCol,endLine.endCol numStmt count"
+func parseCoverLine(line string) (string, coverBlock, error) {
+	var b coverBlock
+
+	colon := strings.LastIndex(line, ":")
+	if colon < 0 {
+		return "", b, fmt.Errorf("malformed block %q", line)
+	}
+	file := line[:colon]
+
+	fields := strings.Fields(line[colon+1:])
+	if len(fields) != 3 {
+		return "", b, fmt.Errorf("malformed block %q", line)
+	}
+
+	start, end, ok := strings.Cut(fields[0], ",")
+	if !ok {
+		return "", b, fmt.Errorf("malformed block range %q", fields[0])
+	}
+
+	var err error
+	if b.StartLine, b.StartCol, err = parseCoverPos(start); err != nil {
+		return "", b, err
+	}
+	if b.EndLine, b.EndCol, err = parseCoverPos(end); err != nil {
+		return "", b, err
+	}
+	if b.NumStmt, err = strconv.Atoi(fields[1]); err != nil {
+		return "", b, fmt.Errorf("malformed statement count %q", fields[1])
+	}
+	if b.Count, err = strconv.Atoi(fields[2]); err != nil {
+		return "", b, fmt.Errorf("malformed count %q", fields[2])
+	}
+	return file, b, nil
+}
+
+func parseCoverPos(s string) (int, int, error) {
+	l, c, ok := strings.Cut(s, ".")
+	if !ok {
+		return 0, 0, fmt.Errorf("malformed position %q", s)
+	}
+	line, err := strconv.Atoi(l)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed position %q", s)
+	}
+	col, err := strconv.Atoi(c)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed position %q", s)
+	}
+	return line, col, nil
+}
+
+// merge adds the blocks of other, which must use the same mode
+func (cp *coverProfile) merge(other *coverProfile) error {
+	if other.Mode != cp.Mode {
+		return fmt.Errorf("cannot merge coverprofiles with modes %q and %q", cp.Mode, other.Mode)
+	}
+	for _, file := range other.FileNames() {
+		for _, b := range other.Files[file] {
+			cp.add(file, b)
+		}
+	}
+	return nil
+}
+
+// write writes the profile in go test -coverprofile format
+func (cp *coverProfile) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", cp.Mode)
+	for _, file := range cp.FileNames() {
+		for _, b := range cp.Files[file] {
+			fmt.Fprintf(bw, "%s:%d.%d,%d.%d %d %d\n", file, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+// readCoverProfile parses the coverprofile at path
+func readCoverProfile(file string) (*coverProfile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open coverprofile: %w", err)
+	}
+	defer f.Close()
+
+	cp, err := parseCoverProfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse coverprofile %s: %w", file, err)
+	}
+	return cp, nil
+}
+
+// coverageStat counts covered statements
+type coverageStat struct {
+	Statements int
+	Covered    int
+}
+
+// Percent returns the covered share of statements, 100 when there are none
+func (s coverageStat) Percent() float64 {
+	if s.Statements == 0 {
+		return 100
+	}
+	return float64(s.Covered) / float64(s.Statements) * 100
+}
+
+func (s *coverageStat) addBlock(b coverBlock) {
+	s.Statements += b.NumStmt
+	if b.Count > 0 {
+		s.Covered += b.NumStmt
+	}
+}
+
+// packageCoverage is the coverage of one package
+type packageCoverage struct {
+	Package string
+	coverageStat
+}
+
+// functionCoverage is the coverage of one function
+type functionCoverage struct {
+	Package string
+	File    string
+	Line    int
+	Name    string
+	coverageStat
+}
+
+// packageCoverages returns per-package coverage, lowest first
+func (cp *coverProfile) packageCoverages() []packageCoverage {
+	byPkg := map[string]*packageCoverage{}
+	var order []string
+	for _, file := range cp.FileNames() {
+		pkg := path.Dir(file)
+		pc, ok := byPkg[pkg]
+		if !ok {
+			pc = &packageCoverage{Package: pkg}
+			byPkg[pkg] = pc
+			order = append(order, pkg)
+		}
+		for _, b := range cp.Files[file] {
+			pc.addBlock(b)
+		}
+	}
+
+	out := make([]packageCoverage, 0, len(order))
+	for _, pkg := range order {
+		out = append(out, *byPkg[pkg])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Percent() < out[j].Percent() })
+	return out
+}
+
+// total returns the coverage across all files
+func (cp *coverProfile) total() coverageStat {
+	var s coverageStat
+	for _, file := range cp.FileNames() {
+		for _, b := range cp.Files[file] {
+			s.addBlock(b)
+		}
+	}
+	return s
+}
+
+// functionCoverages attributes blocks to the functions declared in each
+// file, like go tool cover -func. dirs maps import paths to directories;
+// files whose package is missing or fails to parse are skipped.
+func (cp *coverProfile) functionCoverages(dirs map[string]string) []functionCoverage {
+	var out []functionCoverage
+
+	for _, file := range cp.FileNames() {
+		pkg := path.Dir(file)
+		dir, ok := dirs[pkg]
+		if !ok {
+			continue
+		}
+
+		fset := token.NewFileSet()
+		parsed, err := parser.ParseFile(fset, filepath.Join(dir, path.Base(file)), nil, 0)
+		if err != nil {
+			continue
+		}
+
+		for _, decl := range parsed.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			start := fset.Position(fn.Pos())
+			end := fset.Position(fn.End())
+
+			fc := functionCoverage{Package: pkg, File: file, Line: start.Line, Name: funcDeclName(fn)}
+			for _, b := range cp.Files[file] {
+				if posBefore(b.StartLine, b.StartCol, start.Line, start.Column) || posBefore(end.Line, end.Column, b.EndLine, b.EndCol) {
+					continue
+				}
+				fc.addBlock(b)
+			}
+			out = append(out, fc)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Percent() < out[j].Percent() })
+	return out
+}
+
+func posBefore(line1, col1, line2, col2 int) bool {
+	return line1 < line2 || (line1 == line2 && col1 < col2)
+}
+
+// funcDeclName returns Name or Recv.Name like go tool cover -func
+func funcDeclName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch t := typ.(type) {
+	case *ast.IndexExpr:
+		typ = t.X
+	case *ast.IndexListExpr:
+		typ = t.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// packageDirs resolves import paths to source directories with go list
+func (cfg *GoShimConfig) packageDirs(ctx context.Context, pkgs []string) (map[string]string, error) {
+	dirs := map[string]string{}
+	if len(pkgs) == 0 {
+		return dirs, nil
+	}
+
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"list", "-e", "-f", "{{.ImportPath}}\t{{.Dir}}"}, pkgs...)
+	cmd := exec.CommandContext(ctx, goPath, args...)
+	cmd.Env = os.Environ()
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w", err)
+	}
+
+	for _, line := range strings.Split(out.String(), "\n") {
+		if pkg, dir, ok := strings.Cut(line, "\t"); ok && dir != "" {
+			dirs[pkg] = dir
+		}
+	}
+	return dirs, nil
+}
+
+// coverageThreshold is a -min-coverage requirement. An empty Pattern is the
+// global threshold on total coverage; otherwise every package matching
+// Pattern must reach Min.
+type coverageThreshold struct {
+	Pattern string
+	Min     float64
+}
+
+// parseCoverageThreshold parses "80" or "<package glob>=80"
+func parseCoverageThreshold(value string) (coverageThreshold, error) {
+	var t coverageThreshold
+
+	pct := value
+	if idx := strings.LastIndex(value, "="); idx >= 0 {
+		t.Pattern = value[:idx]
+		pct = value[idx+1:]
+		if t.Pattern == "" {
+			return t, fmt.Errorf("invalid -min-coverage %q: empty package pattern", value)
+		}
+	}
+
+	min, err := strconv.ParseFloat(strings.TrimSuffix(pct, "%"), 64)
+	if err != nil || min < 0 || min > 100 {
+		return t, fmt.Errorf("invalid -min-coverage %q: want a percentage between 0 and 100", value)
+	}
+	t.Min = min
+	return t, nil
+}
+
+// matchPackagePattern matches an import path against a path.Match glob,
+// also accepting go's "/..." suffix for a package and everything below it
+func matchPackagePattern(pattern, pkg string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+		return pkg == prefix || strings.HasPrefix(pkg, prefix+"/")
+	}
+	matched, err := path.Match(pattern, pkg)
+	return err == nil && matched
+}
+
+// coverageViolation is a threshold that was not met
+type coverageViolation struct {
+	Package string // empty for the total
+	Percent float64
+	Min     float64
+}
+
+func (v coverageViolation) String() string {
+	name := v.Package
+	if name == "" {
+		name = "total"
+	}
+	return fmt.Sprintf("%s: %.1f%% < %.1f%%", name, v.Percent, v.Min)
+}
+
+// checkCoverageThresholds returns the thresholds that were not met. When
+// several package patterns match, the last one given wins.
+func checkCoverageThresholds(cp *coverProfile, thresholds []coverageThreshold) []coverageViolation {
+	var violations []coverageViolation
+
+	for _, t := range thresholds {
+		if t.Pattern == "" {
+			if total := cp.total(); total.Percent() < t.Min {
+				violations = append(violations, coverageViolation{Percent: total.Percent(), Min: t.Min})
+			}
+		}
+	}
+
+	for _, pc := range cp.packageCoverages() {
+		if pc.Statements == 0 {
+			continue
+		}
+		var match *coverageThreshold
+		for i := range thresholds {
+			if thresholds[i].Pattern != "" && matchPackagePattern(thresholds[i].Pattern, pc.Package) {
+				match = &thresholds[i]
+			}
+		}
+		if match != nil && pc.Percent() < match.Min {
+			violations = append(violations, coverageViolation{Package: pc.Package, Percent: pc.Percent(), Min: match.Min})
+		}
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Package < violations[j].Package })
+	return violations
+}
+
+// printPackageCoverage prints the per-package table and the total
+func printPackageCoverage(out io.Writer, cp *coverProfile) {
+	fmt.Fprintln(out, "================================================")
+	fmt.Fprintln(out, "Package Coverage")
+	fmt.Fprintln(out, "------------------------------------------------")
+	for _, pc := range cp.packageCoverages() {
+		fmt.Fprintf(out, "%6.1f%%  %s (%d/%d statements)\n", pc.Percent(), pc.Package, pc.Covered, pc.Statements)
+	}
+	total := cp.total()
+	fmt.Fprintf(out, "%6.1f%%  total (%d/%d statements)\n", total.Percent(), total.Covered, total.Statements)
+}
+
+// printFunctionCoverage prints the per-function table
+func printFunctionCoverage(out io.Writer, funcs []functionCoverage) {
+	fmt.Fprintln(out, "================================================")
+	fmt.Fprintln(out, "Function Coverage")
+	fmt.Fprintln(out, "------------------------------------------------")
+	for _, fc := range funcs {
+		fmt.Fprintf(out, "%6.1f%%  %s:%d %s\n", fc.Percent(), fc.File, fc.Line, fc.Name)
+	}
+	fmt.Fprintln(out, "================================================")
+}
+
+// coverageOptions configures coverage analysis for a test run
+type coverageOptions struct {
+	functions  bool // print package and function tables
+	thresholds []coverageThreshold
+	keep       bool    // keep the generated profile
+	diffRef    string  // report coverage of lines changed since this git ref
+	diffMin    float64 // minimum changed line coverage
+}
+
+// enabled reports whether a coverprofile is needed
+func (o coverageOptions) enabled() bool {
+	return o.functions || len(o.thresholds) > 0 || o.keep || o.diffRef != ""
+}
+
+// reportCoverage analyzes the coverprofile written by a test run, prints the
+// requested tables and returns an error if a threshold was not met
+func (cfg *GoShimConfig) reportCoverage(ctx context.Context, opts coverageOptions, profileFile string) error {
+	cp, err := readCoverProfile(profileFile)
+	if err != nil {
+		return err
+	}
+
+	var dirs map[string]string
+	if opts.functions || opts.diffRef != "" {
+		var pkgs []string
+		for _, pc := range cp.packageCoverages() {
+			pkgs = append(pkgs, pc.Package)
+		}
+		if dirs, err = cfg.packageDirs(ctx, pkgs); err != nil {
+			slogctx.Warn(ctx, "Listing package directories failed", slogctx.Err(err))
+		}
+	}
+
+	if opts.functions {
+		printPackageCoverage(stdout, cp)
+		printFunctionCoverage(stdout, cp.functionCoverages(dirs))
+	}
+
+	var failures []error
+	if opts.diffRef != "" {
+		if err := reportDiffCoverage(ctx, opts, cp, dirs); err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	if violations := checkCoverageThresholds(cp, opts.thresholds); len(violations) > 0 {
+		fmt.Fprintln(stdout)
+		fmt.Fprintln(stdout, "=== Coverage below threshold")
+		for _, v := range violations {
+			fmt.Fprintf(stdout, "📉 %s\n", v)
+		}
+		failures = append(failures, fmt.Errorf("coverage below threshold in %d %s", len(violations), pluralize(len(violations), "check", "checks")))
+	}
+
+	return errors.Join(failures...)
+}
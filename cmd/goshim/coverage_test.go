@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleCoverProfile = `mode: atomic
+example.com/a/a.go:5.29,6.12 1 1
+example.com/a/a.go:6.12,8.3 1 1
+example.com/a/a.go:9.2,9.10 1 0
+example.com/a/a.go:12.20,12.30 1 0
+example.com/b/b.go:3.16,3.26 1 2
+mode: atomic
+example.com/b/b.go:3.16,3.26 1 3
+`
+
+const sampleCoverSource = `package a
+
+type T[K any] struct{}
+
+func (t *T[K]) M(x int) int {
+	if x > 0 {
+		return 1
+	}
+	return 0
+}
+
+func Unused() int { return 2 }
+`
+
+func TestParseCoverProfile(t *testing.T) {
+	cp, err := parseCoverProfile(strings.NewReader(sampleCoverProfile))
+	require.NoError(t, err)
+
+	assert.Equal(t, "atomic", cp.Mode)
+	assert.Equal(t, []string{"example.com/a/a.go", "example.com/b/b.go"}, cp.FileNames())
+	require.Len(t, cp.Files["example.com/b/b.go"], 1, "duplicate blocks should be merged")
+	assert.Equal(t, 5, cp.Files["example.com/b/b.go"][0].Count, "merged counts should be summed")
+	assert.Equal(t, coverBlock{StartLine: 5, StartCol: 29, EndLine: 6, EndCol: 12, NumStmt: 1, Count: 1}, cp.Files["example.com/a/a.go"][0])
+
+	_, err = parseCoverProfile(strings.NewReader("example.com/a/a.go:1.1,2.2 1 1\n"))
+	assert.Error(t, err, "a profile without a mode line should be rejected")
+
+	_, err = parseCoverProfile(strings.NewReader("mode: set\nexample.com/a/a.go:1.1 1 1\n"))
+	assert.Error(t, err, "malformed blocks should be rejected")
+}
+
+func TestCoverProfile_packageCoverages(t *testing.T) {
+	cp, err := parseCoverProfile(strings.NewReader(sampleCoverProfile))
+	require.NoError(t, err)
+
+	pkgs := cp.packageCoverages()
+	require.Len(t, pkgs, 2)
+	assert.Equal(t, packageCoverage{Package: "example.com/a", coverageStat: coverageStat{Statements: 4, Covered: 2}}, pkgs[0], "lowest coverage first")
+	assert.Equal(t, 100.0, pkgs[1].Percent())
+	assert.Equal(t, coverageStat{Statements: 5, Covered: 3}, cp.total())
+
+	var buf bytes.Buffer
+	printPackageCoverage(&buf, cp)
+	assert.Contains(t, buf.String(), "  50.0%  example.com/a (2/4 statements)\n")
+	assert.Contains(t, buf.String(), "  60.0%  total (3/5 statements)\n")
+}
+
+func TestCoverProfile_functionCoverages(t *testing.T) {
+	cp, err := parseCoverProfile(strings.NewReader(sampleCoverProfile))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte(sampleCoverSource), 0644))
+
+	funcs := cp.functionCoverages(map[string]string{"example.com/a": dir})
+	require.Len(t, funcs, 2, "packages without a known directory should be skipped")
+
+	assert.Equal(t, "Unused", funcs[0].Name)
+	assert.Equal(t, 12, funcs[0].Line)
+	assert.Equal(t, 0.0, funcs[0].Percent())
+
+	assert.Equal(t, "T.M", funcs[1].Name, "generic receivers should be named like go tool cover")
+	assert.Equal(t, coverageStat{Statements: 3, Covered: 2}, funcs[1].coverageStat)
+}
+
+func TestParseCoverageThreshold(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    coverageThreshold
+		wantErr bool
+	}{
+		{value: "80", want: coverageThreshold{Min: 80}},
+		{value: "72.5%", want: coverageThreshold{Min: 72.5}},
+		{value: "example.com/internal/...=60", want: coverageThreshold{Pattern: "example.com/internal/...", Min: 60}},
+		{value: "=60", wantErr: true},
+		{value: "101", wantErr: true},
+		{value: "lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseCoverageThreshold(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchPackagePattern(t *testing.T) {
+	assert.True(t, matchPackagePattern("example.com/a/...", "example.com/a"))
+	assert.True(t, matchPackagePattern("example.com/a/...", "example.com/a/b/c"))
+	assert.False(t, matchPackagePattern("example.com/a/...", "example.com/ab"))
+	assert.True(t, matchPackagePattern("example.com/*/b", "example.com/a/b"))
+	assert.False(t, matchPackagePattern("example.com/*", "example.com/a/b"))
+}
+
+func TestCheckCoverageThresholds(t *testing.T) {
+	cp, err := parseCoverProfile(strings.NewReader(sampleCoverProfile))
+	require.NoError(t, err)
+
+	violations := checkCoverageThresholds(cp, []coverageThreshold{
+		{Min: 50},
+		{Pattern: "example.com/...", Min: 90},
+		{Pattern: "example.com/b", Min: 100},
+	})
+	require.Len(t, violations, 1)
+	assert.Equal(t, "example.com/a: 50.0% < 90.0%", violations[0].String())
+
+	violations = checkCoverageThresholds(cp, []coverageThreshold{{Min: 75}})
+	require.Len(t, violations, 1)
+	assert.Equal(t, "total: 60.0% < 75.0%", violations[0].String())
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gitOutput runs git in dir and returns its trimmed stdout
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(errOut.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// gitDiffBase returns the git top-level directory and the commit to diff
+// against for ref: the merge base of ref and HEAD, so changes made on ref
+// since branching don't count
+func gitDiffBase(ctx context.Context, dir, ref string) (string, string, error) {
+	top, err := gitOutput(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", err
+	}
+
+	base := ref
+	if mb, err := gitOutput(ctx, top, "merge-base", ref, "HEAD"); err == nil {
+		base = mb
+	}
+	return top, base, nil
+}
+
+// gitChangedFiles returns the absolute paths of files changed since the
+// merge base of ref and HEAD, including uncommitted, deleted and untracked
+// files
+func gitChangedFiles(ctx context.Context, dir, ref string) ([]string, error) {
+	top, base, err := gitDiffBase(ctx, dir, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := gitOutput(ctx, top, "-c", "core.quotePath=false", "diff", "--name-only", "--no-ext-diff", base)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitOutput(ctx, top, "-c", "core.quotePath=false", "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, file := range append(strings.Split(diff, "\n"), strings.Split(untracked, "\n")...) {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, filepath.Join(top, filepath.FromSlash(file)))
+		}
+	}
+	return files, nil
+}
+
+// gitChangedLines returns the git top-level directory and the lines added or
+// changed in each non-test Go file since the merge base of ref and HEAD,
+// including uncommitted and untracked files. Paths are relative to the top
+// level.
+func gitChangedLines(ctx context.Context, dir, ref string) (string, map[string][]int, error) {
+	top, base, err := gitDiffBase(ctx, dir, ref)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// fixed prefixes and unquoted paths, whatever the user's git config says
+	diff, err := gitOutput(ctx, top, "-c", "core.quotePath=false", "diff", "--unified=0", "--no-color", "--no-ext-diff",
+		"--src-prefix=a/", "--dst-prefix=b/", base, "--", "*.go")
+	if err != nil {
+		return "", nil, err
+	}
+
+	changed := parseUnifiedDiff(strings.NewReader(diff))
+
+	// untracked files are not in the diff, every line of them is new
+	untracked, err := gitOutput(ctx, top, "ls-files", "-z", "--others", "--exclude-standard", "--", "*.go")
+	if err != nil {
+		return "", nil, err
+	}
+	for _, file := range strings.Split(untracked, "\x00") {
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(top, file))
+		if err != nil {
+			continue
+		}
+		for l := 1; l <= bytes.Count(data, []byte("\n")); l++ {
+			changed[file] = append(changed[file], l)
+		}
+	}
+
+	for file := range changed {
+		if strings.HasSuffix(file, "_test.go") {
+			delete(changed, file)
+		}
+	}
+	return top, changed, nil
+}
+
+// parseUnifiedDiff extracts the added line numbers of each new file from a
+// git diff with --unified=0. Deleted files are ignored.
+func parseUnifiedDiff(r io.Reader) map[string][]int {
+	changed := map[string][]int{}
+	var file string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file = ""
+			if name, ok := strings.CutPrefix(line, "+++ b/"); ok {
+				file = name
+			}
+		case strings.HasPrefix(line, "@@ ") && file != "":
+			start, count, ok := parseHunkHeader(line)
+			if !ok {
+				continue
+			}
+			for l := start; l < start+count; l++ {
+				changed[file] = append(changed[file], l)
+			}
+		}
+	}
+	return changed
+}
+
+// parseHunkHeader returns the new-file range of "@@ -a,b +c,d @@"
+func parseHunkHeader(line string) (int, int, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, false
+	}
+
+	startStr, countStr, hasCount := strings.Cut(fields[2][1:], ",")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	count := 1
+	if hasCount {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, count, true
+}
+
+// fileDiffCoverage is the coverage of the changed lines of one file. Only
+// lines inside a coverage block (i.e. holding statements) are coverable.
+type fileDiffCoverage struct {
+	File      string // relative to the git top level
+	Changed   int
+	Coverable int
+	Covered   int
+	Uncovered []int
+}
+
+// Percent returns the covered share of coverable changed lines
+func (f fileDiffCoverage) Percent() float64 {
+	if f.Coverable == 0 {
+		return 100
+	}
+	return float64(f.Covered) / float64(f.Coverable) * 100
+}
+
+// diffCoverage intersects changed lines with the profile. dirs maps import
+// paths to directories. Changed files with no profile entry (e.g. packages
+// that were not tested) are returned separately, with every changed line
+// counted as uncovered.
+func diffCoverage(cp *coverProfile, dirs map[string]string, gitTop string, changed map[string][]int) ([]fileDiffCoverage, []fileDiffCoverage) {
+	// map git-relative paths to profile file names
+	profileFiles := map[string]string{}
+	for _, file := range cp.FileNames() {
+		dir, ok := dirs[path.Dir(file)]
+		if !ok {
+			continue
+		}
+		rel, err := filepath.Rel(gitTop, filepath.Join(dir, path.Base(file)))
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		profileFiles[filepath.ToSlash(rel)] = file
+	}
+
+	var results []fileDiffCoverage
+	var untested []fileDiffCoverage
+	for file, lines := range changed {
+		profileFile, ok := profileFiles[file]
+		if !ok {
+			untested = append(untested, fileDiffCoverage{File: file, Changed: len(lines), Coverable: len(lines), Uncovered: lines})
+			continue
+		}
+
+		fc := fileDiffCoverage{File: file, Changed: len(lines)}
+		blocks := cp.Files[profileFile]
+		for _, line := range lines {
+			coverable, covered := false, false
+			for _, b := range blocks {
+				if line < b.StartLine || line > b.EndLine {
+					continue
+				}
+				coverable = true
+				if b.Count > 0 {
+					covered = true
+				}
+			}
+			if !coverable {
+				continue
+			}
+			fc.Coverable++
+			if covered {
+				fc.Covered++
+			} else {
+				fc.Uncovered = append(fc.Uncovered, line)
+			}
+		}
+		results = append(results, fc)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].File < results[j].File })
+	sort.Slice(untested, func(i, j int) bool { return untested[i].File < untested[j].File })
+	return results, untested
+}
+
+// diffCoverageTotal sums the coverable and covered lines of all files
+func diffCoverageTotal(files []fileDiffCoverage) fileDiffCoverage {
+	var total fileDiffCoverage
+	for _, f := range files {
+		total.Changed += f.Changed
+		total.Coverable += f.Coverable
+		total.Covered += f.Covered
+	}
+	return total
+}
+
+// formatLineRanges compacts sorted line numbers, e.g. "3-5,9"
+func formatLineRanges(lines []int) string {
+	var parts []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(lines[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// printDiffCoverage prints the per-file changed-line coverage table
+func printDiffCoverage(out io.Writer, ref string, files, untested []fileDiffCoverage) {
+	fmt.Fprintln(out, "================================================")
+	fmt.Fprintf(out, "Changed Line Coverage (since %s)\n", ref)
+	fmt.Fprintln(out, "------------------------------------------------")
+	if len(files) == 0 && len(untested) == 0 {
+		fmt.Fprintln(out, "No changed Go files")
+	}
+	for _, f := range files {
+		if f.Coverable == 0 {
+			fmt.Fprintf(out, "     -   %s (no statements changed)\n", f.File)
+			continue
+		}
+		line := fmt.Sprintf("%6.1f%%  %s (%d/%d lines)", f.Percent(), f.File, f.Covered, f.Coverable)
+		if len(f.Uncovered) > 0 {
+			line += " uncovered: " + formatLineRanges(f.Uncovered)
+		}
+		fmt.Fprintln(out, line)
+	}
+	for _, f := range untested {
+		fmt.Fprintf(out, "     ?   %s (not in coverage profile, %d %s counted as uncovered)\n",
+			f.File, f.Changed, pluralize(f.Changed, "line", "lines"))
+	}
+	total := diffCoverageTotal(append(slices.Clone(files), untested...))
+	fmt.Fprintf(out, "%6.1f%%  total (%d/%d changed lines)\n", total.Percent(), total.Covered, total.Coverable)
+	fmt.Fprintln(out, "================================================")
+}
+
+// reportDiffCoverage prints coverage of the lines changed since opts.diffRef
+// and returns an error if it is below opts.diffMin. Changed lines of files
+// missing from the profile count against it.
+func reportDiffCoverage(ctx context.Context, opts coverageOptions, cp *coverProfile, dirs map[string]string) error {
+	gitTop, changed, err := gitChangedLines(ctx, ".", opts.diffRef)
+	if err != nil {
+		return fmt.Errorf("failed to diff against %s: %w", opts.diffRef, err)
+	}
+
+	files, untested := diffCoverage(cp, dirs, gitTop, changed)
+	printDiffCoverage(stdout, opts.diffRef, files, untested)
+
+	if total := diffCoverageTotal(append(files, untested...)); total.Percent() < opts.diffMin {
+		return fmt.Errorf("changed line coverage %.1f%% is below %.1f%%", total.Percent(), opts.diffMin)
+	}
+	return nil
+}
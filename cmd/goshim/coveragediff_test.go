@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleUnifiedDiff = `diff --git a/a/a.go b/a/a.go
+index 1111111..2222222 100644
+--- a/a/a.go
++++ b/a/a.go
+@@ -5,0 +6,2 @@ func (t *T[K]) M(x int) int {
++	x++
++	x--
+@@ -12 +14 @@ func Unused() int { return 2 }
+-func Unused() int { return 2 }
++func Unused() int { return 3 }
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-package old
+`
+
+func TestParseUnifiedDiff(t *testing.T) {
+	changed := parseUnifiedDiff(strings.NewReader(sampleUnifiedDiff))
+
+	assert.Equal(t, map[string][]int{"a/a.go": {6, 7, 14}}, changed, "deleted files and removed lines should be ignored")
+}
+
+func TestParseHunkHeader(t *testing.T) {
+	tests := []struct {
+		line      string
+		start     int
+		count     int
+		wantValid bool
+	}{
+		{"@@ -5,0 +6,2 @@ func x()", 6, 2, true},
+		{"@@ -12 +14 @@", 14, 1, true},
+		{"@@ -1,3 +0,0 @@", 0, 0, true},
+		{"@@ garbage", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			start, count, ok := parseHunkHeader(tt.line)
+			assert.Equal(t, tt.wantValid, ok)
+			assert.Equal(t, tt.start, start)
+			assert.Equal(t, tt.count, count)
+		})
+	}
+}
+
+func TestDiffCoverage(t *testing.T) {
+	cp, err := parseCoverProfile(strings.NewReader(sampleCoverProfile))
+	require.NoError(t, err)
+
+	top := t.TempDir()
+	dirs := map[string]string{
+		"example.com/a": filepath.Join(top, "a"),
+		"example.com/b": filepath.Join(top, "b"),
+	}
+	changed := map[string][]int{
+		"a/a.go":     {1, 6, 7, 9, 12},
+		"c/c.go":     {3},
+		"b/b.go":     {1},
+		"README.go2": {1},
+	}
+
+	files, untested := diffCoverage(cp, dirs, top, changed)
+	assert.Equal(t, []fileDiffCoverage{
+		{File: "README.go2", Changed: 1, Coverable: 1, Uncovered: []int{1}},
+		{File: "c/c.go", Changed: 1, Coverable: 1, Uncovered: []int{3}},
+	}, untested, "untested files should count every changed line as uncovered")
+	require.Len(t, files, 2)
+
+	assert.Equal(t, fileDiffCoverage{File: "a/a.go", Changed: 5, Coverable: 4, Covered: 2, Uncovered: []int{9, 12}}, files[0],
+		"lines outside any block should not be coverable")
+	assert.Equal(t, 0, files[1].Coverable)
+	assert.Equal(t, 100.0, files[1].Percent(), "files without changed statements count as covered")
+
+	total := diffCoverageTotal(files)
+	assert.Equal(t, 50.0, total.Percent())
+
+	var buf bytes.Buffer
+	printDiffCoverage(&buf, "main", files, untested)
+	assert.Contains(t, buf.String(), "  50.0%  a/a.go (2/4 lines) uncovered: 9,12\n")
+	assert.Contains(t, buf.String(), "     ?   c/c.go (not in coverage profile, 1 line counted as uncovered)\n")
+	assert.Contains(t, buf.String(), "  33.3%  total (2/6 changed lines)\n", "untested files should count against the total")
+}
+
+func TestGitChangedLines(t *testing.T) {
+	top := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", top}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git("init", "-q")
+	// user config that changes diff output must not confuse the parser
+	git("config", "diff.noprefix", "true")
+	git("config", "diff.mnemonicPrefix", "true")
+	git("config", "core.quotePath", "true")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "test")
+
+	writeFiles(t, top, map[string]string{
+		"a/a.go": "package a\n\nfunc A() {}\n",
+	})
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+
+	writeFiles(t, top, map[string]string{
+		"a/a.go":             "package a\n\nfunc A() {}\n\nfunc B() {}\n",
+		"a/naïve file.go":    "package a\n\nfunc C() {}\n",
+		"a/untested_test.go": "package a\n",
+	})
+
+	gitTop, changed, err := gitChangedLines(t.Context(), top, "HEAD")
+	require.NoError(t, err)
+	resolved, err := filepath.EvalSymlinks(top)
+	require.NoError(t, err)
+	assert.Equal(t, resolved, gitTop)
+	assert.Equal(t, map[string][]int{
+		"a/a.go":          {4, 5},
+		"a/naïve file.go": {1, 2, 3},
+	}, changed)
+}
+
+func TestFormatLineRanges(t *testing.T) {
+	assert.Equal(t, "", formatLineRanges(nil))
+	assert.Equal(t, "3", formatLineRanges([]int{3}))
+	assert.Equal(t, "3-5,9,11-12", formatLineRanges([]int{3, 4, 5, 9, 11, 12}))
+}
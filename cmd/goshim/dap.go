@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -8,7 +9,7 @@ import (
 )
 
 // handleDap processes dap commands
-func (cfg *GoShimConfig) handleDap(args []string) error {
+func (cfg *GoShimConfig) handleDap(ctx context.Context, args []string) error {
 
 	var root bool
 	var listenAddress string
@@ -31,7 +32,6 @@ func (cfg *GoShimConfig) handleDap(args []string) error {
 	// argz = append(argz, "--client-addr="+addr)
 
 	if root && os.Geteuid() != 0 {
-		fmt.Println("debug: root is required for -root flag")
 		return fmt.Errorf("root is required for -root flag")
 	}
 
@@ -44,11 +44,11 @@ func (cfg *GoShimConfig) handleDap(args []string) error {
 	os.Setenv("PATH", updatedPath)
 	os.Setenv("DAP_LISTEN_ADDRESS", listenAddress)
 
-	dlvCmd := exec.Command("dlv", append([]string{"dap"}, argz...)...)
+	dlvCmd := exec.CommandContext(ctx, "dlv", append([]string{"dap"}, argz...)...)
 	dlvCmd.Env = append(updatedEnv, "DAP_LISTEN_ADDRESS="+listenAddress)
 	dlvCmd.Stdout = stdout
 	dlvCmd.Stderr = stderr
 	dlvCmd.Stdin = stdin
 
-	return dlvCmd.Run()
+	return runCommand(dlvCmd)
 }
@@ -0,0 +1,16 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// lockFile is a no-op: writers still replace files atomically, but
+// concurrent updates may drop each other's changes
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op, see lockFile
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// suppressPattern matches one or more consecutive output lines.
+// Single-line patterns have one regexp; block patterns (configured with
+// embedded newlines) have one regexp per line and only match when every
+// line of the block matches in order.
+type suppressPattern struct {
+	source string
+	lines  []*regexp.Regexp
+}
+
+// compileSuppressPatterns compiles suppression strings into patterns.
+// Each entry is treated as a regular expression; entries that fail to
+// compile fall back to a literal match so plain strings keep working.
+func compileSuppressPatterns(entries []string) []suppressPattern {
+	patterns := make([]suppressPattern, 0, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		pattern := suppressPattern{source: entry}
+		for _, line := range strings.Split(strings.TrimRight(entry, "\n"), "\n") {
+			re, err := regexp.Compile(line)
+			if err != nil {
+				re = regexp.MustCompile(regexp.QuoteMeta(line))
+			}
+			pattern.lines = append(pattern.lines, re)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// filterWriter is a line-buffered writer that drops lines matching any of
+// its suppression patterns before passing output to the wrapped writer.
+type filterWriter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	patterns []suppressPattern
+
+	// collapse replaces each run of suppressed lines with a single marker
+	// line instead of dropping it silently
+	collapse bool
+
+	partial    []byte
+	pending    []string
+	run        int
+	suppressed int
+}
+
+// newFilterWriter wraps out with a filter for the given suppression entries
+func newFilterWriter(out io.Writer, entries []string, collapse bool) *filterWriter {
+	return &filterWriter{
+		out:      out,
+		patterns: compileSuppressPatterns(entries),
+		collapse: collapse,
+	}
+}
+
+// Write buffers p and emits every complete line that is not suppressed
+func (fw *filterWriter) Write(p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if len(fw.patterns) == 0 {
+		return fw.out.Write(p)
+	}
+
+	fw.partial = append(fw.partial, p...)
+	for {
+		idx := bytes.IndexByte(fw.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		line := string(fw.partial[:idx+1])
+		fw.partial = fw.partial[idx+1:]
+
+		if err := fw.processLine(line); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// processLine queues a line and resolves as many queued lines as possible
+func (fw *filterWriter) processLine(line string) error {
+	fw.pending = append(fw.pending, line)
+
+	for len(fw.pending) > 0 {
+		matched, waiting := fw.matchPending()
+		if waiting {
+			return nil
+		}
+		if matched > 0 {
+			fw.run += matched
+			fw.suppressed += matched
+			fw.pending = fw.pending[matched:]
+			continue
+		}
+
+		if err := fw.flushRun(); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw.out, fw.pending[0]); err != nil {
+			return err
+		}
+		fw.pending = fw.pending[1:]
+	}
+
+	return nil
+}
+
+// matchPending reports how many leading pending lines are fully matched by
+// the longest complete pattern, and whether a longer block pattern could
+// still match once more lines arrive.
+func (fw *filterWriter) matchPending() (matched int, waiting bool) {
+	for _, p := range fw.patterns {
+		n := len(p.lines)
+		if n > len(fw.pending) {
+			n = len(fw.pending)
+		}
+
+		ok := true
+		for i := 0; i < n; i++ {
+			if !p.lines[i].MatchString(strings.TrimRight(fw.pending[i], "\r\n")) {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		if n == len(p.lines) {
+			if n > matched {
+				matched = n
+			}
+			continue
+		}
+		waiting = true
+	}
+
+	return matched, waiting
+}
+
+// flushRun writes the collapse marker for the current run of suppressed lines
+func (fw *filterWriter) flushRun() error {
+	if fw.run == 0 {
+		return nil
+	}
+	count := fw.run
+	fw.run = 0
+
+	if !fw.collapse {
+		return nil
+	}
+	_, err := fmt.Fprintf(fw.out, "… %d %s suppressed\n", count, pluralize(count, "line", "lines"))
+	return err
+}
+
+// Flush emits any buffered partial line and pending block candidates
+func (fw *filterWriter) Flush() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if len(fw.partial) > 0 {
+		fw.pending = append(fw.pending, string(fw.partial))
+		fw.partial = nil
+	}
+
+	// nothing more is coming, so partially matched blocks can't complete
+	for len(fw.pending) > 0 {
+		matched, _ := fw.matchPending()
+		if matched > 0 {
+			fw.run += matched
+			fw.suppressed += matched
+			fw.pending = fw.pending[matched:]
+			continue
+		}
+		if err := fw.flushRun(); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw.out, fw.pending[0]); err != nil {
+			return err
+		}
+		fw.pending = fw.pending[1:]
+	}
+
+	return fw.flushRun()
+}
+
+// Disable flushes anything buffered and passes all further writes through
+func (fw *filterWriter) Disable() error {
+	if err := fw.Flush(); err != nil {
+		return err
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.patterns = nil
+	return nil
+}
+
+// Suppressed returns the number of lines dropped so far
+func (fw *filterWriter) Suppressed() int {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.suppressed
+}
+
+// pluralize picks the singular or plural form for count
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
+
+// setupOutputFilters wraps the global stdout and stderr writers with the
+// configured suppression filters. Call closeOutput before exiting so
+// buffered lines and the suppression footer are written.
+func (cfg *GoShimConfig) setupOutputFilters() {
+	// in verbose mode show where output was dropped instead of hiding it
+	cfg.stdoutFilter = newFilterWriter(stdout, cfg.StdoutsToSuppress, cfg.Verbose)
+	cfg.stderrFilter = newFilterWriter(stderr, cfg.ErrorsToSuppress, cfg.Verbose)
+	if cfg.footer == nil {
+		cfg.footer = stderr
+	}
+
+	stdout = cfg.stdoutFilter
+	stderr = cfg.stderrFilter
+}
+
+// disableOutputFilters turns suppression off for the rest of the run
+func (cfg *GoShimConfig) disableOutputFilters() {
+	for _, fw := range []*filterWriter{cfg.stdoutFilter, cfg.stderrFilter} {
+		if fw != nil {
+			fw.Disable()
+		}
+	}
+}
+
+// closeOutput flushes the output filters and truncation buffers and prints
+// a one-line footer if anything was suppressed
+func (cfg *GoShimConfig) closeOutput() {
+	total := 0
+	for _, fw := range []*filterWriter{cfg.stdoutFilter, cfg.stderrFilter} {
+		if fw == nil {
+			continue
+		}
+		fw.Flush()
+		total += fw.Suppressed()
+	}
+
+	for _, tw := range []*truncateWriter{cfg.stdoutTruncate, cfg.stderrTruncate} {
+		if tw != nil {
+			tw.Close()
+		}
+	}
+
+	cfg.stdoutFilter, cfg.stderrFilter = nil, nil
+	cfg.stdoutTruncate, cfg.stderrTruncate = nil, nil
+
+	if total > 0 && cfg.footer != nil {
+		fmt.Fprintf(cfg.footer, "🔇 goshim: %d %s suppressed\n", total, pluralize(total, "line", "lines"))
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterWriter(t *testing.T) {
+	tests := []struct {
+		name           string
+		patterns       []string
+		collapse       bool
+		writes         []string
+		expected       string
+		wantSuppressed int
+	}{
+		{
+			name:     "literal match drops line",
+			patterns: []string{"ld: warning: ignoring duplicate libraries: '-lobjc'"},
+			writes: []string{
+				"building\n",
+				"ld: warning: ignoring duplicate libraries: '-lobjc'\n",
+				"done\n",
+			},
+			expected:       "building\ndone\n",
+			wantSuppressed: 1,
+		},
+		{
+			name:           "regex match",
+			patterns:       []string{`^# github\.com/lima-vm/.*$`},
+			writes:         []string{"# github.com/lima-vm/lima/cmd/limactl\nok\n"},
+			expected:       "ok\n",
+			wantSuppressed: 1,
+		},
+		{
+			name:           "invalid regex falls back to literal",
+			patterns:       []string{"broken (pattern"},
+			writes:         []string{"a broken (pattern here\nkeep\n"},
+			expected:       "keep\n",
+			wantSuppressed: 1,
+		},
+		{
+			name:           "lines split across writes",
+			patterns:       []string{"noise"},
+			writes:         []string{"no", "ise\nsig", "nal\n"},
+			expected:       "signal\n",
+			wantSuppressed: 1,
+		},
+		{
+			name:           "multi-line block pattern",
+			patterns:       []string{"^# github.com/lima-vm/lima/cmd/limactl$\n^ld: warning: .*$"},
+			writes:         []string{"before\n# github.com/lima-vm/lima/cmd/limactl\nld: warning: ignoring duplicate libraries: '-lobjc'\nafter\n"},
+			expected:       "before\nafter\n",
+			wantSuppressed: 2,
+		},
+		{
+			name:           "incomplete block is emitted",
+			patterns:       []string{"^first$\n^second$"},
+			writes:         []string{"first\nthird\n"},
+			expected:       "first\nthird\n",
+			wantSuppressed: 0,
+		},
+		{
+			name:           "collapse replaces runs with a marker",
+			patterns:       []string{"^noise"},
+			collapse:       true,
+			writes:         []string{"a\nnoise 1\nnoise 2\nb\nnoise 3\n"},
+			expected:       "a\n… 2 lines suppressed\nb\n… 1 line suppressed\n",
+			wantSuppressed: 3,
+		},
+		{
+			name:           "partial trailing line is flushed",
+			patterns:       []string{"noise"},
+			writes:         []string{"keep\nno newline"},
+			expected:       "keep\nno newline",
+			wantSuppressed: 0,
+		},
+		{
+			name:           "no patterns passes through",
+			patterns:       nil,
+			writes:         []string{"anything\n", "partial"},
+			expected:       "anything\npartial",
+			wantSuppressed: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			fw := newFilterWriter(&buf, tt.patterns, tt.collapse)
+
+			for _, w := range tt.writes {
+				n, err := fw.Write([]byte(w))
+				require.NoError(t, err, "write should succeed")
+				assert.Equal(t, len(w), n, "write should report all bytes consumed")
+			}
+			require.NoError(t, fw.Flush(), "flush should succeed")
+
+			assert.Equal(t, tt.expected, buf.String(), "filtered output should match")
+			assert.Equal(t, tt.wantSuppressed, fw.Suppressed(), "suppressed count should match")
+		})
+	}
+}
+
+func TestGoShimConfig_closeOutput(t *testing.T) {
+	oldStdout, oldStderr := stdout, stderr
+	defer func() { stdout, stderr = oldStdout, oldStderr }()
+
+	var out, errOut bytes.Buffer
+	stdout, stderr = &out, &errOut
+
+	cfg := &GoShimConfig{
+		ErrorsToSuppress:  []string{"plugin.proto#L122"},
+		StdoutsToSuppress: []string{"^skip me$"},
+	}
+	cfg.setupOutputFilters()
+
+	stdout.Write([]byte("skip me\nhello\n"))
+	stderr.Write([]byte("warning at plugin.proto#L122\n"))
+	cfg.closeOutput()
+
+	assert.Equal(t, "hello\n", out.String(), "stdout should be filtered")
+	assert.True(t, strings.HasSuffix(errOut.String(), "2 lines suppressed\n"), "footer should report total, got: %q", errOut.String())
+
+	// a second close must not print another footer
+	cfg.closeOutput()
+	assert.Equal(t, 1, strings.Count(errOut.String(), "suppressed"), "footer should only print once")
+}
+
+func TestFilterWriter_Disable(t *testing.T) {
+	var buf bytes.Buffer
+	fw := newFilterWriter(&buf, []string{"^skip me$"}, false)
+
+	fw.Write([]byte("skip me\npartial"))
+	require.NoError(t, fw.Disable(), "disable should succeed")
+	fw.Write([]byte("\nskip me\n"))
+
+	assert.Equal(t, "partial\nskip me\n", buf.String(), "disabled filter should flush and pass everything through")
+}
+
+func TestGoShimConfig_handleTestRawOutput(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOTOOLCHAIN", "local")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod": "module example.com/raw\n\ngo 1.24\n",
+		"raw_test.go": "package raw\n\nimport \"testing\"\n\nfunc TestLoud(t *testing.T) {\n" +
+			"\tfor i := 0; i < 20; i++ {\n\t\tt.Log(\"noise\", i)\n\t}\n}\n",
+	})
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	require.NoError(t, os.Chdir(root))
+
+	oldStdout, oldStderr := stdout, stderr
+	defer func() { stdout, stderr = oldStdout, oldStderr }()
+
+	var out, errOut bytes.Buffer
+	stdout, stderr = &out, &errOut
+
+	// -json output is data for editors: neither truncation nor suppression
+	// may touch it
+	cfg := &GoShimConfig{WorkspaceRoot: root, MaxLines: 4, StdoutsToSuppress: []string{`"Action":"output"`}}
+	cfg.setupOutputTruncation()
+	cfg.setupOutputFilters()
+	require.NoError(t, cfg.handleTest(t.Context(), []string{"test", "-json", "-count=1", "."}))
+	cfg.closeOutput()
+
+	assert.Equal(t, 20, strings.Count(out.String(), "noise"), "every output event should be kept")
+	assert.NotContains(t, out.String()+errOut.String(), "elided", "nothing should be truncated")
+	assert.NotContains(t, errOut.String(), "suppressed", "nothing should be suppressed")
+}
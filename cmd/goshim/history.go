@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxHistoryRuns bounds the history file; older runs are dropped on write
+const maxHistoryRuns = 1000
+
+// historyRun is one test run as stored in the history file, one JSON
+// object per line
+type historyRun struct {
+	Time  time.Time     `json:"time"`
+	Args  []string      `json:"args,omitempty"`
+	Shard string        `json:"shard,omitempty"` // i/n for a -shard run
+	Tests []historyTest `json:"tests"`
+}
+
+type historyTest struct {
+	Package string  `json:"package"`
+	Name    string  `json:"test"`
+	Result  string  `json:"result"`
+	Elapsed float64 `json:"elapsed_seconds"`
+}
+
+// historyFile returns the path of the test history store
+func (cfg *GoShimConfig) historyFile() string {
+	return filepath.Join(cfg.WorkspaceRoot, ".log", "goshim", "test-history.jsonl")
+}
+
+// recordTestHistory appends the per-test outcomes of results to the history
+// store, dropping the oldest runs beyond maxHistoryRuns. shard is the -shard
+// of the run, if any. Cached packages are skipped: their durations are those
+// of the run that filled the cache, which is already recorded.
+func (cfg *GoShimConfig) recordTestHistory(results *testResults, goArgs []string, shard string) error {
+	run := historyRun{Time: results.start, Args: goArgs[1:], Shard: shard}
+	for _, p := range results.Packages() {
+		if p.Cached {
+			continue
+		}
+		for _, tc := range p.Tests() {
+			if tc.Result == "" {
+				continue // interrupted, e.g. by a panic or timeout
+			}
+			run.Tests = append(run.Tests, historyTest{
+				Package: p.Name,
+				Name:    tc.Name,
+				Result:  tc.Result,
+				Elapsed: tc.Elapsed.Seconds(),
+			})
+		}
+	}
+	if len(run.Tests) == 0 {
+		return nil
+	}
+
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode test history: %w", err)
+	}
+
+	path := cfg.historyFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	// concurrent goshim runs (e.g. shards on one machine) take turns, so no
+	// run is lost between reading and rewriting the file
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open test history lock: %w", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock test history: %w", err)
+	}
+	defer unlockFile(lock)
+
+	lines, err := readHistoryLines(path)
+	if err != nil {
+		return err
+	}
+	lines = append(lines, string(line))
+	if len(lines) > maxHistoryRuns {
+		lines = lines[len(lines)-maxHistoryRuns:]
+	}
+
+	// write a temp file and rename it over the history, so readers never
+	// see a partially written file
+	tmp, err := os.CreateTemp(filepath.Dir(path), "test-history-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write test history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write test history: %w", err)
+	}
+	if _, err := tmp.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write test history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write test history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write test history: %w", err)
+	}
+	return nil
+}
+
+// readHistoryLines returns the raw lines of the history file, if any
+func readHistoryLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open test history: %w", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read test history: %w", err)
+	}
+	return lines, nil
+}
+
+// loadTestHistory reads all runs recorded at or after since. Lines that do
+// not decode (e.g. a partially written line) are skipped.
+func loadTestHistory(path string, since time.Time) ([]historyRun, error) {
+	lines, err := readHistoryLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []historyRun
+	for _, line := range lines {
+		var run historyRun
+		if err := json.Unmarshal([]byte(line), &run); err != nil {
+			continue
+		}
+		if run.Time.Before(since) {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// testHistoryStats aggregates the recorded outcomes of one test
+type testHistoryStats struct {
+	Package    string
+	Name       string
+	Runs       int
+	Passes     int
+	Fails      int
+	Durations  []time.Duration // passing runs, oldest first
+	LastResult string
+	LastRun    time.Time
+	LastFailed time.Time
+}
+
+// FailureRate is the share of non-skipped runs that failed
+func (s *testHistoryStats) FailureRate() float64 {
+	if s.Passes+s.Fails == 0 {
+		return 0
+	}
+	return float64(s.Fails) / float64(s.Passes+s.Fails)
+}
+
+// Flaky reports whether the test has both passed and failed
+func (s *testHistoryStats) Flaky() bool {
+	return s.Passes > 0 && s.Fails > 0
+}
+
+// aggregateTestHistory folds runs, oldest first, into per-test stats
+func aggregateTestHistory(runs []historyRun) []*testHistoryStats {
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Time.Before(runs[j].Time) })
+
+	index := map[string]*testHistoryStats{}
+	var all []*testHistoryStats
+	for _, run := range runs {
+		for _, t := range run.Tests {
+			key := t.Package + " " + t.Name
+			s, ok := index[key]
+			if !ok {
+				s = &testHistoryStats{Package: t.Package, Name: t.Name}
+				index[key] = s
+				all = append(all, s)
+			}
+
+			s.Runs++
+			s.LastResult = t.Result
+			s.LastRun = run.Time
+			switch t.Result {
+			case resultPass:
+				s.Passes++
+				s.Durations = append(s.Durations, secondsToDuration(t.Elapsed))
+			case resultFail:
+				s.Fails++
+				s.LastFailed = run.Time
+			}
+		}
+	}
+	return all
+}
+
+// slowestTests returns tests ordered by their mean passing duration
+// over the most recent window runs
+func slowestTests(stats []*testHistoryStats, window int) []*testHistoryStats {
+	var out []*testHistoryStats
+	for _, s := range stats {
+		if len(s.Durations) > 0 {
+			out = append(out, s)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return meanDuration(recentDurations(out[i], window)) > meanDuration(recentDurations(out[j], window))
+	})
+	return out
+}
+
+// durationRegression describes a test whose latest passing run was slower
+// than usual
+type durationRegression struct {
+	*testHistoryStats
+	Latest   time.Duration
+	Baseline time.Duration
+}
+
+// Ratio is how many times slower the latest run was than the baseline
+func (r durationRegression) Ratio() float64 {
+	if r.Baseline <= 0 {
+		return 0
+	}
+	return float64(r.Latest) / float64(r.Baseline)
+}
+
+// Minimum history and slowdown before a duration counts as regressed;
+// the absolute floor keeps microsecond tests from dominating the view
+const (
+	regressionMinSamples = 3
+	regressionMinRatio   = 1.5
+	regressionMinDelta   = 50 * time.Millisecond
+)
+
+// regressedTests compares each test's latest passing duration against the
+// median of the passing runs before it
+func regressedTests(stats []*testHistoryStats, window int) []durationRegression {
+	var out []durationRegression
+	for _, s := range stats {
+		if len(s.Durations) < regressionMinSamples+1 {
+			continue
+		}
+		latest := s.Durations[len(s.Durations)-1]
+		previous := s.Durations[:len(s.Durations)-1]
+		if len(previous) > window {
+			previous = previous[len(previous)-window:]
+		}
+
+		r := durationRegression{testHistoryStats: s, Latest: latest, Baseline: medianDuration(previous)}
+		if r.Ratio() >= regressionMinRatio && latest-r.Baseline >= regressionMinDelta {
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Ratio() > out[j].Ratio() })
+	return out
+}
+
+// failingTests returns tests that failed at least once, by failure rate
+func failingTests(stats []*testHistoryStats) []*testHistoryStats {
+	var out []*testHistoryStats
+	for _, s := range stats {
+		if s.Fails > 0 {
+			out = append(out, s)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].FailureRate() != out[j].FailureRate() {
+			return out[i].FailureRate() > out[j].FailureRate()
+		}
+		return out[i].Fails > out[j].Fails
+	})
+	return out
+}
+
+// lastFailedTests returns tests whose most recent outcome was a failure,
+// most recent first
+func lastFailedTests(stats []*testHistoryStats) []*testHistoryStats {
+	var out []*testHistoryStats
+	for _, s := range stats {
+		if s.LastResult == resultFail {
+			out = append(out, s)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].LastRun.After(out[j].LastRun) })
+	return out
+}
+
+func recentDurations(s *testHistoryStats, window int) []time.Duration {
+	if len(s.Durations) > window {
+		return s.Durations[len(s.Durations)-window:]
+	}
+	return s.Durations
+}
+
+func meanDuration(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range ds {
+		total += d
+	}
+	return total / time.Duration(len(ds))
+}
+
+func medianDuration(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// isSubtest reports whether name is a subtest (contains a slash)
+func isSubtest(name string) bool {
+	return strings.Contains(name, "/")
+}
+
+// handleTestHistory implements goshim test-history
+func (cfg *GoShimConfig) handleTestHistory(args []string) error {
+	view := "slowest"
+	if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		view = args[1]
+		args = args[1:]
+	}
+	switch view {
+	case "slowest", "regressed", "failures", "flaky", "last-failed":
+	default:
+		return fmt.Errorf("unknown test-history view: %s (want slowest, regressed, failures or last-failed)", view)
+	}
+
+	fs := flag.NewFlagSet("test-history", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	limit := fs.Int("n", 10, "number of tests to show")
+	since := fs.Duration("since", 0, "only consider runs within this duration (e.g. 72h)")
+	window := fs.Int("window", 10, "recent passing runs used for durations")
+	subtests := fs.Bool("subtests", false, "include subtests in duration views")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var cutoff time.Time
+	if *since > 0 {
+		cutoff = time.Now().Add(-*since)
+	}
+
+	runs, err := loadTestHistory(cfg.historyFile(), cutoff)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Fprintf(stdout, "No test history recorded yet (%s)\n", cfg.historyFile())
+		return nil
+	}
+
+	stats := aggregateTestHistory(runs)
+	if !*subtests && (view == "slowest" || view == "regressed") {
+		var topLevel []*testHistoryStats
+		for _, s := range stats {
+			if !isSubtest(s.Name) {
+				topLevel = append(topLevel, s)
+			}
+		}
+		stats = topLevel
+	}
+
+	fmt.Fprintf(stdout, "Test history: %d %s, %d %s\n\n",
+		len(runs), pluralize(len(runs), "run", "runs"), len(stats), pluralize(len(stats), "test", "tests"))
+
+	switch view {
+	case "slowest":
+		printSlowestTests(stdout, limitStats(slowestTests(stats, *window), *limit), *window)
+	case "regressed":
+		regressions := regressedTests(stats, *window)
+		if len(regressions) > *limit {
+			regressions = regressions[:*limit]
+		}
+		printRegressedTests(stdout, regressions)
+	case "failures", "flaky":
+		printFailingTests(stdout, limitStats(failingTests(stats), *limit))
+	case "last-failed":
+		printLastFailedTests(stdout, limitStats(lastFailedTests(stats), *limit))
+	}
+	return nil
+}
+
+func limitStats(stats []*testHistoryStats, limit int) []*testHistoryStats {
+	if limit > 0 && len(stats) > limit {
+		return stats[:limit]
+	}
+	return stats
+}
+
+func printSlowestTests(out io.Writer, stats []*testHistoryStats, window int) {
+	if len(stats) == 0 {
+		fmt.Fprintln(out, "No passing tests recorded")
+		return
+	}
+	fmt.Fprintf(out, "%-10s %-10s %-6s %s\n", "MEAN", "LAST", "RUNS", "TEST")
+	for _, s := range stats {
+		fmt.Fprintf(out, "%-10s %-10s %-6d %s %s\n",
+			formatElapsed(meanDuration(recentDurations(s, window))),
+			formatElapsed(s.Durations[len(s.Durations)-1]),
+			s.Runs, s.Package, s.Name)
+	}
+}
+
+func printRegressedTests(out io.Writer, regressions []durationRegression) {
+	if len(regressions) == 0 {
+		fmt.Fprintln(out, "No duration regressions")
+		return
+	}
+	fmt.Fprintf(out, "%-8s %-10s %-10s %s\n", "SLOWER", "LATEST", "MEDIAN", "TEST")
+	for _, r := range regressions {
+		fmt.Fprintf(out, "%-8s %-10s %-10s %s %s\n",
+			fmt.Sprintf("%.1fx", r.Ratio()), formatElapsed(r.Latest), formatElapsed(r.Baseline), r.Package, r.Name)
+	}
+}
+
+func printFailingTests(out io.Writer, stats []*testHistoryStats) {
+	if len(stats) == 0 {
+		fmt.Fprintln(out, "No failures recorded")
+		return
+	}
+	fmt.Fprintf(out, "%-8s %-12s %-6s %s\n", "RATE", "FAILS/RUNS", "FLAKY", "TEST")
+	for _, s := range stats {
+		flaky := ""
+		if s.Flaky() {
+			flaky = "yes"
+		}
+		fmt.Fprintf(out, "%-8s %-12s %-6s %s %s\n",
+			fmt.Sprintf("%.0f%%", s.FailureRate()*100), fmt.Sprintf("%d/%d", s.Fails, s.Passes+s.Fails), flaky, s.Package, s.Name)
+	}
+}
+
+func printLastFailedTests(out io.Writer, stats []*testHistoryStats) {
+	if len(stats) == 0 {
+		fmt.Fprintln(out, "No tests failed in their latest run")
+		return
+	}
+	var tests []failedTest
+	for _, s := range stats {
+		fmt.Fprintf(out, "❌ %s %s (%s ago)\n", s.Package, s.Name, time.Since(s.LastFailed).Round(time.Second))
+		tests = append(tests, failedTest{Package: s.Package, Name: s.Name})
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Rerun with:")
+	for _, group := range groupFailedTests(tests) {
+		fmt.Fprintf(out, "  goshim test -run '%s' %s\n", rerunPattern(group.names), group.pkg)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func historyRunAt(at time.Time, tests ...historyTest) historyRun {
+	return historyRun{Time: at, Tests: tests}
+}
+
+func TestGoShimConfig_recordTestHistory(t *testing.T) {
+	cfg := &GoShimConfig{WorkspaceRoot: t.TempDir()}
+	results := loadSampleResults(t, nil)
+
+	require.NoError(t, cfg.recordTestHistory(results, []string{"test", "./..."}, ""))
+	require.NoError(t, cfg.recordTestHistory(results, []string{"test", "./..."}, ""))
+
+	runs, err := loadTestHistory(cfg.historyFile(), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, runs, 2, "each run should append a line")
+	assert.Equal(t, []string{"./..."}, runs[0].Args)
+	assert.Len(t, runs[0].Tests, 4)
+	assert.Equal(t, historyTest{Package: "example.com/a", Name: "TestBad/sub_one", Result: resultFail}, runs[0].Tests[2])
+
+	runs, err = loadTestHistory(cfg.historyFile(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, runs, "runs before the cutoff should be ignored")
+}
+
+func TestGoShimConfig_recordTestHistory_cached(t *testing.T) {
+	cfg := &GoShimConfig{WorkspaceRoot: t.TempDir()}
+	results := newTestResults()
+	for _, ev := range []testEvent{
+		{Action: "run", Package: "example.com/a", Test: "TestA"},
+		{Action: "pass", Package: "example.com/a", Test: "TestA", Elapsed: 0.2},
+		{Action: "pass", Package: "example.com/a", Elapsed: 0.3},
+		{Action: "run", Package: "example.com/b", Test: "TestB"},
+		{Action: "pass", Package: "example.com/b", Test: "TestB", Elapsed: 4},
+		{Action: "output", Package: "example.com/b", Output: "ok  \texample.com/b\t(cached)\n"},
+		{Action: "pass", Package: "example.com/b", Elapsed: 0},
+	} {
+		results.add(ev)
+	}
+
+	require.NoError(t, cfg.recordTestHistory(results, []string{"test", "./..."}, ""))
+
+	runs, err := loadTestHistory(cfg.historyFile(), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, []historyTest{{Package: "example.com/a", Name: "TestA", Result: resultPass, Elapsed: 0.2}}, runs[0].Tests,
+		"cached packages should not be recorded")
+}
+
+func TestGoShimConfig_recordTestHistory_concurrent(t *testing.T) {
+	cfg := &GoShimConfig{WorkspaceRoot: t.TempDir()}
+	results := loadSampleResults(t, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, cfg.recordTestHistory(results, []string{"test", "./..."}, ""))
+		}()
+	}
+	wg.Wait()
+
+	runs, err := loadTestHistory(cfg.historyFile(), time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, runs, 20, "no concurrent run should be lost")
+
+	leftovers, err := filepath.Glob(filepath.Join(filepath.Dir(cfg.historyFile()), "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers, "temp files should be renamed or removed")
+}
+
+func TestAggregateTestHistory(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	var runs []historyRun
+	for i := 0; i < 5; i++ {
+		slow := 0.1
+		if i == 4 {
+			slow = 0.5 // latest run regressed
+		}
+		flakyResult := resultPass
+		if i%2 == 1 {
+			flakyResult = resultFail
+		}
+		runs = append(runs, historyRunAt(base.Add(time.Duration(i)*time.Minute),
+			historyTest{Package: "p", Name: "TestSlow", Result: resultPass, Elapsed: slow},
+			historyTest{Package: "p", Name: "TestFast", Result: resultPass, Elapsed: 0.01},
+			historyTest{Package: "p", Name: "TestFlaky", Result: flakyResult, Elapsed: 0.02},
+		))
+	}
+	runs = append(runs, historyRunAt(base.Add(10*time.Minute),
+		historyTest{Package: "p", Name: "TestBroken", Result: resultFail},
+	))
+
+	stats := aggregateTestHistory(runs)
+	require.Len(t, stats, 4)
+
+	slowest := slowestTests(stats, 10)
+	assert.Equal(t, "TestSlow", slowest[0].Name)
+	assert.Equal(t, 180*time.Millisecond, meanDuration(recentDurations(slowest[0], 10)))
+
+	regressed := regressedTests(stats, 10)
+	require.Len(t, regressed, 1)
+	assert.Equal(t, "TestSlow", regressed[0].Name)
+	assert.InDelta(t, 5.0, regressed[0].Ratio(), 0.01)
+
+	failing := failingTests(stats)
+	require.Len(t, failing, 2)
+	assert.Equal(t, "TestBroken", failing[0].Name, "highest failure rate first")
+	assert.False(t, failing[0].Flaky())
+	assert.Equal(t, "TestFlaky", failing[1].Name)
+	assert.True(t, failing[1].Flaky())
+	assert.InDelta(t, 0.4, failing[1].FailureRate(), 0.001)
+
+	lastFailed := lastFailedTests(stats)
+	require.Len(t, lastFailed, 1, "TestFlaky passed in its latest run")
+	assert.Equal(t, "TestBroken", lastFailed[0].Name)
+}
+
+func TestMedianDuration(t *testing.T) {
+	tests := []struct {
+		in   []time.Duration
+		want time.Duration
+	}{
+		{nil, 0},
+		{[]time.Duration{3, 1, 2}, 2},
+		{[]time.Duration{4, 1, 3, 2}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.in), func(t *testing.T) {
+			assert.Equal(t, tt.want, medianDuration(tt.in))
+		})
+	}
+}
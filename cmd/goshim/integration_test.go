@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -133,7 +134,7 @@ func TestExample(t *testing.T) {
 			}
 
 			// Special checks for compile-only tests
-			if hasFlag(tt.args, "-c") {
+			if slices.Contains(tt.args, "-c") {
 				// Check that the binary was created
 				var outputFile string
 				for i, arg := range tt.args {
@@ -235,16 +236,6 @@ func TestDebugMe(t *testing.T) {
 	}
 }
 
-// Helper function to check if a slice contains a flag
-func hasFlag(args []string, flag string) bool {
-	for _, arg := range args {
-		if arg == flag {
-			return true
-		}
-	}
-	return false
-}
-
 // Helper function to check if codesign tool is available
 func isCodesignToolAvailable() bool {
 	cmd := exec.Command("go", "tool", "github.com/walteh/ec1/tools/cmd/codesign", "--help")
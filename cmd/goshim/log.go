@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/lmittmann/tint"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// Log formats selected with GOSHIM_LOG_FORMAT or log_format
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// newLogger creates goshim's logger. Diagnostics only ever go to w (stderr)
+// so they never mix with the output of the wrapped go command. -verbose
+// enables debug logs.
+func newLogger(w io.Writer, format string, verbose bool) (*slog.Logger, error) {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+
+	var handler slog.Handler
+	switch format {
+	case "", logFormatText:
+		handler = tint.NewHandler(w, &tint.Options{
+			Level:      level,
+			TimeFormat: "2006-01-02 15:04 05.0000",
+			NoColor:    !isTerminal(w),
+		})
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	default:
+		return nil, fmt.Errorf("unknown log format %q, want %s or %s", format, logFormatText, logFormatJSON)
+	}
+
+	return slog.New(slogctx.NewHandler(handler, nil)), nil
+}
+
+// isTerminal reports whether w is a character device, e.g. an interactive
+// terminal that understands colors
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// commandName returns the goshim command args run, including the
+// subcommand for command groups (e.g. "mod tidy")
+func commandName(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	switch args[0] {
+	case "mod", "work", "tool", "config":
+		if len(args) > 1 {
+			return args[0] + " " + args[1]
+		}
+	}
+	return args[0]
+}
+
+// logCommandDone logs how a command ended and how long it took
+func logCommandDone(ctx context.Context, start time.Time, code int) {
+	slogctx.Debug(ctx, "Command finished", slog.Duration("duration", time.Since(start)), slog.Int("exit_code", code))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, logFormatJSON, false)
+	require.NoError(t, err)
+
+	ctx := slogctx.NewCtx(context.Background(), logger)
+	ctx = slogctx.With(ctx, "command", "mod tidy")
+	slogctx.Debug(ctx, "hidden without -verbose")
+	slogctx.Info(slogctx.With(ctx, "module", "tools"), "Tidied module")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 1, "debug logs need -verbose")
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &entry))
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "mod tidy", entry["command"])
+	assert.Equal(t, "tools", entry["module"])
+
+	buf.Reset()
+	logger, err = newLogger(&buf, logFormatText, true)
+	require.NoError(t, err)
+	ctx = slogctx.With(slogctx.NewCtx(context.Background(), logger), "command", "test")
+	slogctx.Debug(ctx, "Executing go command")
+	assert.Contains(t, buf.String(), "DBG Executing go command command=test")
+	assert.NotContains(t, buf.String(), "\x1b[", "no colors outside a terminal")
+
+	_, err = newLogger(&buf, "xml", false)
+	assert.ErrorContains(t, err, `unknown log format "xml"`)
+}
+
+func TestCommandName(t *testing.T) {
+	tests := map[string][]string{
+		"":          nil,
+		"test":      {"test", "./..."},
+		"mod tidy":  {"mod", "tidy", "-check"},
+		"mod":       {"mod"},
+		"tool list": {"tool", "list"},
+		"build":     {"build", "./cmd/goshim"},
+	}
+	for want, args := range tests {
+		assert.Equal(t, want, commandName(args), args)
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
+
+	slogctx "github.com/veqryn/slog-context"
 )
 
 // Global stdio writers that can be wrapped for logging
@@ -34,12 +38,25 @@ func (a *arrayFlags) Set(value string) error {
 // GoShimConfig holds configuration for the Go wrapper
 type GoShimConfig struct {
 	Verbose           bool
+	LogFormat         string
 	PipeStdioToFile   bool
 	WorkspaceRoot     string
 	GoExecutable      string
 	MaxLines          int
 	ErrorsToSuppress  []string
 	StdoutsToSuppress []string
+	TestFlags         []string
+	Codesign          CodesignDefaults
+	ToolEnv           map[string]string
+
+	sources     map[string]string
+	configFiles []configFile
+
+	stdoutFilter   *filterWriter
+	stderrFilter   *filterWriter
+	stdoutTruncate *truncateWriter
+	stderrTruncate *truncateWriter
+	footer         io.Writer
 }
 
 // NewGoShimConfig creates a new configuration with defaults
@@ -48,6 +65,7 @@ func NewGoShimConfig() *GoShimConfig {
 
 	return &GoShimConfig{
 		Verbose:         false,
+		LogFormat:       logFormatText,
 		PipeStdioToFile: false,
 		WorkspaceRoot:   workspaceRoot,
 		GoExecutable:    "",
@@ -60,41 +78,24 @@ func NewGoShimConfig() *GoShimConfig {
 		StdoutsToSuppress: []string{
 			"invalid string just to have something here",
 		},
+		Codesign: CodesignDefaults{
+			Entitlements: []string{"virtualization"},
+			Identity:     "",
+		},
 	}
 }
 
-// findWorkspaceRoot finds the workspace root by looking for go.work or go.mod files
+// findWorkspaceRoot finds the workspace root of the current directory
 func findWorkspaceRoot() string {
 	currentDir, err := os.Getwd()
 	if err != nil {
 		return "."
 	}
-
-	// Start from current directory and walk up
-	dir := currentDir
-	for {
-		// Check for go.work (workspace root)
-		if _, err := os.Stat(filepath.Join(dir, "go.work")); err == nil {
-			return dir
-		}
-
-		// Check for go.mod as fallback
-		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
-			// Continue looking for go.work, but remember this as potential root
-		}
-
-		// Move up one directory
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			// Reached filesystem root, fallback to current directory
-			return currentDir
-		}
-		dir = parent
-	}
+	return workspaceRootFrom(currentDir, os.Getenv("GOWORK"))
 }
 
 // setupStdioLogging wraps global stdio to pipe to log file
-func (cfg *GoShimConfig) setupStdioLogging(command string, args []string) error {
+func (cfg *GoShimConfig) setupStdioLogging(ctx context.Context, command string, args []string) error {
 	logDir := filepath.Join(cfg.WorkspaceRoot, ".log", "goshim")
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return fmt.Errorf("failed to create log directory: %w", err)
@@ -127,9 +128,7 @@ func (cfg *GoShimConfig) setupStdioLogging(command string, args []string) error
 	stderr = io.MultiWriter(stderr, file)
 	stdin = io.TeeReader(stdin, file) // Also capture stdin input to log
 
-	if cfg.Verbose {
-		fmt.Printf("📝 Piping stdio to: %s\n", logFile)
-	}
+	slogctx.Debug(ctx, "Piping stdio to file", slog.String("file", logFile))
 
 	return nil
 }
@@ -156,7 +155,7 @@ func (cfg *GoShimConfig) findSafeGo() (string, error) {
 
 	executable, err := os.Executable()
 	if err != nil {
-		fmt.Printf("error getting executable: %s\n", err)
+		slog.Warn("Failed to get executable", slogctx.Err(err))
 	}
 
 	// if i am a symlink, read the link
@@ -189,9 +188,7 @@ func (cfg *GoShimConfig) execSafeGo(ctx context.Context, args ...string) error {
 		return err
 	}
 
-	if cfg.Verbose {
-		fmt.Printf("executing go command: %s %v\n", goPath, args)
-	}
+	slogctx.Debug(ctx, "Executing go command", slog.String("go", goPath), slog.Any("args", args))
 
 	cmd := exec.CommandContext(ctx, goPath, args...)
 	cmd.Env = os.Environ()
@@ -199,15 +196,14 @@ func (cfg *GoShimConfig) execSafeGo(ctx context.Context, args ...string) error {
 	cmd.Stderr = stderr
 	cmd.Stdin = stdin
 
-	return cmd.Run()
+	return runCommand(cmd)
 }
 
 // replaceProcess replaces the current process with the go command (for true pass-through)
-func (cfg *GoShimConfig) replaceProcess(args ...string) error {
+func (cfg *GoShimConfig) replaceProcess(ctx context.Context, args ...string) error {
 	// If stdio piping is enabled, we can't use process replacement
 	// because we need to control stdio, so fall back to execSafeGo
 	if cfg.PipeStdioToFile {
-		ctx := context.Background()
 		return cfg.execSafeGo(ctx, args...)
 	}
 
@@ -216,113 +212,50 @@ func (cfg *GoShimConfig) replaceProcess(args ...string) error {
 		return err
 	}
 
-	if cfg.Verbose {
-		fmt.Printf("replacing process with go command: %s %v\n", goPath, args)
-	}
+	slogctx.Debug(ctx, "Replacing process with go command", slog.String("go", goPath), slog.Any("args", args))
 
 	// Use syscall.Exec to replace the current process completely
 	allArgs := append([]string{goPath}, args...)
 	return syscall.Exec(goPath, allArgs, os.Environ())
 }
 
-// handleMod processes mod commands with embedded task functionality
-func (cfg *GoShimConfig) handleMod(args []string) error {
+// isGoshimCommand reports whether args run one of goshim's own commands
+// rather than passing through to the go command
+func isGoshimCommand(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	switch args[0] {
+	case "test", "retab", "tool", "dap", "test-history", "config", "goshim-help", "--goshim-help":
+		return true
+	case "mod":
+		return len(args) > 1 && (args[1] == "tidy" || args[1] == "upgrade" || args[1] == "align")
+	case "work":
+		return len(args) > 1 && (args[1] == "discover" || args[1] == "link" || args[1] == "unlink")
+	}
+	return false
+}
+
+// handleMod processes mod commands across the workspace modules
+func (cfg *GoShimConfig) handleMod(ctx context.Context, args []string) error {
 	if len(args) < 2 {
 		return fmt.Errorf("mod subcommand required")
 	}
 
 	switch args[1] {
 	case "tidy":
-		return cfg.runEmbeddedModTidy()
+		return cfg.runModTidy(ctx, args[2:])
 	case "upgrade":
-		return cfg.runEmbeddedModUpgrade()
+		return cfg.runModUpgrade(ctx, args[2:])
+	case "align":
+		return cfg.runModAlign(ctx, args[2:])
 	default:
 		return fmt.Errorf("unknown mod subcommand: %s", args[1])
 	}
 }
 
-// runEmbeddedModTidy runs go mod tidy across all workspace modules
-func (cfg *GoShimConfig) runEmbeddedModTidy() error {
-	ctx := context.Background()
-
-	if cfg.Verbose {
-		fmt.Println("🧹 Running optimized mod tidy via task system...")
-	}
-
-	// Use the project's task tool to run go-mod-tidy
-	goPath, err := cfg.findSafeGo()
-	if err != nil {
-		return fmt.Errorf("could not find go executable: %w", err)
-	}
-
-	cmd := exec.CommandContext(ctx, goPath, "tool", "github.com/go-task/task/v3/cmd/task", "go-mod-tidy")
-	cmd.Dir = cfg.WorkspaceRoot
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-
-	return cmd.Run()
-}
-
-// runEmbeddedModUpgrade runs go-mod-upgrade and then tidy
-func (cfg *GoShimConfig) runEmbeddedModUpgrade() error {
-	ctx := context.Background()
-
-	if cfg.Verbose {
-		fmt.Println("⬆️  Running optimized mod upgrade via task system...")
-	}
-
-	// Use the project's task tool to run go-mod-upgrade
-	goPath, err := cfg.findSafeGo()
-	if err != nil {
-		return fmt.Errorf("could not find go executable: %w", err)
-	}
-
-	cmd := exec.CommandContext(ctx, goPath, "tool", "github.com/go-task/task/v3/cmd/task", "go-mod-upgrade")
-	cmd.Dir = cfg.WorkspaceRoot
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-
-	return cmd.Run()
-}
-
-// parseWorkspaceModules extracts module paths from go.work content
-func parseWorkspaceModules(content string) []string {
-	modules := make([]string, 0)
-	lines := strings.Split(content, "\n")
-	inUseBlock := false
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		if line == "use (" {
-			inUseBlock = true
-			continue
-		}
-		if line == ")" && inUseBlock {
-			inUseBlock = false
-			continue
-		}
-
-		if inUseBlock && line != "" && !strings.HasPrefix(line, "//") {
-			// Handle inline comments by splitting on //
-			parts := strings.Split(line, "//")
-			module := strings.TrimSpace(parts[0])
-
-			// Clean up the module path (remove quotes, whitespace, etc.)
-			module = strings.Trim(module, "\t \"")
-			if module != "" {
-				modules = append(modules, module)
-			}
-		}
-	}
-
-	return modules
-}
-
 // handleRetab processes retab commands
-func (cfg *GoShimConfig) handleRetab() error {
-	ctx := context.Background()
-
+func (cfg *GoShimConfig) handleRetab(ctx context.Context) error {
 	// Read .editorconfig
 	editorConfigPath := filepath.Join(cfg.WorkspaceRoot, ".editorconfig")
 	editorConfig, err := os.ReadFile(editorConfigPath)
@@ -332,7 +265,6 @@ func (cfg *GoShimConfig) handleRetab() error {
 
 	// Run retab tool with fmt subcommand
 	retabArgs := []string{
-		"tool", "github.com/walteh/retab/v2/cmd/retab",
 		"fmt", // Add the fmt subcommand
 		"--stdin", "--stdout",
 		"--editorconfig-content=" + string(editorConfig),
@@ -340,21 +272,45 @@ func (cfg *GoShimConfig) handleRetab() error {
 		"-",              // Dummy filename for stdin processing
 	}
 
-	return cfg.execSafeGo(ctx, retabArgs...)
+	return cfg.runTool(ctx, "github.com/walteh/retab/v2/cmd/retab", retabArgs...)
 }
 
 // handleTool processes tool commands
-func (cfg *GoShimConfig) handleTool(args []string) error {
-	ctx := context.Background()
+func (cfg *GoShimConfig) handleTool(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		switch args[1] {
+		case "list":
+			return cfg.runToolList(args[2:])
+		case "add":
+			return cfg.runToolAdd(ctx, args[2:])
+		case "remove":
+			return cfg.runToolRemove(ctx, args[2:])
+		case "cache":
+			return cfg.handleToolCache(args[2:])
+		}
+	}
 
 	// Set HL_CONFIG environment variable
 	if hlConfig := filepath.Join(cfg.WorkspaceRoot, "hl-config.yaml"); fileExists(hlConfig) {
 		os.Setenv("HL_CONFIG", hlConfig)
 	}
 
-	// Run the tool command
-	toolArgs := append([]string{"tool"}, args[1:]...)
-	return cfg.execSafeGo(ctx, toolArgs...)
+	// Apply configured tool environment, expanding references to the current env
+	for key, value := range cfg.ToolEnv {
+		os.Setenv(key, os.ExpandEnv(value))
+	}
+
+	// Without a tool (or with go tool flags) there is nothing to resolve
+	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		return cfg.execSafeGo(ctx, append([]string{"tool"}, args[1:]...)...)
+	}
+
+	// Run the tool, expanding a short tool name to its package path
+	name, err := cfg.resolveToolArg(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	return cfg.runTool(ctx, name, args[2:]...)
 }
 
 // fileExists checks if a file exists
@@ -371,17 +327,43 @@ func printUsage() {
 	fmt.Println("  goshim [any-go-command]         True pass-through to go command")
 	fmt.Println()
 	fmt.Println("Enhanced commands:")
-	fmt.Println("  goshim test [flags] [target]    Enhanced test runner with project gotestsum")
-	fmt.Println("  goshim mod tidy                 Optimized mod tidy via project task system")
-	fmt.Println("  goshim mod upgrade              Optimized mod upgrade via project task system")
-	fmt.Println("  goshim tool [args...]           go tool with error suppression")
+	fmt.Println("  goshim test [flags] [target]    Enhanced test runner with per-package summary")
+	fmt.Println("  goshim test merge-reports       Merge -shard reports (-o merged.json, -junit merged.xml)")
+	fmt.Println("  goshim mod tidy [-check]        Tidy all workspace modules in parallel (-jobs n)")
+	fmt.Println("  goshim mod upgrade [flags]      Plan and apply dependency upgrades, then tidy")
+	fmt.Println("                                  -patch, -minor, -include/-exclude <glob>, -dry-run, -jobs n")
+	fmt.Println("  goshim mod align [-fix|-check]  Report dependencies required at different versions across modules")
+	fmt.Println("  goshim work discover [-dry-run] Add every go.mod beneath the root to go.work")
+	fmt.Println("  goshim work link <mod> <dir>    Replace a module with a local checkout")
+	fmt.Println("  goshim work unlink <mod>        Drop the local replace of a module")
+	fmt.Println("  goshim tool <name> [args...]    go tool with output suppression, resolving short tool names")
+	fmt.Println("  goshim tool list                Tool directives of all workspace modules with versions")
+	fmt.Println("  goshim tool add <pkg>[@v]       Add a tool to the right module (-module to choose)")
+	fmt.Println("  goshim tool remove <tool>       Remove a tool directive by path or short name")
+	fmt.Println("  goshim tool cache list|clean    Prebuilt tool binaries (GOSHIM_TOOL_CACHE, off disables)")
 	fmt.Println("  goshim retab                    Format code with retab tool")
 	fmt.Println("  goshim dap [args...]            Run delve in DAP mode")
+	fmt.Println("  goshim test-history [view]      Slowest, regressed, failures or last-failed tests from past runs")
+	fmt.Println("  goshim config show              Print the effective config and where each value came from")
 	fmt.Println()
 	fmt.Println("Test-specific flags:")
-	fmt.Println("  -function-coverage           Enable function coverage reporting")
+	fmt.Println("  -function-coverage           Print per-package and per-function coverage tables")
+	fmt.Println("  -min-coverage [glob=]<pct>   Fail below a total or per-package coverage (repeatable)")
+	fmt.Println("  -keep-coverprofile           Keep the coverage profile and print its path")
+	fmt.Println("  -coverage-diff <ref>         Report coverage of lines changed since a git ref")
+	fmt.Println("  -coverage-diff-min <pct>     Fail when changed line coverage is below pct")
 	fmt.Println("  -force                       Force re-running of tests")
 	fmt.Println("  -ide                         IDE mode: raw test output (VS Code compatible)")
+	fmt.Println("  -workspace                   Test every go.work module and merge the results")
+	fmt.Println("  -workspace-jobs <n>          Modules tested in parallel with -workspace (default 1)")
+	fmt.Println("  -changed[=ref]               Only test packages affected by git changes (default ref HEAD)")
+	fmt.Println("  -watch                       Rerun the tests affected by every change until interrupted")
+	fmt.Println("  -shard i/n                   Run shard i of n, balanced by test history, with its own report")
+	fmt.Println("  -shard-by package|test       Shard packages (default) or top-level tests")
+	fmt.Println("  -rerun-fails[=N]             Rerun failed tests up to N times (default 2), report flakes")
+	fmt.Println("  -rerun-fails-fatal-flakes    Fail the run when a test only passed on rerun")
+	fmt.Println("  -junit <file>                Write a JUnit XML report")
+	fmt.Println("  -report-json <file>          Write a JSON summary report")
 	fmt.Println("  -codesign                    Enable macOS code signing for virtualization")
 	fmt.Println("  -codesign-entitlement <ent>  Add Apple entitlement (can be repeated)")
 	fmt.Println("                               Common: virtualization, hypervisor, network-client")
@@ -389,35 +371,57 @@ func printUsage() {
 	fmt.Println("  -codesign-force              Force re-signing even if already signed")
 	fmt.Println("  -v                           Verbose output")
 	fmt.Println("  -run pattern                 Run only tests matching pattern")
-	fmt.Println("  -target dir                  Target directory (default: .)")
+	fmt.Println("  -target dir|file:line        Package directory to test when no packages are given")
 	fmt.Println()
 	fmt.Println("Global flags:")
-	fmt.Println("  -verbose                     Verbose goshim output")
+	fmt.Println("  -verbose                     Debug logs on stderr (GOSHIM_LOG_FORMAT=json for JSON)")
 	fmt.Println("  -pipe-stdio-to-file          Pipe all stdio to timestamped log file (./.log/goshim/)")
+	fmt.Println("  -max-lines <n>               Keep first/last n/2 lines per stream, spill the rest (0 disables)")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  goshim test -codesign ./pkg/vmnet                          # Basic signing with virtualization")
 	fmt.Println("  goshim test -codesign-entitlement hypervisor ./pkg/host    # Custom entitlement")
 	fmt.Println("  goshim test -codesign -function-coverage -v ./...          # Full enhanced testing")
+	fmt.Println("  goshim test ./pkg/foo/foo_test.go:42                       # Test (or table case) at a line")
+	fmt.Println("  goshim test -junit report.xml ./...                        # CI test report")
+	fmt.Println("  goshim test -coverage-diff=main -coverage-diff-min 80 ./...  # PR coverage gate")
+	fmt.Println("  goshim test -shard=2/4 -junit report.xml ./...             # CI runner 2 of 4")
 	fmt.Println("  goshim -pipe-stdio-to-file build ./cmd/myapp               # Build with stdio logging")
 	fmt.Println()
+	fmt.Println("Configuration is layered: defaults < user config < .goshim.yaml/.goshim.json in the")
+	fmt.Println("workspace root < GOSHIM_* environment variables < flags.")
+	fmt.Println()
 	fmt.Println("All other commands are passed through to the real go binary with zero overhead.")
-	fmt.Println("Enhanced commands use project tools (gotestsum, task) for optimal performance.")
+	fmt.Println("Enhanced commands run the real go binary with goshim's additions on top.")
 }
 
 func main() {
+	start := time.Now()
 	cfg := NewGoShimConfig()
 
 	args := os.Args[1:]
 
-	// Parse global flags
+	// Parse global flags; they are applied after config files and env so
+	// they take precedence over both
+	var verboseFlag, pipeStdioFlag bool
+	var maxLinesFlag *int
 	var filteredArgs []string
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 		if arg == "-verbose" || arg == "--verbose" {
-			cfg.Verbose = true
+			verboseFlag = true
 		} else if arg == "-pipe-stdio-to-file" || arg == "--pipe-stdio-to-file" {
-			cfg.PipeStdioToFile = true
+			pipeStdioFlag = true
+		} else if (arg == "-max-lines" || arg == "--max-lines") && i+1 < len(args) {
+			if n, err := strconv.Atoi(args[i+1]); err == nil {
+				maxLinesFlag = &n
+			}
+			i++ // Skip the max lines value
+		} else if strings.HasPrefix(arg, "-max-lines=") || strings.HasPrefix(arg, "--max-lines=") {
+			_, value, _ := strings.Cut(arg, "=")
+			if n, err := strconv.Atoi(value); err == nil {
+				maxLinesFlag = &n
+			}
 		} else {
 			filteredArgs = append(filteredArgs, arg)
 		}
@@ -425,10 +429,57 @@ func main() {
 
 	args = filteredArgs
 
+	// A broken config fails goshim's own commands, but must not break plain
+	// go commands: those warn and run with the defaults
+	configErr := cfg.loadConfig()
+	if configErr != nil {
+		if isGoshimCommand(args) {
+			fmt.Fprintf(os.Stderr, "Error loading goshim config: %v\n", configErr)
+			os.Exit(1)
+		}
+		cfg = NewGoShimConfig()
+	}
+
+	if verboseFlag {
+		cfg.Verbose = true
+		cfg.setSource("verbose", sourceFlag)
+	}
+	if pipeStdioFlag {
+		cfg.PipeStdioToFile = true
+		cfg.setSource("pipe_stdio_to_file", sourceFlag)
+	}
+	if maxLinesFlag != nil {
+		cfg.MaxLines = *maxLinesFlag
+		cfg.setSource("max_lines", sourceFlag)
+	}
+
+	logger, err := newLogger(stderr, cfg.LogFormat, cfg.Verbose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting up logging: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+	ctx := slogctx.NewCtx(context.Background(), logger)
+	ctx = slogctx.With(ctx, "command", commandName(args))
+	if configErr != nil {
+		slogctx.Warn(ctx, "Ignoring goshim config, using defaults", slogctx.Err(configErr))
+	}
+
+	// Suppression and truncation only apply to wrapped commands whose output
+	// is meant for humans; retab and dap stream data that must not be altered.
+	// They are set up before stdio logging so the log keeps every line.
+	if len(args) > 0 {
+		switch args[0] {
+		case "test", "mod", "tool":
+			cfg.setupOutputTruncation()
+			cfg.setupOutputFilters()
+		}
+	}
+
 	// Setup stdio logging if requested
 	if cfg.PipeStdioToFile && len(args) > 0 {
-		if err := cfg.setupStdioLogging("goshim", args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error setting up stdio logging: %v\n", err)
+		if err := cfg.setupStdioLogging(ctx, "goshim", args); err != nil {
+			slogctx.Error(ctx, "Setting up stdio logging failed", slogctx.Err(err))
 			os.Exit(1)
 		}
 	}
@@ -438,44 +489,78 @@ func main() {
 		return
 	}
 
+	exit := func(code int) {
+		logCommandDone(ctx, start, code)
+		cfg.closeOutput()
+		os.Exit(code)
+	}
+	fail := func(msg string, err error) {
+		// a failing command (e.g. go test) has reported why on its own
+		// output, only goshim's own failures are worth an error line
+		if isCommandExit(err) {
+			slogctx.Debug(ctx, msg, slogctx.Err(err))
+		} else {
+			slogctx.Error(ctx, msg, slogctx.Err(err))
+		}
+		exit(exitCode(err))
+	}
+	defer cfg.closeOutput()
+	defer logCommandDone(ctx, start, 0)
+
 	// Handle special commands that need enhanced functionality
 	switch args[0] {
 	case "test":
-		if err := cfg.handleTest(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error running tests: %v\n", err)
-			os.Exit(1)
+		if err := cfg.handleTest(ctx, args); err != nil {
+			fail("Running tests failed", err)
 		}
 
 	case "mod":
-		if len(args) > 1 && (args[1] == "tidy" || args[1] == "upgrade") {
-			if err := cfg.handleMod(args); err != nil {
-				fmt.Fprintf(os.Stderr, "Error with mod command: %v\n", err)
-				os.Exit(1)
+		if isGoshimCommand(args) {
+			if err := cfg.handleMod(ctx, args); err != nil {
+				fail("Mod command failed", err)
 			}
 		} else {
 			// Regular mod commands - pass through
-			if err := cfg.replaceProcess(args...); err != nil {
-				fmt.Fprintf(os.Stderr, "Error running go: %v\n", err)
-				os.Exit(1)
+			if err := cfg.replaceProcess(ctx, args...); err != nil {
+				fail("Running go failed", err)
+			}
+		}
+
+	case "work":
+		if isGoshimCommand(args) {
+			if err := cfg.handleWork(ctx, args); err != nil {
+				fail("Work command failed", err)
+			}
+		} else {
+			// Regular work commands - pass through
+			if err := cfg.replaceProcess(ctx, args...); err != nil {
+				fail("Running go failed", err)
 			}
 		}
 
 	case "retab":
-		if err := cfg.handleRetab(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error with retab: %v\n", err)
-			os.Exit(1)
+		if err := cfg.handleRetab(ctx); err != nil {
+			fail("Retab failed", err)
 		}
 
 	case "tool":
-		if err := cfg.handleTool(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error with tool: %v\n", err)
-			os.Exit(1)
+		if err := cfg.handleTool(ctx, args); err != nil {
+			fail("Tool failed", err)
 		}
 
 	case "dap":
-		if err := cfg.handleDap(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error with dap: %v\n", err)
-			os.Exit(1)
+		if err := cfg.handleDap(ctx, args); err != nil {
+			fail("Dap failed", err)
+		}
+
+	case "test-history":
+		if err := cfg.handleTestHistory(args); err != nil {
+			fail("Test history failed", err)
+		}
+
+	case "config":
+		if err := cfg.handleConfig(args); err != nil {
+			fail("Config failed", err)
 		}
 
 	case "goshim-help", "--goshim-help":
@@ -483,9 +568,8 @@ func main() {
 
 	default:
 		// Default: pass through to go command by replacing the process
-		if err := cfg.replaceProcess(args...); err != nil {
-			fmt.Fprintf(os.Stderr, "Error running go: %v\n", err)
-			os.Exit(1)
+		if err := cfg.replaceProcess(ctx, args...); err != nil {
+			fail("Running go failed", err)
 		}
 	}
 }
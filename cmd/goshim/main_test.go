@@ -66,22 +66,6 @@ func TestGoShimConfig_findSafeGo(t *testing.T) {
 	}
 }
 
-func TestGoShimConfig_hasGotestsum(t *testing.T) {
-	cfg := NewGoShimConfig()
-
-	// This test depends on environment, but we can at least test the logic
-	hasIt := cfg.hasGotestsum()
-	t.Logf("hasGotestsum: %v", hasIt)
-
-	// If we have gotestsum, verify it works
-	if hasIt {
-		cmd := exec.Command("gotestsum", "--version")
-		if err := cmd.Run(); err != nil {
-			t.Errorf("gotestsum available but doesn't work: %v", err)
-		}
-	}
-}
-
 func TestGoShimConfig_execSafeGo(t *testing.T) {
 	cfg := NewGoShimConfig()
 	ctx := context.Background()
@@ -152,7 +136,7 @@ func TestExample(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := cfg.handleTest(tt.args)
+			err := cfg.handleTest(t.Context(), tt.args)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("handleTest() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -204,7 +188,7 @@ func TestGoShimConfig_handleMod(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := cfg.handleMod(tt.args)
+			err := cfg.handleMod(t.Context(), tt.args)
 			if !tt.allowFail && (err != nil) != tt.wantErr {
 				t.Errorf("handleMod() error = %v, wantErr %v", err, tt.wantErr)
 			} else if tt.allowFail && err != nil {
@@ -243,6 +227,34 @@ use (
 `,
 			expected: []string{".", "./tools"},
 		},
+		{
+			name: "single-line use directives",
+			content: `go 1.24
+
+use .
+use ./tools
+`,
+			expected: []string{".", "./tools"},
+		},
+		{
+			name: "toolchain, godebug and replace",
+			content: `go 1.24
+
+toolchain go1.24.3
+
+godebug default=go1.21
+
+use ./tools
+
+replace (
+	example.com/a => ./a
+	example.com/b v1.0.0 => example.com/c v1.1.0
+)
+
+use "./quoted path"
+`,
+			expected: []string{"./tools", "./quoted path"},
+		},
 		{
 			name:     "empty workspace",
 			content:  "go 1.24\n",
@@ -268,6 +280,26 @@ use (
 	}
 }
 
+func TestIsGoshimCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"test", "./..."}, true},
+		{[]string{"mod", "tidy"}, true},
+		{[]string{"mod", "download"}, false},
+		{[]string{"work", "link", "example.com/x", "../x"}, true},
+		{[]string{"work", "sync"}, false},
+		{[]string{"tool", "gotestsum"}, true},
+		{[]string{"config"}, true},
+		{[]string{"build", "./..."}, false},
+		{[]string{"version"}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isGoshimCommand(tt.args), "%q", tt.args)
+	}
+}
+
 func TestNewGoShimConfig(t *testing.T) {
 	cfg := NewGoShimConfig()
 
@@ -416,7 +448,7 @@ func TestGoShimConfig_createStdioLogFile(t *testing.T) {
 	cfg.WorkspaceRoot = tmpDir
 
 	// Test creating log file
-	err := cfg.setupStdioLogging("go", []string{"version"})
+	err := cfg.setupStdioLogging(t.Context(), "go", []string{"version"})
 	if err != nil {
 		t.Fatalf("setupStdioLogging() failed: %v", err)
 	}
@@ -489,7 +521,7 @@ func TestGoShimConfig_PipeStdioToFile(t *testing.T) {
 	ctx := context.Background()
 
 	// Set up stdio logging first
-	err := cfg.setupStdioLogging("go", []string{"version"})
+	err := cfg.setupStdioLogging(t.Context(), "go", []string{"version"})
 	if err != nil {
 		t.Fatalf("setupStdioLogging() failed: %v", err)
 	}
@@ -567,25 +599,7 @@ func TestGoShimConfig_handleTestRunPatternFix(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Test the pattern transformation logic directly
-			result := tt.inputPattern
-
-			// Apply the same logic as in handleTest
-			if strings.Contains(result, "/") {
-				parts := strings.SplitN(result, "/", 2)
-				if len(parts) == 2 {
-					testFunc := parts[0]
-					subtest := parts[1]
-
-					// Remove leading ^ if present
-					if strings.HasPrefix(testFunc, "^") {
-						testFunc = testFunc[1:]
-					}
-
-					// Create the fixed pattern
-					result = "^" + testFunc + "$/" + subtest
-				}
-			}
+			result, _ := rewriteTestPattern(tt.inputPattern)
 
 			assert.Equal(t, tt.expected, result, "Pattern transformation should match expected result")
 		})
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// skewRequirement is one module's requirement on a skewed dependency
+type skewRequirement struct {
+	Dir      string
+	Version  string
+	Indirect bool
+}
+
+// versionSkew is a dependency required at different versions by workspace
+// modules
+type versionSkew struct {
+	Path         string
+	Highest      string
+	Requirements []skewRequirement // sorted by version, then module
+}
+
+// findVersionSkew returns the dependencies required at more than one version
+// across modules. Requirements on workspace modules themselves are ignored,
+// their versions are placeholders resolved by the workspace.
+func findVersionSkew(modules []workspaceModule) []versionSkew {
+	workspacePaths := map[string]bool{}
+	for _, m := range modules {
+		workspacePaths[m.Path] = true
+	}
+
+	byPath := map[string][]skewRequirement{}
+	for _, m := range modules {
+		for _, req := range m.Requires {
+			if workspacePaths[req.Mod.Path] {
+				continue
+			}
+			byPath[req.Mod.Path] = append(byPath[req.Mod.Path], skewRequirement{Dir: m.Dir, Version: req.Mod.Version, Indirect: req.Indirect})
+		}
+	}
+
+	var skews []versionSkew
+	for path, reqs := range byPath {
+		skew := versionSkew{Path: path, Requirements: reqs}
+		versions := map[string]bool{}
+		for _, r := range reqs {
+			versions[r.Version] = true
+			if skew.Highest == "" || semver.Compare(r.Version, skew.Highest) > 0 {
+				skew.Highest = r.Version
+			}
+		}
+		if len(versions) < 2 {
+			continue
+		}
+		sort.Slice(skew.Requirements, func(i, j int) bool {
+			if c := semver.Compare(skew.Requirements[i].Version, skew.Requirements[j].Version); c != 0 {
+				return c < 0
+			}
+			return skew.Requirements[i].Dir < skew.Requirements[j].Dir
+		})
+		skews = append(skews, skew)
+	}
+
+	sort.Slice(skews, func(i, j int) bool { return skews[i].Path < skews[j].Path })
+	return skews
+}
+
+// printVersionSkew lists every skewed dependency with the version each
+// module requires
+func (cfg *GoShimConfig) printVersionSkew(out io.Writer, skews []versionSkew) {
+	if len(skews) == 0 {
+		fmt.Fprintln(out, "🔗 No dependency version skew across workspace modules")
+		return
+	}
+
+	fmt.Fprintln(out, "================================================")
+	fmt.Fprintln(out, "Dependency Version Skew")
+	fmt.Fprintln(out, "------------------------------------------------")
+	for _, skew := range skews {
+		fmt.Fprintf(out, "%s (highest %s)\n", skew.Path, skew.Highest)
+		width := 0
+		for _, r := range skew.Requirements {
+			width = max(width, len(r.Version))
+		}
+		for _, r := range skew.Requirements {
+			line := fmt.Sprintf("  %-*s  %s", width, r.Version, cfg.relativeToWorkspace(r.Dir))
+			if r.Indirect {
+				line += " (indirect)"
+			}
+			fmt.Fprintln(out, line)
+		}
+	}
+	fmt.Fprintln(out, "================================================")
+}
+
+// alignModule raises the skewed requirements of dir to their highest version
+func (cfg *GoShimConfig) alignModule(ctx context.Context, dir string, skews []versionSkew, out io.Writer) modResult {
+	var targets []string
+	for _, skew := range skews {
+		for _, r := range skew.Requirements {
+			if r.Dir == dir && r.Version != skew.Highest {
+				targets = append(targets, skew.Path+"@"+skew.Highest)
+			}
+		}
+	}
+	return cfg.getAndTidy(ctx, dir, targets, out)
+}
+
+// runModAlign reports dependencies required at different versions across
+// the workspace modules. -fix raises them to the highest version and -check
+// fails when there is any skew.
+func (cfg *GoShimConfig) runModAlign(ctx context.Context, args []string) error {
+	var jobs int
+	fs := newModFlagSet("align", &jobs)
+	fix := fs.Bool("fix", false, "raise skewed requirements to their highest version")
+	check := fs.Bool("check", false, "fail if any requirement is skewed")
+	if err := parseModFlags(fs, args); err != nil {
+		return err
+	}
+	if *fix && *check {
+		return fmt.Errorf("-fix and -check cannot be combined")
+	}
+
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return err
+	}
+
+	skews := findVersionSkew(ws.Modules)
+	cfg.printVersionSkew(stdout, skews)
+	if len(skews) == 0 {
+		return nil
+	}
+
+	if *check {
+		var paths []string
+		for _, skew := range skews {
+			paths = append(paths, skew.Path)
+		}
+		return fmt.Errorf("%d %s required at divergent versions: %s",
+			len(skews), pluralize(len(skews), "dependency", "dependencies"), strings.Join(paths, ", "))
+	}
+	if !*fix {
+		fmt.Fprintln(stdout, "🔗 Run goshim mod align -fix to raise them to the highest version")
+		return nil
+	}
+
+	results := cfg.forEachModule(ctx, ws.Dirs(), jobs, func(ctx context.Context, dir string, out io.Writer) modResult {
+		return cfg.alignModule(ctx, dir, skews, out)
+	})
+
+	var failed, changed []string
+	for _, r := range results {
+		name := cfg.relativeToWorkspace(r.Dir)
+		if r.Err != nil {
+			failed = append(failed, name)
+			fmt.Fprintf(stdout, "  ❌ %s: %v\n", name, r.Err)
+		} else if len(r.Changed) > 0 {
+			changed = append(changed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("mod align failed in %s", strings.Join(failed, ", "))
+	}
+	fmt.Fprintf(stdout, "🔗 Aligned %d %s in %d %s\n",
+		len(skews), pluralize(len(skews), "dependency", "dependencies"), len(changed), pluralize(len(changed), "module", "modules"))
+	return nil
+}
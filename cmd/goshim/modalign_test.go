@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func TestFindVersionSkew(t *testing.T) {
+	req := func(path, version string, indirect bool) *modfile.Require {
+		return &modfile.Require{Mod: module.Version{Path: path, Version: version}, Indirect: indirect}
+	}
+	modules := []workspaceModule{
+		{Dir: "/ws", Path: "example.com/ws", Requires: []*modfile.Require{
+			req("example.com/lib", "v1.2.0", false),
+			req("example.com/same", "v1.0.0", false),
+			req("example.com/ws/tools", "v0.0.0", false),
+		}},
+		{Dir: "/ws/tools", Path: "example.com/ws/tools", Requires: []*modfile.Require{
+			req("example.com/lib", "v1.10.0", true),
+			req("example.com/same", "v1.0.0", false),
+			req("example.com/ws", "v0.1.0", false),
+		}},
+	}
+
+	skews := findVersionSkew(modules)
+
+	require.Len(t, skews, 1, "equal versions and workspace modules are not skew")
+	assert.Equal(t, versionSkew{
+		Path:    "example.com/lib",
+		Highest: "v1.10.0",
+		Requirements: []skewRequirement{
+			{Dir: "/ws", Version: "v1.2.0"},
+			{Dir: "/ws/tools", Version: "v1.10.0", Indirect: true},
+		},
+	}, skews[0], "versions compare as semver, not strings")
+}
+
+func TestGoShimConfig_runModAlign(t *testing.T) {
+	proxy := t.TempDir()
+	writeProxyModule(t, proxy, "example.com/lib", "v1.0.0", "v1.1.0")
+
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(proxy))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOFLAGS", "-modcacherw")
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GOTOOLCHAIN", "local")
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.work":  "go 1.24\n\nuse (\n\t./a\n\t./b\n)\n",
+		"a/go.mod": "module example.com/a\n\ngo 1.24\n\nrequire example.com/lib v1.0.0\n",
+		"a/a.go":   "package a\n\nimport _ \"example.com/lib\"\n",
+		"b/go.mod": "module example.com/b\n\ngo 1.24\n\nrequire example.com/lib v1.1.0\n",
+		"b/b.go":   "package b\n\nimport _ \"example.com/lib\"\n",
+	})
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+	require.NoError(t, cfg.runModTidy(t.Context(), nil))
+
+	err := cfg.runModAlign(t.Context(), []string{"-check"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 dependency required at divergent versions: example.com/lib")
+
+	require.NoError(t, cfg.runModAlign(t.Context(), nil), "reporting skew without -check succeeds")
+	require.NoError(t, cfg.runModAlign(t.Context(), []string{"-fix"}))
+
+	data, err := os.ReadFile(filepath.Join(root, "a", "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "example.com/lib v1.1.0")
+	assert.NoError(t, cfg.runModAlign(t.Context(), []string{"-check"}))
+
+	assert.Error(t, cfg.runModAlign(t.Context(), []string{"-fix", "-check"}))
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// defaultModJobs bounds how many modules are processed at once; go mod
+// commands are mostly network and disk bound
+const defaultModJobs = 4
+
+// jobsFlag is a -jobs value, which must be at least one
+type jobsFlag int
+
+func (j *jobsFlag) String() string {
+	return strconv.Itoa(int(*j))
+}
+
+func (j *jobsFlag) Set(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("must be a number of modules, at least 1")
+	}
+	*j = jobsFlag(n)
+	return nil
+}
+
+// newModFlagSet returns the flag set of goshim mod <name> with the -jobs
+// flag every mod subcommand takes bound to jobs
+func newModFlagSet(name string, jobs *int) *flag.FlagSet {
+	fs := flag.NewFlagSet("mod "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	*jobs = defaultModJobs
+	fs.Var((*jobsFlag)(jobs), "jobs", "number of modules to process at once")
+	return fs
+}
+
+// parseModFlags parses the arguments of a mod subcommand, none of which
+// take positional arguments
+func parseModFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected %s argument: %s", fs.Name(), fs.Arg(0))
+	}
+	return nil
+}
+
+// prefixWriter prefixes every line written to it, e.g. with a module name.
+// Writers sharing a mutex never interleave within a line.
+type prefixWriter struct {
+	mu      *sync.Mutex
+	out     io.Writer
+	prefix  string
+	partial []byte
+}
+
+func newPrefixWriter(mu *sync.Mutex, out io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{mu: mu, out: out, prefix: prefix}
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.partial = append(pw.partial, p...)
+	for {
+		idx := bytes.IndexByte(pw.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		pw.writeLine(pw.partial[:idx+1])
+		pw.partial = pw.partial[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (pw *prefixWriter) writeLine(line []byte) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	io.WriteString(pw.out, pw.prefix)
+	pw.out.Write(line)
+}
+
+// Flush writes a trailing line without a newline
+func (pw *prefixWriter) Flush() {
+	if len(pw.partial) > 0 {
+		pw.writeLine(append(pw.partial, '\n'))
+		pw.partial = nil
+	}
+}
+
+// modResult is the outcome of a go mod command in one module
+type modResult struct {
+	Dir     string
+	Changed []string // go.mod/go.sum files that changed (or would change)
+	Err     error
+}
+
+// forEachModule runs fn for every module directory, at most jobs at a time,
+// giving each a writer that prefixes its output with the module's path
+func (cfg *GoShimConfig) forEachModule(ctx context.Context, modules []string, jobs int, fn func(ctx context.Context, dir string, out io.Writer) modResult) []modResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	width := 0
+	for _, dir := range modules {
+		width = max(width, len(cfg.relativeToWorkspace(dir)))
+	}
+
+	var mu sync.Mutex
+	results := make([]modResult, len(modules))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, dir := range modules {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			name := cfg.relativeToWorkspace(dir)
+			pw := newPrefixWriter(&mu, stdout, fmt.Sprintf("[%-*s] ", width, name))
+			results[i] = fn(slogctx.With(ctx, "module", name), dir, pw)
+			pw.Flush()
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// readModFiles returns the go.mod and go.sum contents of a module
+func readModFiles(dir string) map[string][]byte {
+	files := map[string][]byte{}
+	for _, name := range []string{"go.mod", "go.sum"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			files[name] = data
+		}
+	}
+	return files
+}
+
+// changedModFiles compares two readModFiles snapshots
+func changedModFiles(before, after map[string][]byte) []string {
+	var changed []string
+	for _, name := range []string{"go.mod", "go.sum"} {
+		b, hadBefore := before[name]
+		a, hasAfter := after[name]
+		if hadBefore != hasAfter || !bytes.Equal(b, a) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// tidyModule runs go mod tidy in dir. In check mode it runs go mod tidy
+// -diff, which changes nothing and prints the diff that tidying would apply.
+func (cfg *GoShimConfig) tidyModule(ctx context.Context, dir string, check bool, out io.Writer) modResult {
+	result := modResult{Dir: dir}
+
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	args := []string{"mod", "tidy", "-e"}
+	if check {
+		args = append(args, "-diff")
+	}
+
+	cmd := exec.CommandContext(ctx, goPath, args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	cmd.Stderr = out
+
+	if check {
+		var diff bytes.Buffer
+		cmd.Stdout = &diff
+		err := cmd.Run()
+		out.Write(diff.Bytes())
+
+		// -diff exits non-zero with a diff when the module is not tidy
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && diff.Len() > 0) {
+			result.Err = err
+		}
+		result.Changed = diffFileNames(diff.String())
+		return result
+	}
+
+	before := readModFiles(dir)
+	cmd.Stdout = out
+	if err := cmd.Run(); err != nil {
+		result.Err = err
+	}
+	result.Changed = changedModFiles(before, readModFiles(dir))
+	return result
+}
+
+// diffFileNames returns the base names of files in a unified diff
+func diffFileNames(diff string) []string {
+	var names []string
+	for _, line := range strings.Split(diff, "\n") {
+		if name, ok := strings.CutPrefix(line, "+++ "); ok {
+			name, _, _ = strings.Cut(name, "\t")
+			names = append(names, filepath.Base(name))
+		}
+	}
+	return names
+}
+
+// runModTidy tidies every workspace module in parallel. With -check nothing
+// is written and the run fails if any module is not tidy.
+func (cfg *GoShimConfig) runModTidy(ctx context.Context, args []string) error {
+	var jobs int
+	fs := newModFlagSet("tidy", &jobs)
+	check := fs.Bool("check", false, "report modules that are not tidy without changing them")
+	if err := parseModFlags(fs, args); err != nil {
+		return err
+	}
+
+	slogctx.Debug(ctx, "Running mod tidy across workspace modules", slog.Int("jobs", jobs))
+
+	modules, err := cfg.workspaceModuleDirs()
+	if err != nil {
+		return err
+	}
+
+	results := cfg.forEachModule(ctx, modules, jobs, func(ctx context.Context, dir string, out io.Writer) modResult {
+		return cfg.tidyModule(ctx, dir, *check, out)
+	})
+
+	return cfg.printTidySummary(stdout, *check, results)
+}
+
+// printTidySummary lists changed and failed modules and returns an error if
+// any failed or, in check mode, is not tidy
+func (cfg *GoShimConfig) printTidySummary(out io.Writer, check bool, results []modResult) error {
+	var changed, failed []string
+	for _, r := range results {
+		name := cfg.relativeToWorkspace(r.Dir)
+		if r.Err != nil {
+			failed = append(failed, name)
+		}
+		if len(r.Changed) > 0 {
+			changed = append(changed, name)
+		}
+	}
+
+	verb, state := "Tidied", "changed"
+	if check {
+		verb, state = "Checked", "not tidy"
+	}
+	fmt.Fprintf(out, "\n🧹 %s %d %s: %d %s", verb, len(results), pluralize(len(results), "module", "modules"), len(changed), state)
+	if len(failed) > 0 {
+		fmt.Fprintf(out, ", %d failed", len(failed))
+	}
+	fmt.Fprintln(out)
+
+	for _, r := range results {
+		name := cfg.relativeToWorkspace(r.Dir)
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(out, "  ❌ %s: %v\n", name, r.Err)
+		case len(r.Changed) > 0 && check:
+			fmt.Fprintf(out, "  ❌ %s (%s)\n", name, strings.Join(r.Changed, ", "))
+		case len(r.Changed) > 0:
+			fmt.Fprintf(out, "  ✏️  %s (%s)\n", name, strings.Join(r.Changed, ", "))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("mod tidy failed in %s", strings.Join(failed, ", "))
+	}
+	if check && len(changed) > 0 {
+		return fmt.Errorf("%d of %d modules not tidy: %s", len(changed), len(results), strings.Join(changed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	pw := newPrefixWriter(&mu, &buf, "[a] ")
+
+	pw.Write([]byte("one\ntw"))
+	pw.Write([]byte("o\nthree"))
+	assert.Equal(t, "[a] one\n[a] two\n", buf.String(), "partial lines are held back")
+
+	pw.Flush()
+	assert.Equal(t, "[a] one\n[a] two\n[a] three\n", buf.String())
+}
+
+func TestDiffFileNames(t *testing.T) {
+	diff := "diff current/go.mod tidy/go.mod\n--- current/go.mod\n+++ tidy/go.mod\n@@ -1 +1 @@\n" +
+		"diff current/go.sum tidy/go.sum\n--- current/go.sum\n+++ tidy/go.sum\n@@ -1 +0,0 @@\n"
+
+	assert.Equal(t, []string{"go.mod", "go.sum"}, diffFileNames(diff))
+	assert.Empty(t, diffFileNames(""))
+}
+
+func TestParseModFlags(t *testing.T) {
+	oldStderr := stderr
+	stderr = io.Discard
+	defer func() { stderr = oldStderr }()
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantJobs int
+		wantErr  bool
+	}{
+		{"default", nil, defaultModJobs, false},
+		{"separate value", []string{"-jobs", "2"}, 2, false},
+		{"joined value", []string{"-jobs=8", "-check"}, 8, false},
+		{"double dash", []string{"--jobs=3"}, 3, false},
+		{"zero", []string{"-jobs", "0"}, 0, true},
+		{"not a number", []string{"-jobs=many"}, 0, true},
+		{"missing value", []string{"-jobs"}, 0, true},
+		{"unknown flag", []string{"-bogus"}, 0, true},
+		{"positional argument", []string{"./..."}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var jobs int
+			fs := newModFlagSet("tidy", &jobs)
+			fs.Bool("check", false, "")
+
+			err := parseModFlags(fs, tt.args)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantJobs, jobs)
+		})
+	}
+}
+
+func TestGoShimConfig_runModTidy(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "")
+	root := t.TempDir()
+	// b requires a without importing it, so tidying drops the requirement
+	untidy := "module example.com/b\n\ngo 1.24\n\nrequire example.com/a v0.0.0\n\nreplace example.com/a => ../a\n"
+	writeFiles(t, root, map[string]string{
+		"go.work":  "go 1.24\n\nuse (\n\t./a\n\t./b\n)\n",
+		"a/go.mod": "module example.com/a\n\ngo 1.24\n",
+		"a/a.go":   "package a\n",
+		"b/go.mod": untidy,
+		"b/b.go":   "package b\n",
+	})
+
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+	err := cfg.runModTidy(t.Context(), []string{"-check", "-jobs", "2"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 modules not tidy: b")
+	data, err := os.ReadFile(filepath.Join(root, "b", "go.mod"))
+	require.NoError(t, err)
+	assert.Equal(t, untidy, string(data), "-check must not modify go.mod")
+
+	require.NoError(t, cfg.runModTidy(t.Context(), nil))
+	data, err = os.ReadFile(filepath.Join(root, "b", "go.mod"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "require")
+
+	assert.NoError(t, cfg.runModTidy(t.Context(), []string{"-check"}))
+	assert.Error(t, cfg.runModTidy(t.Context(), []string{"-jobs", "0"}))
+	assert.Error(t, cfg.runModTidy(t.Context(), []string{"-bogus"}))
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	slogctx "github.com/veqryn/slog-context"
+	"golang.org/x/mod/semver"
+)
+
+// upgrade kinds, in increasing order of risk
+const (
+	upgradePatch = "patch"
+	upgradeMinor = "minor"
+	upgradeMajor = "major"
+)
+
+var upgradeRank = map[string]int{upgradePatch: 0, upgradeMinor: 1, upgradeMajor: 2}
+
+// listedModule is the subset of go list -m -json output used for upgrades
+type listedModule struct {
+	Path    string
+	Version string
+	Main    bool
+	Update  *struct{ Version string }
+	Replace *struct{ Path, Version string }
+	Error   *struct{ Err string }
+}
+
+// moduleUpgrade is an available upgrade of one direct requirement
+type moduleUpgrade struct {
+	Path    string
+	Current string
+	Latest  string
+	Target  string // version to upgrade to, empty when held back
+	Kind    string // of the upgrade to Target, or to Latest when held back
+}
+
+// upgradePlan lists the upgrades of one workspace module
+type upgradePlan struct {
+	Dir      string
+	Upgrades []moduleUpgrade
+}
+
+// upgradeOptions select which upgrades are applied
+type upgradeOptions struct {
+	level   string // highest upgrade kind to apply
+	include []string
+	exclude []string
+	dryRun  bool
+	jobs    int
+}
+
+// upgradeKind classifies the semver distance between two versions
+func upgradeKind(from, to string) string {
+	switch {
+	case semver.Major(from) != semver.Major(to):
+		return upgradeMajor
+	case semver.MajorMinor(from) != semver.MajorMinor(to):
+		return upgradeMinor
+	default:
+		return upgradePatch
+	}
+}
+
+// levelQuery returns the go module query selecting the newest version of the
+// same major (for minor) or major.minor (for patch) as current
+func levelQuery(current, level string) string {
+	if level == upgradePatch {
+		return semver.MajorMinor(current)
+	}
+	return semver.Major(current)
+}
+
+// moduleSelected reports whether path passes the include and exclude globs
+func moduleSelected(path string, include, exclude []string) bool {
+	for _, pattern := range exclude {
+		if matchPackagePattern(pattern, path) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if matchPackagePattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// listModules runs go list -m -json with args in dir
+func (cfg *GoShimConfig) listModules(ctx context.Context, dir string, args ...string) ([]listedModule, error) {
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, goPath, append([]string{"list", "-m", "-e", "-json"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	cmd.Stderr = stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run go list: %w", err)
+	}
+
+	var mods []listedModule
+	dec := json.NewDecoder(out)
+	for {
+		var m listedModule
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			cmd.Wait()
+			return nil, fmt.Errorf("failed to parse go list output: %w", err)
+		}
+		mods = append(mods, m)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("go list -m failed: %w", err)
+	}
+	return mods, nil
+}
+
+// planUpgrades finds the available upgrades of every direct requirement of
+// the workspace modules. Requirements on workspace modules and replaced
+// modules are never upgraded.
+func (cfg *GoShimConfig) planUpgrades(ctx context.Context, ws *workspace, opts upgradeOptions) ([]upgradePlan, error) {
+	listed, err := cfg.listModules(ctx, ws.Root, "-u", "all")
+	if err != nil {
+		return nil, err
+	}
+	byPath := map[string]listedModule{}
+	for _, m := range listed {
+		byPath[m.Path] = m
+	}
+
+	var plans []upgradePlan
+	queries := map[string]string{} // path@query -> resolved version
+	for _, mod := range ws.Modules {
+		plan := upgradePlan{Dir: mod.Dir}
+		for _, req := range mod.Requires {
+			lm, ok := byPath[req.Mod.Path]
+			if req.Indirect || !ok || lm.Main || lm.Replace != nil || !moduleSelected(req.Mod.Path, opts.include, opts.exclude) {
+				continue
+			}
+
+			// the workspace may already select a newer version than required
+			latest := lm.Version
+			if lm.Update != nil {
+				latest = lm.Update.Version
+			}
+			if semver.Compare(latest, req.Mod.Version) <= 0 {
+				continue
+			}
+
+			up := moduleUpgrade{Path: req.Mod.Path, Current: req.Mod.Version, Latest: latest, Target: latest, Kind: upgradeKind(req.Mod.Version, latest)}
+			if upgradeRank[up.Kind] > upgradeRank[opts.level] {
+				up.Target = ""
+				queries[up.Path+"@"+levelQuery(up.Current, opts.level)] = ""
+			}
+			plan.Upgrades = append(plan.Upgrades, up)
+		}
+		plans = append(plans, plan)
+	}
+
+	// resolve the newest allowed version of held back upgrades
+	if len(queries) > 0 {
+		var args []string
+		for q := range queries {
+			args = append(args, q)
+		}
+		sort.Strings(args)
+		resolved, err := cfg.listModules(ctx, ws.Root, args...)
+		if err != nil {
+			return nil, err
+		}
+		// go list prints one module per query, in order
+		for i, m := range resolved {
+			if i < len(args) && m.Error == nil && strings.HasPrefix(args[i], m.Path+"@") {
+				queries[args[i]] = m.Version
+			}
+		}
+		for i := range plans {
+			for j, up := range plans[i].Upgrades {
+				if up.Target != "" {
+					continue
+				}
+				if v := queries[up.Path+"@"+levelQuery(up.Current, opts.level)]; semver.Compare(v, up.Current) > 0 {
+					plans[i].Upgrades[j].Target = v
+					plans[i].Upgrades[j].Kind = upgradeKind(up.Current, v)
+				}
+			}
+		}
+	}
+
+	return plans, nil
+}
+
+// printUpgradePlan prints the upgrades of each module and returns how many
+// will be applied
+func (cfg *GoShimConfig) printUpgradePlan(out io.Writer, plans []upgradePlan, level string) int {
+	fmt.Fprintln(out, "================================================")
+	fmt.Fprintln(out, "Upgrade Plan")
+	fmt.Fprintln(out, "------------------------------------------------")
+
+	applied := 0
+	for _, plan := range plans {
+		if len(plan.Upgrades) == 0 {
+			fmt.Fprintf(out, "%s: up to date\n", cfg.relativeToWorkspace(plan.Dir))
+			continue
+		}
+		fmt.Fprintf(out, "%s:\n", cfg.relativeToWorkspace(plan.Dir))
+
+		width := 0
+		for _, up := range plan.Upgrades {
+			width = max(width, len(up.Path))
+		}
+		for _, up := range plan.Upgrades {
+			if up.Target == "" {
+				fmt.Fprintf(out, "  %-*s  %s → %s  %s (held back by -%s)\n", width, up.Path, up.Current, up.Latest, up.Kind, level)
+				continue
+			}
+			applied++
+			line := fmt.Sprintf("  %-*s  %s → %s  %s", width, up.Path, up.Current, up.Target, up.Kind)
+			if up.Target != up.Latest {
+				line += fmt.Sprintf(" (latest %s)", up.Latest)
+			}
+			fmt.Fprintln(out, line)
+		}
+	}
+
+	fmt.Fprintln(out, "================================================")
+	return applied
+}
+
+// upgradeModule applies the planned upgrades of one module
+func (cfg *GoShimConfig) upgradeModule(ctx context.Context, plan upgradePlan, out io.Writer) modResult {
+	var targets []string
+	for _, up := range plan.Upgrades {
+		if up.Target != "" {
+			targets = append(targets, up.Path+"@"+up.Target)
+		}
+	}
+	return cfg.getAndTidy(ctx, plan.Dir, targets, out)
+}
+
+// getAndTidy runs go get with the path@version targets in dir and tidies it.
+// Nothing is run without targets.
+func (cfg *GoShimConfig) getAndTidy(ctx context.Context, dir string, targets []string, out io.Writer) modResult {
+	result := modResult{Dir: dir}
+	if len(targets) == 0 {
+		return result
+	}
+
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	before := readModFiles(dir)
+	cmd := exec.CommandContext(ctx, goPath, append([]string{"get"}, targets...)...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		result.Err = fmt.Errorf("go get failed: %w", err)
+		return result
+	}
+
+	tidied := cfg.tidyModule(ctx, dir, false, out)
+	result.Err = tidied.Err
+	result.Changed = changedModFiles(before, readModFiles(dir))
+	return result
+}
+
+// runModUpgrade upgrades the direct requirements of every workspace module
+// and tidies them
+func (cfg *GoShimConfig) runModUpgrade(ctx context.Context, args []string) error {
+	opts := upgradeOptions{level: upgradeMajor}
+	fs := newModFlagSet("upgrade", &opts.jobs)
+	patch := fs.Bool("patch", false, "only upgrade to patch releases")
+	minor := fs.Bool("minor", false, "only upgrade to minor and patch releases")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "show the upgrades without applying them")
+	fs.Var((*arrayFlags)(&opts.include), "include", "only upgrade modules matching this pattern (repeatable)")
+	fs.Var((*arrayFlags)(&opts.exclude), "exclude", "skip modules matching this pattern (repeatable)")
+	if err := parseModFlags(fs, args); err != nil {
+		return err
+	}
+	switch {
+	case *patch:
+		opts.level = upgradePatch
+	case *minor:
+		opts.level = upgradeMinor
+	}
+
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return err
+	}
+
+	slogctx.Debug(ctx, "Checking modules for upgrades", slog.Int("modules", len(ws.Modules)), slog.String("level", opts.level))
+
+	plans, err := cfg.planUpgrades(ctx, ws, opts)
+	if err != nil {
+		return err
+	}
+
+	applied := cfg.printUpgradePlan(stdout, plans, opts.level)
+	if applied == 0 {
+		fmt.Fprintln(stdout, "⬆️  Nothing to upgrade")
+		return nil
+	}
+	if opts.dryRun {
+		fmt.Fprintf(stdout, "⬆️  Dry run: %d %s not applied\n", applied, pluralize(applied, "upgrade", "upgrades"))
+		return nil
+	}
+
+	byDir := map[string]upgradePlan{}
+	for _, plan := range plans {
+		byDir[plan.Dir] = plan
+	}
+	results := cfg.forEachModule(ctx, ws.Dirs(), opts.jobs, func(ctx context.Context, dir string, out io.Writer) modResult {
+		return cfg.upgradeModule(ctx, byDir[dir], out)
+	})
+
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, cfg.relativeToWorkspace(r.Dir))
+			fmt.Fprintf(stdout, "  ❌ %s: %v\n", cfg.relativeToWorkspace(r.Dir), r.Err)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("mod upgrade failed in %s", strings.Join(failed, ", "))
+	}
+	fmt.Fprintf(stdout, "⬆️  Applied %d %s\n", applied, pluralize(applied, "upgrade", "upgrades"))
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/zip"
+)
+
+func TestUpgradeKind(t *testing.T) {
+	assert.Equal(t, upgradePatch, upgradeKind("v1.2.3", "v1.2.4"))
+	assert.Equal(t, upgradeMinor, upgradeKind("v1.2.3", "v1.3.0"))
+	assert.Equal(t, upgradeMajor, upgradeKind("v0.9.0", "v1.0.0"))
+	assert.Equal(t, upgradePatch, upgradeKind("v1.2.3", "v1.2.4-0.20250101000000-abcdefabcdef"))
+}
+
+func TestModuleSelected(t *testing.T) {
+	assert.True(t, moduleSelected("golang.org/x/mod", nil, nil))
+	assert.True(t, moduleSelected("golang.org/x/mod", []string{"golang.org/x/*"}, nil))
+	assert.False(t, moduleSelected("github.com/a/b", []string{"golang.org/x/*"}, nil))
+	assert.False(t, moduleSelected("golang.org/x/mod", nil, []string{"golang.org/x/mod"}))
+	assert.True(t, moduleSelected("github.com/a/b/v2", []string{"github.com/a/..."}, nil))
+}
+
+// writeProxyModule adds versions of a library module to a GOPROXY=file://
+// mirror
+func writeProxyModule(t *testing.T, proxy, path string, versions ...string) {
+	t.Helper()
+	writeProxyModuleFiles(t, proxy, path, map[string]string{"lib.go": "package " + filepath.Base(path) + "\n"}, versions...)
+}
+
+// writeProxyModuleFiles adds versions of a module with the given files (and
+// a generated go.mod) to a GOPROXY=file:// mirror
+func writeProxyModuleFiles(t *testing.T, proxy, path string, files map[string]string, versions ...string) {
+	t.Helper()
+	dir := filepath.Join(proxy, filepath.FromSlash(path), "@v")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+
+	gomod := "module " + path + "\n\ngo 1.21\n"
+	for _, v := range versions {
+		src := t.TempDir()
+		writeFiles(t, src, files)
+		writeFiles(t, src, map[string]string{"go.mod": gomod})
+
+		zf, err := os.Create(filepath.Join(dir, v+".zip"))
+		require.NoError(t, err)
+		require.NoError(t, zip.CreateFromDir(zf, module.Version{Path: path, Version: v}, src))
+		require.NoError(t, zf.Close())
+
+		info := `{"Version":"` + v + `","Time":"` + time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339) + `"}`
+		require.NoError(t, os.WriteFile(filepath.Join(dir, v+".info"), []byte(info), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, v+".mod"), []byte(gomod), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "list"), []byte(strings.Join(versions, "\n")+"\n"), 0644))
+}
+
+func TestGoShimConfig_runModUpgrade(t *testing.T) {
+	proxy := t.TempDir()
+	writeProxyModule(t, proxy, "example.com/lib", "v1.0.0", "v1.0.1", "v1.1.0")
+	writeProxyModule(t, proxy, "example.com/zero", "v0.1.0", "v0.1.1", "v1.0.0")
+
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(proxy))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOFLAGS", "-modcacherw")
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GOTOOLCHAIN", "local")
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.work":    "go 1.24\n\nuse ./app\n",
+		"app/go.mod": "module example.com/app\n\ngo 1.24\n\nrequire (\n\texample.com/lib v1.0.0\n\texample.com/zero v0.1.0\n)\n",
+		"app/app.go": "package app\n\nimport (\n\t_ \"example.com/lib\"\n\t_ \"example.com/zero\"\n)\n",
+	})
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+	require.NoError(t, cfg.runModTidy(t.Context(), nil))
+
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	goMod := func() string {
+		data, err := os.ReadFile(filepath.Join(root, "app", "go.mod"))
+		require.NoError(t, err)
+		return string(data)
+	}
+	original := goMod()
+
+	require.NoError(t, cfg.runModUpgrade(t.Context(), []string{"-dry-run"}))
+	assert.Contains(t, buf.String(), "example.com/lib   v1.0.0 → v1.1.0  minor")
+	assert.Contains(t, buf.String(), "example.com/zero  v0.1.0 → v1.0.0  major")
+	assert.Equal(t, original, goMod(), "-dry-run must not change go.mod")
+
+	buf.Reset()
+	require.NoError(t, cfg.runModUpgrade(t.Context(), []string{"-patch", "-dry-run"}))
+	assert.Contains(t, buf.String(), "example.com/lib   v1.0.0 → v1.0.1  patch (latest v1.1.0)")
+	assert.Contains(t, buf.String(), "example.com/zero  v0.1.0 → v0.1.1  patch (latest v1.0.0)")
+
+	buf.Reset()
+	require.NoError(t, cfg.runModUpgrade(t.Context(), []string{"-minor", "-exclude", "example.com/zero"}))
+	assert.Contains(t, goMod(), "example.com/lib v1.1.0")
+	assert.Contains(t, goMod(), "example.com/zero v0.1.0")
+
+	buf.Reset()
+	require.NoError(t, cfg.runModUpgrade(t.Context(), []string{"-include=example.com/*"}))
+	assert.Contains(t, goMod(), "example.com/zero v1.0.0")
+
+	buf.Reset()
+	require.NoError(t, cfg.runModUpgrade(t.Context(), nil))
+	assert.Contains(t, buf.String(), "Nothing to upgrade")
+
+	assert.Error(t, cfg.runModUpgrade(t.Context(), []string{"-bogus"}))
+	assert.Error(t, cfg.runModUpgrade(t.Context(), []string{"-include"}))
+}
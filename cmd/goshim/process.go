@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+)
+
+// signalGracePeriod is how long a child gets to exit after a forwarded
+// signal before its process group is killed
+var signalGracePeriod = 5 * time.Second
+
+// exitCodeError attaches the status goshim should exit with to an error that
+// does not carry one itself, e.g. a summary of several failed commands
+type exitCodeError struct {
+	err  error
+	code int
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// withExitCode makes err exit goshim with code
+func withExitCode(err error, code int) error {
+	return &exitCodeError{err: err, code: code}
+}
+
+// exitCode returns the status goshim exits with for err: the wrapped
+// command's exit status, 128+n when it was killed by signal n (like a shell
+// reports it), and 1 for everything else
+func exitCode(err error) int {
+	var codeErr *exitCodeError
+	if errors.As(err, &codeErr) {
+		return codeErr.code
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code, ok := signalExitCode(exitErr); ok {
+			return code
+		}
+		if code := exitErr.ExitCode(); code > 0 {
+			return code
+		}
+	}
+	return 1
+}
+
+// isCommandExit reports whether err is a wrapped command exiting with a
+// failure status, which the command itself has already explained
+func isCommandExit(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr)
+}
+
+// startCommand starts cmd, which must come from exec.CommandContext, in its
+// own process group. Canceling its context kills the whole group, not just
+// the direct child, so test binaries and tools it spawned go with it.
+//
+// A command reading goshim's terminal stays in goshim's group instead: only
+// the terminal's foreground group may read from it, anything else is stopped
+// by SIGTTIN. Signals are then forwarded to the command alone.
+func startCommand(cmd *exec.Cmd) error {
+	if !readsTerminal(cmd) {
+		setProcessGroup(cmd)
+	}
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	return cmd.Start()
+}
+
+// readsTerminal reports whether cmd's stdin is a terminal. /dev/null is a
+// character device too, so it is ruled out explicitly.
+func readsTerminal(cmd *exec.Cmd) bool {
+	f, ok := cmd.Stdin.(*os.File)
+	if !ok || !isTerminal(f) {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+// runCommand runs cmd like exec.Cmd.Run, forwarding goshim's signals to it
+func runCommand(cmd *exec.Cmd) error {
+	if err := startCommand(cmd); err != nil {
+		return err
+	}
+	stop := forwardSignals(cmd)
+	defer stop()
+	return cmd.Wait()
+}
+
+// forwardSignals relays SIGINT, SIGTERM and SIGQUIT sent to goshim to the
+// process group of the started cmd until stop is called. A child still
+// running signalGracePeriod after the first signal, or receiving a second
+// one, is killed.
+func forwardSignals(cmd *exec.Cmd) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+	done := make(chan struct{})
+
+	go func() {
+		var escalate <-chan time.Time
+		signaled := false
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-sigs:
+				if signaled {
+					killProcessGroup(cmd)
+					continue
+				}
+				signaled = true
+				signalProcessGroup(cmd, sig)
+				escalate = time.After(signalGracePeriod)
+			case <-escalate:
+				killProcessGroup(cmd)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
@@ -0,0 +1,86 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openPty opens a new pseudo terminal, returning its master and slave ends
+func openPty(t *testing.T) (*os.File, *os.File) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { master.Close() })
+
+	var unlock, n int32
+	ioctl := func(req uintptr, arg *int32) {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), req, uintptr(unsafe.Pointer(arg)))
+		require.Zero(t, errno, "ioctl %#x", req)
+	}
+	ioctl(syscall.TIOCSPTLCK, &unlock)
+	ioctl(syscall.TIOCGPTN, &n)
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	require.NoError(t, err)
+	return master, slave
+}
+
+func TestRunCommand_readsTerminal(t *testing.T) {
+	if os.Getenv("GOSHIM_TEST_TERMINAL") == "1" {
+		// goshim's side: the foreground process group of the terminal on stdin
+		cmd := exec.CommandContext(context.Background(), "sh", "-c", `read line; echo "got $line"`)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		if err := runCommand(cmd); err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	master, slave := openPty(t)
+	helper := exec.Command(os.Args[0], "-test.run=^TestRunCommand_readsTerminal$")
+	helper.Env = append(os.Environ(), "GOSHIM_TEST_TERMINAL=1")
+	helper.Stdin, helper.Stdout, helper.Stderr = slave, slave, slave
+	helper.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	require.NoError(t, helper.Start())
+	slave.Close()
+	defer helper.Process.Kill()
+
+	output := make(chan string, 1)
+	go func() {
+		var buf strings.Builder
+		chunk := make([]byte, 256)
+		for {
+			n, err := master.Read(chunk)
+			buf.Write(chunk[:n])
+			if err != nil || strings.Contains(buf.String(), "got hello") {
+				output <- buf.String()
+				return
+			}
+		}
+	}()
+	_, err := master.Write([]byte("hello\n"))
+	require.NoError(t, err)
+
+	select {
+	case out := <-output:
+		assert.Contains(t, out, "got hello", "a child reading the terminal should not be stopped")
+	case <-time.After(10 * time.Second):
+		t.Fatal("the child reading the terminal never finished, stopped by SIGTTIN?")
+	}
+	require.NoError(t, helper.Wait())
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// forwardedSignals are the signals goshim relays to the commands it wraps
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// setProcessGroup is a no-op: process groups are a unix concept
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup sends sig to cmd
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
+
+// killProcessGroup kills cmd
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// signalExitCode reports no signal-derived status, there are no signal exits
+func signalExitCode(err *exec.ExitError) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,116 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCode(t *testing.T) {
+	run := func(script string) error {
+		return runCommand(exec.CommandContext(context.Background(), "sh", "-c", script))
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"exit status", run("exit 3"), 3},
+		{"wrapped exit status", fmt.Errorf("failed to run: %w", run("exit 2")), 2},
+		{"killed by signal", run("kill -TERM $$"), 128 + int(syscall.SIGTERM)},
+		{"explicit code", withExitCode(fmt.Errorf("2 of 3 modules failed"), 4), 4},
+		{"other error", fmt.Errorf("could not find go executable"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, exitCode(tt.err))
+		})
+	}
+}
+
+func TestIsCommandExit(t *testing.T) {
+	exitErr := runCommand(exec.CommandContext(context.Background(), "sh", "-c", "exit 3"))
+
+	assert.True(t, isCommandExit(exitErr))
+	assert.True(t, isCommandExit(fmt.Errorf("failed to run go test: %w", exitErr)))
+	assert.False(t, isCommandExit(withExitCode(fmt.Errorf("2 of 3 modules failed"), 4)))
+	assert.False(t, isCommandExit(fmt.Errorf("could not find go executable")))
+	assert.False(t, isCommandExit(runCommand(exec.CommandContext(context.Background(), "/nonexistent/go"))))
+}
+
+func TestRunCommand_forwardsSignals(t *testing.T) {
+	oldGrace := signalGracePeriod
+	signalGracePeriod = 200 * time.Millisecond
+	defer func() { signalGracePeriod = oldGrace }()
+
+	// signal goshim (the test binary) once the child is running
+	signalSelf := func(sig syscall.Signal) {
+		time.AfterFunc(200*time.Millisecond, func() { syscall.Kill(os.Getpid(), sig) })
+	}
+
+	t.Run("forwarded to the process group", func(t *testing.T) {
+		signalSelf(syscall.SIGTERM)
+		err := runCommand(exec.CommandContext(context.Background(), "sh", "-c", `trap "exit 7" TERM; while :; do sleep 0.05; done`))
+		require.Error(t, err)
+		assert.Equal(t, 7, exitCode(err))
+	})
+
+	t.Run("escalates after the grace period", func(t *testing.T) {
+		signalSelf(syscall.SIGINT)
+		start := time.Now()
+		err := runCommand(exec.CommandContext(context.Background(), "sh", "-c", `trap "" INT; while :; do sleep 0.05; done`))
+		require.Error(t, err)
+		assert.Equal(t, 128+int(syscall.SIGKILL), exitCode(err))
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("context cancel kills the group", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		err := runCommand(exec.CommandContext(ctx, "sh", "-c", `sleep 10 & wait`))
+		require.Error(t, err)
+		assert.Equal(t, 128+int(syscall.SIGKILL), exitCode(err))
+	})
+}
+
+func TestGoShimConfig_runGoTestJSON_longLines(t *testing.T) {
+	// a fake go that logs one 20 MiB line, beyond any fixed scanner buffer,
+	// followed by an event that must still be read
+	fakeGo := filepath.Join(t.TempDir(), "go")
+	script := "#!/bin/sh\n" +
+		"head -c 20971520 /dev/zero | tr '\\0' x\necho\n" +
+		`echo '{"Action":"pass","Package":"example.com/a","Elapsed":0.1}'` + "\n"
+	require.NoError(t, os.WriteFile(fakeGo, []byte(script), 0o755))
+
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	cfg := &GoShimConfig{GoExecutable: fakeGo}
+	results := newTestResults()
+	done := make(chan error, 1)
+	go func() { done <- cfg.runGoTestJSON(t.Context(), "", []string{"test", "./..."}, results, nil) }()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(30 * time.Second):
+		t.Fatal("runGoTestJSON hung on a long line")
+	}
+	assert.Equal(t, 20971520+1, buf.Len(), "the long line should pass through whole")
+	require.Len(t, results.Packages(), 1)
+	assert.Equal(t, resultPass, results.Packages()[0].Result)
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// testReport is the normalized, machine-readable summary of a test run.
+// It is written by -report-json and is the input for JUnit output, so
+// reports from several runs can be merged and converted later.
+type testReport struct {
+	Started  time.Time       `json:"started"`
+	Elapsed  float64         `json:"elapsed_seconds"`
+	Totals   reportTotals    `json:"totals"`
+	Packages []reportPackage `json:"packages"`
+	Flaky    []reportFlaky   `json:"flaky,omitempty"`
+}
+
+// reportFlaky is a test that failed and then passed when rerun
+type reportFlaky struct {
+	Package  string `json:"package"`
+	Test     string `json:"test"`
+	Attempts int    `json:"attempts"`
+}
+
+type reportTotals struct {
+	Tests   int `json:"tests"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+type reportPackage struct {
+	Name        string       `json:"name"`
+	Result      string       `json:"result"`
+	Elapsed     float64      `json:"elapsed_seconds"`
+	Cached      bool         `json:"cached,omitempty"`
+	NoTestFiles bool         `json:"no_test_files,omitempty"`
+	Coverage    string       `json:"coverage,omitempty"`
+	BuildFailed bool         `json:"build_failed,omitempty"`
+	BuildOutput []string     `json:"build_output,omitempty"`
+	Output      []string     `json:"output,omitempty"`
+	Tests       []reportTest `json:"tests"`
+}
+
+type reportTest struct {
+	Name    string   `json:"name"`
+	Result  string   `json:"result"`
+	Elapsed float64  `json:"elapsed_seconds"`
+	Output  []string `json:"output,omitempty"`
+}
+
+// buildTestReport converts aggregated results into a report. Output is only
+// kept for failed and skipped tests (and failed packages) to keep reports small.
+func buildTestReport(results *testResults) *testReport {
+	counts := results.Counts()
+	report := &testReport{
+		Started: results.start,
+		Elapsed: time.Since(results.start).Seconds(),
+		Totals: reportTotals{
+			Tests:   counts.Total,
+			Passed:  counts.Passed,
+			Failed:  counts.Failed,
+			Skipped: counts.Skipped,
+		},
+		Packages: []reportPackage{},
+	}
+
+	for _, p := range results.Packages() {
+		rp := reportPackage{
+			Name:        p.Name,
+			Result:      p.Result,
+			Elapsed:     p.Elapsed.Seconds(),
+			Cached:      p.Cached,
+			NoTestFiles: p.NoTestFiles,
+			Coverage:    p.Coverage,
+			BuildFailed: p.BuildFailed,
+			BuildOutput: p.BuildOutput,
+			Tests:       []reportTest{},
+		}
+		if p.BuildFailed {
+			rp.Result = resultFail
+		}
+		if rp.Result == resultFail {
+			rp.Output = p.Output
+		}
+
+		for _, tc := range p.Tests() {
+			rt := reportTest{
+				Name:    tc.Name,
+				Result:  tc.Result,
+				Elapsed: tc.Elapsed.Seconds(),
+			}
+			if tc.Result == resultFail || tc.Result == resultSkip {
+				rt.Output = tc.Output
+			}
+			rp.Tests = append(rp.Tests, rt)
+		}
+
+		report.Packages = append(report.Packages, rp)
+	}
+
+	return report
+}
+
+// markFlakyPassed lists tests that passed on rerun as flaky and counts them
+// as passed, since a later attempt did pass. Parent tests and packages that
+// only failed because of them pass too.
+func markFlakyPassed(report *testReport, flaky []failedTest) {
+	for _, ft := range flaky {
+		report.Flaky = append(report.Flaky, reportFlaky{Package: ft.Package, Test: ft.Name, Attempts: ft.Attempts})
+	}
+
+	for i := range report.Packages {
+		p := &report.Packages[i]
+		// children start after their parents, so walking backwards settles
+		// every subtest before the test enclosing it
+		for j := len(p.Tests) - 1; j >= 0; j-- {
+			rt := &p.Tests[j]
+			if rt.Result != resultFail || !flakyOrParent(flaky, p.Name, rt.Name) || failingSubtest(p.Tests, rt.Name) {
+				continue
+			}
+			rt.Result, rt.Output = resultPass, nil
+			report.Totals.Failed--
+			report.Totals.Passed++
+		}
+
+		if p.Result == resultFail && !p.BuildFailed && !failingSubtest(p.Tests, "") {
+			p.Result, p.Output = resultPass, nil
+		}
+	}
+}
+
+// flakyOrParent reports whether name is a flaky test of pkg or encloses one
+func flakyOrParent(flaky []failedTest, pkg, name string) bool {
+	for _, ft := range flaky {
+		if ft.Package == pkg && (ft.Name == name || strings.HasPrefix(ft.Name, name+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// failingSubtest reports whether a subtest of parent failed, or any test
+// when parent is ""
+func failingSubtest(tests []reportTest, parent string) bool {
+	for _, rt := range tests {
+		if rt.Result == resultFail && (parent == "" || strings.HasPrefix(rt.Name, parent+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONReport writes the report as indented JSON
+func writeJSONReport(path string, report *testReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode json report: %w", err)
+	}
+	return writeReportFile(path, append(data, '\n'))
+}
+
+// readJSONReport loads a report written by writeJSONReport
+func readJSONReport(path string) (*testReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report %s: %w", path, err)
+	}
+
+	var report testReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// writeReportFile writes data to path, creating parent directories
+func writeReportFile(path string, data []byte) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Cases      []*junitCase     `xml:"testcase"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitCase is a test case; subtests are nested inside their parent
+type junitCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	Cases     []*junitCase  `xml:"testcase,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// buildJUnit converts a report into JUnit XML suites, one per package
+func buildJUnit(report *testReport) *junitTestSuites {
+	suites := &junitTestSuites{
+		Time:   formatJUnitTime(report.Elapsed),
+		Suites: []junitTestSuite{},
+	}
+
+	for _, p := range report.Packages {
+		suite := junitTestSuite{
+			Name: p.Name,
+			Time: formatJUnitTime(p.Elapsed),
+		}
+		if !report.Started.IsZero() {
+			suite.Timestamp = report.Started.UTC().Format(time.RFC3339)
+		}
+		if p.Coverage != "" {
+			suite.Properties = &junitProperties{Properties: []junitProperty{{Name: "coverage", Value: p.Coverage}}}
+		}
+
+		cases := map[string]*junitCase{}
+		for _, t := range p.Tests {
+			c := &junitCase{
+				Classname: p.Name,
+				Name:      t.Name,
+				Time:      formatJUnitTime(t.Elapsed),
+			}
+			switch t.Result {
+			case resultFail:
+				c.Failure = &junitMessage{Message: "Failed", Body: strings.Join(t.Output, "")}
+				suite.Failures++
+			case resultSkip:
+				c.Skipped = &junitMessage{Message: skipMessage(t.Output)}
+				suite.Skipped++
+			}
+			suite.Tests++
+			cases[t.Name] = c
+
+			// attach subtests to their parent so the hierarchy is preserved
+			if idx := strings.LastIndex(t.Name, "/"); idx >= 0 {
+				if parent, ok := cases[t.Name[:idx]]; ok {
+					parent.Cases = append(parent.Cases, c)
+					continue
+				}
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+
+		// failures that no test accounts for (build errors, TestMain panics)
+		if p.Result == resultFail && suite.Failures == 0 {
+			body := strings.Join(p.BuildOutput, "") + strings.Join(p.Output, "")
+			name := "[package failed]"
+			if p.BuildFailed {
+				name = "[build failed]"
+			}
+			suite.Cases = append(suite.Cases, &junitCase{
+				Classname: p.Name,
+				Name:      name,
+				Time:      formatJUnitTime(p.Elapsed),
+				Error:     &junitMessage{Message: name, Body: body},
+			})
+			suite.Tests++
+			suite.Errors++
+		}
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	return suites
+}
+
+// skipMessage extracts the t.Skip reason from a skipped test's output
+func skipMessage(output []string) string {
+	for _, line := range output {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- SKIP") {
+			continue
+		}
+		return trimmed
+	}
+	return "Skipped"
+}
+
+func formatJUnitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
+
+// writeJUnitReport writes the report as JUnit XML
+func writeJUnitReport(path string, report *testReport) error {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&sb)
+	enc.Indent("", "  ")
+	if err := enc.Encode(buildJUnit(report)); err != nil {
+		return fmt.Errorf("failed to encode junit report: %w", err)
+	}
+	sb.WriteString("\n")
+
+	return writeReportFile(path, []byte(sb.String()))
+}
+
+// writeTestReports writes the requested report files for results
+func (cfg *GoShimConfig) writeTestReports(ctx context.Context, junitFile, jsonFile string, results *testResults, reruns *rerunOutcome) error {
+	if junitFile == "" && jsonFile == "" {
+		return nil
+	}
+
+	report := buildTestReport(results)
+	if reruns != nil {
+		markFlakyPassed(report, reruns.Flaky)
+	}
+
+	if jsonFile != "" {
+		if err := writeJSONReport(jsonFile, report); err != nil {
+			return err
+		}
+		slogctx.Debug(ctx, "Wrote JSON report", slog.String("file", jsonFile))
+	}
+
+	if junitFile != "" {
+		if err := writeJUnitReport(junitFile, report); err != nil {
+			return err
+		}
+		slogctx.Debug(ctx, "Wrote JUnit report", slog.String("file", junitFile))
+	}
+
+	return nil
+}
+
+// rawRenderer echoes the original go test output carried in -json events,
+// used when reports are requested in -ide raw mode. Note that go test -json
+// always runs tests verbosely, so "=== RUN" lines appear even without -v.
+type rawRenderer struct {
+	out    io.Writer
+	errOut io.Writer
+}
+
+func (rr *rawRenderer) event(ev testEvent) {
+	switch ev.Action {
+	case "output":
+		io.WriteString(rr.out, ev.Output)
+	case "build-output":
+		io.WriteString(rr.errOut, ev.Output)
+	}
+}
+
+func (rr *rawRenderer) packageDone(p *packageResult) {}
+
+func (rr *rawRenderer) finish(r *testResults) {}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTestReport(t *testing.T) {
+	report := buildTestReport(loadSampleResults(t, nil))
+
+	assert.Equal(t, reportTotals{Tests: 4, Passed: 1, Failed: 3, Skipped: 1}, report.Totals)
+	require.Len(t, report.Packages, 4)
+
+	a := report.Packages[0]
+	assert.Equal(t, "71.4%", a.Coverage)
+	require.Len(t, a.Tests, 4)
+	assert.Empty(t, a.Tests[0].Output, "passing test output should be dropped")
+	assert.Contains(t, a.Tests[2].Output, "    a_test.go:7: boom\n", "failing test output should be kept")
+
+	b := report.Packages[1]
+	assert.Equal(t, resultFail, b.Result)
+	assert.True(t, b.BuildFailed)
+	assert.Len(t, b.BuildOutput, 2)
+}
+
+func TestWriteJSONReport_roundTrip(t *testing.T) {
+	report := buildTestReport(loadSampleResults(t, nil))
+	path := filepath.Join(t.TempDir(), "nested", "report.json")
+
+	require.NoError(t, writeJSONReport(path, report), "parent directories should be created")
+
+	loaded, err := readJSONReport(path)
+	require.NoError(t, err)
+	assert.Equal(t, report.Totals, loaded.Totals)
+	assert.Equal(t, report.Packages, loaded.Packages)
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	report := buildTestReport(loadSampleResults(t, nil))
+	path := filepath.Join(t.TempDir(), "junit.xml")
+
+	require.NoError(t, writeJUnitReport(path, report))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal(data, &suites), "output should be valid xml")
+
+	assert.Equal(t, 5, suites.Tests, "build failure should add an error case")
+	assert.Equal(t, 2, suites.Failures)
+	assert.Equal(t, 1, suites.Errors)
+	assert.Equal(t, 1, suites.Skipped)
+	require.Len(t, suites.Suites, 4)
+
+	a := suites.Suites[0]
+	require.NotNil(t, a.Properties)
+	assert.Equal(t, []junitProperty{{Name: "coverage", Value: "71.4%"}}, a.Properties.Properties)
+	require.Len(t, a.Cases, 3, "subtests should be nested, not top level")
+
+	bad := a.Cases[1]
+	assert.Equal(t, "TestBad", bad.Name)
+	assert.Equal(t, "0.020", bad.Time)
+	require.NotNil(t, bad.Failure)
+	require.Len(t, bad.Cases, 1)
+	assert.Equal(t, "TestBad/sub_one", bad.Cases[0].Name)
+	require.NotNil(t, bad.Cases[0].Failure)
+	assert.Contains(t, bad.Cases[0].Failure.Body, "a_test.go:7: boom")
+
+	assert.NotNil(t, a.Cases[2].Skipped)
+
+	b := suites.Suites[1]
+	require.Len(t, b.Cases, 1)
+	assert.Equal(t, "[build failed]", b.Cases[0].Name)
+	require.NotNil(t, b.Cases[0].Error)
+	assert.Contains(t, b.Cases[0].Error.Body, "declared and not used: x")
+}
+
+func TestGoShimConfig_writeTestReportsFlaky(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile, junitFile := filepath.Join(dir, "report.json"), filepath.Join(dir, "junit.xml")
+	reruns := &rerunOutcome{Flaky: []failedTest{{Package: "example.com/a", Name: "TestBad/sub_one", Attempts: 2}}}
+
+	cfg := &GoShimConfig{}
+	require.NoError(t, cfg.writeTestReports(t.Context(), junitFile, jsonFile, loadSampleResults(t, nil), reruns))
+
+	report, err := readJSONReport(jsonFile)
+	require.NoError(t, err)
+	assert.Equal(t, reportTotals{Tests: 4, Passed: 3, Failed: 1, Skipped: 1}, report.Totals, "only the build failure should be left")
+	assert.Equal(t, []reportFlaky{{Package: "example.com/a", Test: "TestBad/sub_one", Attempts: 2}}, report.Flaky)
+
+	a := report.Packages[0]
+	assert.Equal(t, resultPass, a.Result, "a package failing only through flaky tests passes")
+	assert.Equal(t, resultPass, a.Tests[1].Result, "the parent of a flaky test passes")
+	assert.Equal(t, resultPass, a.Tests[2].Result)
+	assert.Empty(t, a.Tests[2].Output)
+	assert.Equal(t, resultFail, report.Packages[1].Result, "the build failure is not flaky")
+
+	data, err := os.ReadFile(junitFile)
+	require.NoError(t, err)
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal(data, &suites))
+	assert.Equal(t, 0, suites.Failures)
+	assert.Equal(t, 1, suites.Errors)
+	assert.Equal(t, 0, suites.Suites[0].Failures)
+}
+
+func TestRawRenderer(t *testing.T) {
+	var out, errOut bytes.Buffer
+	rr := &rawRenderer{out: &out, errOut: &errOut}
+
+	rr.event(testEvent{Action: "output", Package: "example.com/a", Output: "=== RUN   TestOK\n"})
+	rr.event(testEvent{Action: "build-output", ImportPath: "example.com/b", Output: "# example.com/b\n"})
+	rr.event(testEvent{Action: "pass", Package: "example.com/a"})
+
+	assert.Equal(t, "=== RUN   TestOK\n", out.String())
+	assert.Equal(t, "# example.com/b\n", errOut.String())
+}
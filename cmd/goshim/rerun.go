@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// defaultReruns is used when -rerun-fails is given without a count
+const defaultReruns = 2
+
+// failedTest identifies a single failing test or subtest
+type failedTest struct {
+	Package  string
+	Name     string
+	Attempts int // runs including the first, set once the outcome is known
+}
+
+func (ft failedTest) String() string {
+	return ft.Package + " " + ft.Name
+}
+
+// rerunOutcome classifies the failures of the initial run after rerunning
+type rerunOutcome struct {
+	// Flaky tests failed at first and passed on a later attempt
+	Flaky []failedTest
+	// Consistent tests failed on every attempt
+	Consistent []failedTest
+	// Unrerunnable packages failed without a failing test (build errors,
+	// TestMain panics, timeouts outside a test) and were not rerun
+	Unrerunnable []string
+}
+
+// Failed reports whether the run should be considered failed
+func (o *rerunOutcome) Failed(flakesFatal bool) bool {
+	if len(o.Consistent) > 0 || len(o.Unrerunnable) > 0 {
+		return true
+	}
+	return flakesFatal && len(o.Flaky) > 0
+}
+
+// failedLeafTests returns the failing tests of results that have no failing
+// subtests. Rerunning a leaf reruns its parents too, so parents whose failure
+// was only caused by a subtest are not rerun on their own.
+func failedLeafTests(results *testResults) ([]failedTest, []string) {
+	var leaves []failedTest
+	var unrerunnable []string
+
+	for _, p := range results.Packages() {
+		var failed []string
+		for _, tc := range p.Tests() {
+			if tc.Result == resultFail {
+				failed = append(failed, tc.Name)
+			}
+		}
+
+		if len(failed) == 0 {
+			if p.Result == resultFail || p.BuildFailed {
+				unrerunnable = append(unrerunnable, p.Name)
+			}
+			continue
+		}
+
+		for _, name := range failed {
+			leaf := true
+			for _, other := range failed {
+				if strings.HasPrefix(other, name+"/") {
+					leaf = false
+					break
+				}
+			}
+			if leaf {
+				leaves = append(leaves, failedTest{Package: p.Name, Name: name})
+			}
+		}
+	}
+
+	return leaves, unrerunnable
+}
+
+// rerunPattern builds an anchored -run pattern matching exactly the given
+// tests, which must share the same top-level test. Each level is an anchored
+// alternation, e.g. ^TestX$/^(a|b)$, since go test matches -run patterns one
+// slash-separated level at a time.
+func rerunPattern(names []string) string {
+	var levels [][]string
+	seen := []map[string]bool{}
+
+	for _, name := range names {
+		for depth, elem := range strings.Split(name, "/") {
+			if depth == len(levels) {
+				levels = append(levels, nil)
+				seen = append(seen, map[string]bool{})
+			}
+			if !seen[depth][elem] {
+				seen[depth][elem] = true
+				levels[depth] = append(levels[depth], regexp.QuoteMeta(elem))
+			}
+		}
+	}
+
+	parts := make([]string, len(levels))
+	for i, elems := range levels {
+		if len(elems) == 1 {
+			parts[i] = "^" + elems[0] + "$"
+		} else {
+			parts[i] = "^(" + strings.Join(elems, "|") + ")$"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// rerunArgs derives the go test arguments for a rerun from the original
+// ones: package arguments and -run are dropped (the rerun names its own),
+// and so is -coverprofile, which would overwrite the full run's profile
+func rerunArgs(orig *testArgs) []string {
+	ta := orig.clone()
+	ta.remove("-run", "-coverprofile", "-json")
+	return append([]string{"test"}, ta.flagArgs()...)
+}
+
+// rerunFailedTests reruns the failing tests of results up to maxReruns
+// times, one go test invocation per package and top-level test, and
+// classifies each failure as flaky or consistent
+func (cfg *GoShimConfig) rerunFailedTests(ctx context.Context, goArgs []string, results *testResults, maxReruns int) (*rerunOutcome, error) {
+	ta, err := parseGoTestArgs(goArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, unrerunnable := failedLeafTests(results)
+	outcome := &rerunOutcome{Unrerunnable: unrerunnable}
+	base := rerunArgs(ta)
+	binaryArgs := ta.BinaryArgs
+
+	for attempt := 1; attempt <= maxReruns && len(pending) > 0; attempt++ {
+		fmt.Fprintf(stdout, "\n🔁 Rerunning %d failed %s (attempt %d/%d)\n",
+			len(pending), pluralize(len(pending), "test", "tests"), attempt, maxReruns)
+
+		rerun := newTestResults()
+		for _, group := range groupFailedTests(pending) {
+			args := append(append([]string{}, base...), "-run", rerunPattern(group.names), group.pkg)
+			args = append(args, binaryArgs...)
+			slogctx.Debug(ctx, "Rerunning failed tests", slog.String("package", group.pkg), slog.String("run", rerunPattern(group.names)))
+			// failures are judged from the events, not the exit status
+			_ = cfg.runGoTestJSON(ctx, "", args, rerun, nil)
+		}
+
+		var stillFailing []failedTest
+		for _, ft := range pending {
+			if rerunResult(rerun, ft) == resultPass {
+				ft.Attempts = attempt + 1
+				outcome.Flaky = append(outcome.Flaky, ft)
+				continue
+			}
+			stillFailing = append(stillFailing, ft)
+		}
+		pending = stillFailing
+	}
+
+	for _, ft := range pending {
+		ft.Attempts = maxReruns + 1
+		outcome.Consistent = append(outcome.Consistent, ft)
+	}
+
+	return outcome, nil
+}
+
+type failedTestGroup struct {
+	pkg   string
+	names []string
+}
+
+// groupFailedTests groups tests by package and top-level test, in a stable order
+func groupFailedTests(tests []failedTest) []failedTestGroup {
+	index := map[string]int{}
+	var groups []failedTestGroup
+	for _, ft := range tests {
+		root, _, _ := strings.Cut(ft.Name, "/")
+		key := ft.Package + " " + root
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, failedTestGroup{pkg: ft.Package})
+		}
+		groups[i].names = append(groups[i].names, ft.Name)
+	}
+	sort.SliceStable(groups, func(a, b int) bool { return groups[a].pkg < groups[b].pkg })
+	return groups
+}
+
+// rerunResult returns the result of ft in a rerun, or "" if it did not run
+func rerunResult(rerun *testResults, ft failedTest) string {
+	for _, p := range rerun.Packages() {
+		if p.Name != ft.Package {
+			continue
+		}
+		for _, tc := range p.Tests() {
+			if tc.Name == ft.Name {
+				return tc.Result
+			}
+		}
+	}
+	return ""
+}
+
+// printRerunSummary lists flaky and consistently failing tests
+func printRerunSummary(out io.Writer, o *rerunOutcome) {
+	if len(o.Flaky) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "=== Flaky (passed on rerun)")
+		for _, ft := range o.Flaky {
+			fmt.Fprintf(out, "🔁 %s (passed on attempt %d)\n", ft, ft.Attempts)
+		}
+	}
+
+	if len(o.Consistent) > 0 || len(o.Unrerunnable) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "=== Consistent failures")
+		for _, ft := range o.Consistent {
+			fmt.Fprintf(out, "❌ %s (failed all %d attempts)\n", ft, ft.Attempts)
+		}
+		for _, pkg := range o.Unrerunnable {
+			fmt.Fprintf(out, "❌ %s (package failed, not rerun)\n", pkg)
+		}
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "RERUN %d flaky, %d consistent %s\n",
+		len(o.Flaky), len(o.Consistent)+len(o.Unrerunnable),
+		pluralize(len(o.Consistent)+len(o.Unrerunnable), "failure", "failures"))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRerunPattern(t *testing.T) {
+	tests := []struct {
+		name  string
+		tests []string
+		want  string
+	}{
+		{
+			name:  "top level test",
+			tests: []string{"TestA"},
+			want:  "^TestA$",
+		},
+		{
+			name:  "single subtest",
+			tests: []string{"TestA/sub_one"},
+			want:  "^TestA$/^sub_one$",
+		},
+		{
+			name:  "several subtests",
+			tests: []string{"TestA/one", "TestA/two"},
+			want:  "^TestA$/^(one|two)$",
+		},
+		{
+			name:  "regex metacharacters are quoted",
+			tests: []string{"TestA/sub_(x)+1"},
+			want:  `^TestA$/^sub_\(x\)\+1$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rerunPattern(tt.tests)
+			assert.Equal(t, tt.want, got)
+			for _, elem := range regexpLevels(got) {
+				_, err := regexp.Compile(elem)
+				assert.NoError(t, err, "each level should be a valid regex")
+			}
+		})
+	}
+}
+
+// regexpLevels splits a generated pattern into its per-level expressions
+func regexpLevels(pattern string) []string {
+	var levels []string
+	start := 0
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '/' && i > 0 && pattern[i-1] == '$' {
+			levels = append(levels, pattern[start:i])
+			start = i + 1
+		}
+	}
+	return append(levels, pattern[start:])
+}
+
+func TestRerunArgs(t *testing.T) {
+	ta, err := parseGoTestArgs([]string{
+		"test", "-v", "-run", "TestOld", "-timeout", "5m", "-coverprofile=c.out",
+		"-exec=go tool codesign --", "-tags", "integration", "./...", "example.com/pkg",
+	})
+	require.NoError(t, err)
+	got := rerunArgs(ta)
+
+	assert.Equal(t, []string{
+		"test", "-v", "-timeout", "5m", "-exec=go tool codesign --", "-tags", "integration",
+	}, got, "packages, -run and -coverprofile should be dropped")
+}
+
+func TestFailedLeafTests(t *testing.T) {
+	leaves, unrerunnable := failedLeafTests(loadSampleResults(t, nil))
+
+	assert.Equal(t, []failedTest{{Package: "example.com/a", Name: "TestBad/sub_one"}}, leaves,
+		"parents failing only because of a subtest should not be rerun")
+	assert.Equal(t, []string{"example.com/b"}, unrerunnable, "build failures cannot be rerun")
+}
+
+func TestRerunOutcome(t *testing.T) {
+	flaky := &rerunOutcome{Flaky: []failedTest{{Package: "p", Name: "TestA", Attempts: 2}}}
+	assert.False(t, flaky.Failed(false), "flakes should not fail the run by default")
+	assert.True(t, flaky.Failed(true), "flakes should fail the run when fatal")
+
+	consistent := &rerunOutcome{Consistent: []failedTest{{Package: "p", Name: "TestB", Attempts: 3}}}
+	assert.True(t, consistent.Failed(false))
+
+	var buf bytes.Buffer
+	printRerunSummary(&buf, &rerunOutcome{Flaky: flaky.Flaky, Consistent: consistent.Consistent})
+	assert.Contains(t, buf.String(), "🔁 p TestA (passed on attempt 2)")
+	assert.Contains(t, buf.String(), "❌ p TestB (failed all 3 attempts)")
+	assert.Contains(t, buf.String(), "RERUN 1 flaky, 1 consistent failure\n")
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shardHistoryWindow is the number of recent passing runs whose durations
+// weigh a test when balancing shards
+const shardHistoryWindow = 10
+
+// testShard is one of Count shards, numbered from 1 as written in -shard=i/n
+type testShard struct {
+	Index int
+	Count int
+}
+
+// parseTestShard parses an i/n shard spec
+func parseTestShard(spec string) (testShard, error) {
+	i, n, ok := strings.Cut(spec, "/")
+	index, errI := strconv.Atoi(i)
+	count, errN := strconv.Atoi(n)
+	if !ok || errI != nil || errN != nil || count < 1 || index < 1 || index > count {
+		return testShard{}, fmt.Errorf("invalid -shard value: %q (want i/n with 1 <= i <= n)", spec)
+	}
+	return testShard{Index: index, Count: count}, nil
+}
+
+func (s testShard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// reportPath inserts the shard into a report file name, so shards sharing a
+// directory do not overwrite each other: report.json becomes
+// report.shard-1-of-4.json
+func (s testShard) reportPath(path string) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.shard-%d-of-%d%s", strings.TrimSuffix(path, ext), s.Index, s.Count, ext)
+}
+
+// shardHash places an item without history on a shard
+func shardHash(item string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(item))
+	return h.Sum32()
+}
+
+// assignShards partitions items into count shards. With a weight for any of
+// the items it balances them longest first onto the least loaded shard
+// (items without history weigh the mean of the known ones, ties go to the
+// shard with fewer items); otherwise it
+// spreads them by hash. Both are deterministic, so every runner computes the
+// same partition as long as they see the same history. It reports whether
+// weights were used.
+func assignShards(items []string, count int, weights map[string]time.Duration) ([][]string, bool) {
+	shards := make([][]string, count)
+
+	var known int
+	var total time.Duration
+	for _, item := range items {
+		if w, ok := weights[item]; ok {
+			known++
+			total += w
+		}
+	}
+	if known == 0 {
+		for _, item := range items {
+			i := shardHash(item) % uint32(count)
+			shards[i] = append(shards[i], item)
+		}
+		for _, shard := range shards {
+			sort.Strings(shard)
+		}
+		return shards, false
+	}
+
+	weight := func(item string) time.Duration {
+		if w, ok := weights[item]; ok {
+			return w
+		}
+		return total / time.Duration(known)
+	}
+	sorted := slices.Clone(items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		wi, wj := weight(sorted[i]), weight(sorted[j])
+		if wi != wj {
+			return wi > wj
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	loads := make([]time.Duration, count)
+	for _, item := range sorted {
+		i := 0
+		for j := range loads {
+			// fewer items breaks ties, so tests too fast to time still spread
+			if loads[j] < loads[i] || loads[j] == loads[i] && len(shards[j]) < len(shards[i]) {
+				i = j
+			}
+		}
+		shards[i] = append(shards[i], item)
+		loads[i] += weight(item)
+	}
+	for _, shard := range shards {
+		sort.Strings(shard)
+	}
+	return shards, true
+}
+
+// historyShardWeights returns the recent mean duration of top-level tests
+// from the test history, summed per package or, when byTest is set, per test
+// name across packages
+func historyShardWeights(stats []*testHistoryStats, byTest bool) map[string]time.Duration {
+	weights := map[string]time.Duration{}
+	for _, s := range stats {
+		if isSubtest(s.Name) || len(s.Durations) == 0 {
+			continue
+		}
+		key := s.Package
+		if byTest {
+			key = s.Name
+		}
+		weights[key] += meanDuration(recentDurations(s, shardHistoryWindow))
+	}
+	return weights
+}
+
+// listedTestName matches the functions go test -list reports that -run
+// selects; benchmarks only run with -bench
+var listedTestName = regexp.MustCompile(`^(Test|Example|Fuzz)\S*$`)
+
+// parseTestList reads go test -list output: each package's test names
+// followed by its "ok" line
+func parseTestList(output string) map[string][]string {
+	tests := map[string][]string{}
+	var names []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 2 && fields[0] == "ok":
+			if len(names) > 0 {
+				tests[fields[1]] = append(tests[fields[1]], names...)
+			}
+			names = nil
+		case len(fields) >= 2 && fields[0] == "?":
+			names = nil
+		case listedTestName.MatchString(line):
+			names = append(names, line)
+		}
+	}
+	return tests
+}
+
+// listTests lists the top-level tests of packages with go test -list,
+// building them with the same tags and module flags as the test run
+func (cfg *GoShimConfig) listTests(ctx context.Context, ta *testArgs, packages []string) (map[string][]string, error) {
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"test", "-list", ".", "-vet=off"}
+	for _, f := range ta.Flags {
+		switch f.Name {
+		case "-tags", "-mod", "-modfile", "-overlay":
+			args = append(args, f.raw...)
+		}
+	}
+	args = append(args, packages...)
+
+	cmd := exec.CommandContext(ctx, goPath, args...)
+	cmd.Dir = ta.value("-C")
+	cmd.Env = os.Environ()
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tests: %w", err)
+	}
+	return parseTestList(string(out)), nil
+}
+
+// listImportPaths resolves package patterns relative to dir ("" for the
+// current directory) to import paths with go list
+func (cfg *GoShimConfig) listImportPaths(ctx context.Context, dir string, patterns []string) ([]string, error) {
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, goPath, append([]string{"list", "-e", "-f", "{{.ImportPath}}"}, patterns...)...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages %s: %w", strings.Join(patterns, " "), err)
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+// applyTestShard narrows ta to the packages, or with byTest the top-level
+// tests, of one shard. Without package arguments the package of the current
+// directory is sharded, with workspace every workspace package. It returns
+// false when the shard has nothing to run.
+func (cfg *GoShimConfig) applyTestShard(ctx context.Context, ta *testArgs, shard testShard, byTest, workspace bool) (bool, error) {
+	var packages []string
+	if workspace {
+		pkgs, err := cfg.listWorkspacePackages(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range pkgs {
+			if !p.DepOnly && !p.Standard {
+				packages = append(packages, p.ImportPath)
+			}
+		}
+	} else {
+		patterns := ta.Packages
+		if len(patterns) == 0 {
+			patterns = []string{"."}
+		}
+		var err error
+		if packages, err = cfg.listImportPaths(ctx, ta.value("-C"), patterns); err != nil {
+			return false, err
+		}
+	}
+
+	// Durations of past runs balance the shards; no history means hashing.
+	// Shard runs are left out: a shard finishing before another starts must
+	// not change the partition the other one computes.
+	runs, err := loadTestHistory(cfg.historyFile(), time.Time{})
+	if err != nil {
+		return false, err
+	}
+	runs = slices.DeleteFunc(runs, func(run historyRun) bool { return run.Shard != "" })
+	weights := historyShardWeights(aggregateTestHistory(runs), byTest)
+
+	how := "by hash"
+	if !byTest {
+		shards, balanced := assignShards(packages, shard.Count, weights)
+		if balanced {
+			how = "balanced by test history"
+		}
+		ta.Packages = shards[shard.Index-1]
+		fmt.Fprintf(stdout, "🧩 Shard %s: %d of %d %s (%s)\n",
+			shard, len(ta.Packages), len(packages), pluralize(len(packages), "package", "packages"), how)
+		return len(ta.Packages) > 0, nil
+	}
+
+	// Every name lands on exactly one shard, so a single -run pattern over
+	// the packages holding those names selects exactly this shard's tests
+	tests, err := cfg.listTests(ctx, ta, packages)
+	if err != nil {
+		return false, err
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, pkgTests := range tests {
+		for _, name := range pkgTests {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	shards, balanced := assignShards(names, shard.Count, weights)
+	if balanced {
+		how = "balanced by test history"
+	}
+	mine := shards[shard.Index-1]
+	ta.Packages = nil
+	for _, pkg := range packages {
+		if slices.ContainsFunc(tests[pkg], func(name string) bool { return slices.Contains(mine, name) }) {
+			ta.Packages = append(ta.Packages, pkg)
+		}
+	}
+	fmt.Fprintf(stdout, "🧩 Shard %s: %d of %d %s in %d %s (%s)\n",
+		shard, len(mine), len(names), pluralize(len(names), "test", "tests"),
+		len(ta.Packages), pluralize(len(ta.Packages), "package", "packages"), how)
+	if len(mine) == 0 {
+		return false, nil
+	}
+
+	quoted := make([]string, len(mine))
+	for i, name := range mine {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	ta.add("-run", "^("+strings.Join(quoted, "|")+")$")
+	return true, nil
+}
+
+// mergeTestReports combines shard reports into one. Packages split across
+// shards are merged: tests and output are joined, the package fails if any
+// part failed, and its coverage is dropped unless all parts agree.
+func mergeTestReports(reports []*testReport) *testReport {
+	merged := &testReport{Packages: []reportPackage{}}
+	var end time.Time
+	index := map[string]int{}
+	for _, r := range reports {
+		if merged.Started.IsZero() || r.Started.Before(merged.Started) {
+			merged.Started = r.Started
+		}
+		if e := r.Started.Add(secondsToDuration(r.Elapsed)); e.After(end) {
+			end = e
+		}
+		merged.Totals.Tests += r.Totals.Tests
+		merged.Totals.Passed += r.Totals.Passed
+		merged.Totals.Failed += r.Totals.Failed
+		merged.Totals.Skipped += r.Totals.Skipped
+		merged.Flaky = append(merged.Flaky, r.Flaky...)
+
+		for _, p := range r.Packages {
+			i, ok := index[p.Name]
+			if !ok {
+				index[p.Name] = len(merged.Packages)
+				merged.Packages = append(merged.Packages, p)
+				continue
+			}
+			m := &merged.Packages[i]
+			m.Result = mergeResult(m.Result, p.Result)
+			m.Elapsed += p.Elapsed
+			m.Cached = m.Cached && p.Cached
+			m.NoTestFiles = m.NoTestFiles && p.NoTestFiles
+			if m.Coverage != p.Coverage {
+				m.Coverage = ""
+			}
+			m.BuildFailed = m.BuildFailed || p.BuildFailed
+			m.BuildOutput = append(m.BuildOutput, p.BuildOutput...)
+			m.Output = append(m.Output, p.Output...)
+			m.Tests = append(m.Tests, p.Tests...)
+		}
+	}
+	merged.Elapsed = end.Sub(merged.Started).Seconds()
+	sort.SliceStable(merged.Packages, func(i, j int) bool { return merged.Packages[i].Name < merged.Packages[j].Name })
+	return merged
+}
+
+// mergeResult combines the results of two parts of a package
+func mergeResult(a, b string) string {
+	switch {
+	case a == resultFail || b == resultFail:
+		return resultFail
+	case a == resultPass || b == resultPass:
+		return resultPass
+	}
+	return a
+}
+
+// handleMergeReports implements goshim test merge-reports
+func (cfg *GoShimConfig) handleMergeReports(args []string) error {
+	fs := flag.NewFlagSet("merge-reports", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	jsonFile := fs.String("o", "", "write the merged JSON report to this file")
+	junitFile := fs.String("junit", "", "write the merged report as JUnit XML to this file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: goshim test merge-reports [-o merged.json] [-junit merged.xml] <report.json>...")
+	}
+
+	var reports []*testReport
+	for _, path := range fs.Args() {
+		report, err := readJSONReport(path)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, report)
+	}
+	merged := mergeTestReports(reports)
+
+	fmt.Fprintf(stdout, "🧩 Merged %d %s: %d %s, %d passed, %d failed, %d skipped\n",
+		len(reports), pluralize(len(reports), "report", "reports"),
+		merged.Totals.Tests, pluralize(merged.Totals.Tests, "test", "tests"),
+		merged.Totals.Passed, merged.Totals.Failed, merged.Totals.Skipped)
+
+	if *jsonFile != "" {
+		if err := writeJSONReport(*jsonFile, merged); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "📄 JSON report: %s\n", *jsonFile)
+	}
+	if *junitFile != "" {
+		if err := writeJUnitReport(*junitFile, merged); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "📄 JUnit report: %s\n", *junitFile)
+	}
+	return nil
+}
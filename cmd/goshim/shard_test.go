@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTestShard(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    testShard
+		wantErr bool
+	}{
+		{spec: "1/4", want: testShard{Index: 1, Count: 4}},
+		{spec: "4/4", want: testShard{Index: 4, Count: 4}},
+		{spec: "1/1", want: testShard{Index: 1, Count: 1}},
+		{spec: "0/4", wantErr: true},
+		{spec: "5/4", wantErr: true},
+		{spec: "1/0", wantErr: true},
+		{spec: "1", wantErr: true},
+		{spec: "a/b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseTestShard(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.spec, got.String())
+		})
+	}
+}
+
+func TestTestShardReportPath(t *testing.T) {
+	s := testShard{Index: 2, Count: 4}
+	assert.Equal(t, "out/report.shard-2-of-4.json", s.reportPath("out/report.json"))
+	assert.Equal(t, "junit.shard-2-of-4.xml", s.reportPath("junit.xml"))
+	assert.Equal(t, "report.shard-2-of-4", s.reportPath("report"))
+}
+
+func TestAssignShards(t *testing.T) {
+	var items []string
+	for i := range 20 {
+		items = append(items, fmt.Sprintf("example.com/m/pkg%02d", i))
+	}
+
+	t.Run("hash", func(t *testing.T) {
+		shards, balanced := assignShards(items, 3, nil)
+		assert.False(t, balanced)
+		reversed := slices.Clone(items)
+		slices.Reverse(reversed)
+		again, _ := assignShards(reversed, 3, nil)
+		assert.Equal(t, shards, again, "the partition must not depend on input order")
+
+		var all []string
+		for _, shard := range shards {
+			all = append(all, shard...)
+		}
+		assert.ElementsMatch(t, items, all, "every item lands on exactly one shard")
+	})
+
+	t.Run("history", func(t *testing.T) {
+		weights := map[string]time.Duration{
+			"slow":   8 * time.Second,
+			"medium": 5 * time.Second,
+			"fast1":  4 * time.Second,
+			"fast2":  3 * time.Second,
+		}
+		shards, balanced := assignShards([]string{"fast1", "fast2", "medium", "slow", "unknown"}, 2, weights)
+		assert.True(t, balanced)
+		// longest first onto the lighter shard: slow 8s, medium 5s, unknown
+		// (mean of the known, 5s) 5+5s, fast1 8+4s, fast2 10+3s
+		assert.Equal(t, [][]string{{"fast1", "slow"}, {"fast2", "medium", "unknown"}}, shards)
+	})
+
+	t.Run("untimed tests spread evenly", func(t *testing.T) {
+		weights := map[string]time.Duration{"a": 0, "b": 0, "c": 0, "d": 0}
+		shards, _ := assignShards([]string{"a", "b", "c", "d"}, 2, weights)
+		assert.Equal(t, [][]string{{"a", "c"}, {"b", "d"}}, shards)
+	})
+
+	t.Run("more shards than items", func(t *testing.T) {
+		shards, _ := assignShards([]string{"a"}, 3, map[string]time.Duration{"a": time.Second})
+		assert.Equal(t, [][]string{{"a"}, nil, nil}, shards)
+	})
+}
+
+func TestHistoryShardWeights(t *testing.T) {
+	base := time.Now()
+	stats := aggregateTestHistory([]historyRun{
+		historyRunAt(base,
+			historyTest{Package: "p1", Name: "TestA", Result: resultPass, Elapsed: 1},
+			historyTest{Package: "p1", Name: "TestA/sub", Result: resultPass, Elapsed: 1},
+			historyTest{Package: "p1", Name: "TestB", Result: resultPass, Elapsed: 2},
+			historyTest{Package: "p2", Name: "TestA", Result: resultPass, Elapsed: 4},
+			historyTest{Package: "p2", Name: "TestBroken", Result: resultFail, Elapsed: 9},
+		),
+		historyRunAt(base.Add(time.Minute),
+			historyTest{Package: "p1", Name: "TestA", Result: resultPass, Elapsed: 3},
+		),
+	})
+
+	assert.Equal(t, map[string]time.Duration{"p1": 4 * time.Second, "p2": 4 * time.Second}, historyShardWeights(stats, false))
+	assert.Equal(t, map[string]time.Duration{"TestA": 6 * time.Second, "TestB": 2 * time.Second}, historyShardWeights(stats, true))
+}
+
+func TestParseTestList(t *testing.T) {
+	output := "TestA\nTestB\nExampleA\nBenchmarkA\nFuzzA\nok  \texample.com/m/a\t0.003s\n" +
+		"?   \texample.com/m/c\t[no test files]\n" +
+		"TestC\nok  \texample.com/m/b\t(cached)\n"
+	assert.Equal(t, map[string][]string{
+		"example.com/m/a": {"TestA", "TestB", "ExampleA", "FuzzA"},
+		"example.com/m/b": {"TestC"},
+	}, parseTestList(output))
+}
+
+func TestGoShimConfig_applyTestShard(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOTOOLCHAIN", "local")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":      "module example.com/s\n\ngo 1.24\n",
+		"a/a_test.go": "package a\n\nimport \"testing\"\n\nfunc TestA1(t *testing.T) {}\nfunc TestA2(t *testing.T) {}\n",
+		"b/b_test.go": "package b\n\nimport \"testing\"\n\nfunc TestB1(t *testing.T) {}\nfunc TestA1(t *testing.T) {}\n",
+		"c/c.go":      "package c\n",
+	})
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	require.NoError(t, os.Chdir(root))
+
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+
+	t.Run("packages", func(t *testing.T) {
+		var all []string
+		for i := 1; i <= 2; i++ {
+			ta, err := parseTestArgs([]string{"./..."})
+			require.NoError(t, err)
+			_, err = cfg.applyTestShard(t.Context(), ta, testShard{Index: i, Count: 2}, false, false)
+			require.NoError(t, err)
+			all = append(all, ta.Packages...)
+		}
+		assert.ElementsMatch(t, []string{"example.com/s/a", "example.com/s/b", "example.com/s/c"}, all)
+	})
+
+	t.Run("tests", func(t *testing.T) {
+		// history from a full run balances the three test names over 3 shards
+		require.NoError(t, cfg.recordTestHistory(resultsWithTests(
+			[2]string{"example.com/s/a", "TestA1"},
+			[2]string{"example.com/s/a", "TestA2"},
+			[2]string{"example.com/s/b", "TestB1"},
+		), []string{"test", "./..."}, ""))
+
+		var patterns []string
+		for i := 1; i <= 3; i++ {
+			ta, err := parseTestArgs([]string{"./..."})
+			require.NoError(t, err)
+			ok, err := cfg.applyTestShard(t.Context(), ta, testShard{Index: i, Count: 3}, true, false)
+			require.NoError(t, err)
+			require.True(t, ok)
+			patterns = append(patterns, ta.value("-run"))
+			if ta.value("-run") == "^(TestA1)$" {
+				// TestA1 exists in both packages, both run it on the same shard
+				assert.Equal(t, []string{"example.com/s/a", "example.com/s/b"}, ta.Packages)
+			}
+		}
+		assert.ElementsMatch(t, []string{"^(TestA1)$", "^(TestA2)$", "^(TestB1)$"}, patterns)
+		assert.Contains(t, buf.String(), "balanced by test history")
+	})
+}
+
+// resultsWithTests returns results of passing top-level tests, given as
+// package and name pairs
+func resultsWithTests(tests ...[2]string) *testResults {
+	results := newTestResults()
+	for _, pt := range tests {
+		for _, action := range []string{"run", resultPass} {
+			results.add(testEvent{Action: action, Package: pt[0], Test: pt[1], Elapsed: 0.5})
+		}
+	}
+	return results
+}
+
+func TestMergeTestReports(t *testing.T) {
+	start := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	shard1 := &testReport{
+		Started: start,
+		Elapsed: 30,
+		Totals:  reportTotals{Tests: 2, Passed: 2},
+		Packages: []reportPackage{
+			{Name: "example.com/b", Result: resultPass, Elapsed: 1, Coverage: "50.0% of statements", Tests: []reportTest{{Name: "TestB", Result: resultPass}}},
+			{Name: "example.com/a", Result: resultPass, Elapsed: 2, Coverage: "80.0% of statements", Tests: []reportTest{{Name: "TestA1", Result: resultPass}}},
+		},
+	}
+	shard2 := &testReport{
+		Started: start.Add(5 * time.Second),
+		Elapsed: 40,
+		Totals:  reportTotals{Tests: 1, Failed: 1},
+		Packages: []reportPackage{
+			{Name: "example.com/a", Result: resultFail, Elapsed: 3, Coverage: "60.0% of statements", Output: []string{"FAIL\n"}, Tests: []reportTest{{Name: "TestA2", Result: resultFail}}},
+		},
+		Flaky: []reportFlaky{{Package: "example.com/a", Test: "TestA2", Attempts: 2}},
+	}
+
+	merged := mergeTestReports([]*testReport{shard1, shard2})
+	assert.Equal(t, start, merged.Started)
+	assert.Equal(t, 45.0, merged.Elapsed, "shards ran in parallel, so elapsed is wall clock")
+	assert.Equal(t, reportTotals{Tests: 3, Passed: 2, Failed: 1}, merged.Totals)
+	assert.Len(t, merged.Flaky, 1)
+	require.Len(t, merged.Packages, 2)
+
+	a := merged.Packages[0]
+	assert.Equal(t, "example.com/a", a.Name)
+	assert.Equal(t, resultFail, a.Result)
+	assert.Equal(t, 5.0, a.Elapsed)
+	assert.Empty(t, a.Coverage, "coverage of different test subsets cannot be combined")
+	assert.Equal(t, []string{"FAIL\n"}, a.Output)
+	assert.Equal(t, []reportTest{{Name: "TestA1", Result: resultPass}, {Name: "TestA2", Result: resultFail}}, a.Tests)
+	assert.Equal(t, "50.0% of statements", merged.Packages[1].Coverage)
+}
+
+func TestGoShimConfig_handleMergeReports(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i, report := range []*testReport{
+		{Totals: reportTotals{Tests: 1, Passed: 1}, Packages: []reportPackage{{Name: "example.com/a", Result: resultPass, Tests: []reportTest{{Name: "TestA", Result: resultPass}}}}},
+		{Totals: reportTotals{Tests: 1, Skipped: 1}, Packages: []reportPackage{{Name: "example.com/b", Result: resultPass, Tests: []reportTest{{Name: "TestB", Result: resultSkip}}}}},
+	} {
+		path := filepath.Join(dir, fmt.Sprintf("report.shard-%d-of-2.json", i+1))
+		require.NoError(t, writeJSONReport(path, report))
+		paths = append(paths, path)
+	}
+
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	cfg := &GoShimConfig{WorkspaceRoot: dir}
+	out := filepath.Join(dir, "merged.json")
+	junit := filepath.Join(dir, "merged.xml")
+	require.NoError(t, cfg.handleTest(t.Context(), append([]string{"test", "merge-reports", "-o", out, "-junit", junit}, paths...)))
+
+	assert.Contains(t, buf.String(), "🧩 Merged 2 reports: 2 tests, 1 passed, 0 failed, 1 skipped")
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var merged testReport
+	require.NoError(t, json.Unmarshal(data, &merged))
+	assert.Len(t, merged.Packages, 2)
+	assert.FileExists(t, junit)
+
+	assert.Error(t, cfg.handleTest(t.Context(), []string{"test", "merge-reports"}), "reports are required")
+}
+
+func TestGoShimConfig_handleTestShardFlags(t *testing.T) {
+	cfg := &GoShimConfig{WorkspaceRoot: t.TempDir()}
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"test", "-shard=5/4"}, wantErr: "invalid -shard value"},
+		{args: []string{"test", "-shard=1/2", "-shard-by=module"}, wantErr: "invalid -shard-by value"},
+		{args: []string{"test", "-shard=1/2", "-watch"}, wantErr: "-shard cannot be combined with -watch"},
+		{args: []string{"test", "-shard=1/2", "-shard-by=test", "-run", "TestA"}, wantErr: "-run is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantErr, func(t *testing.T) {
+			assert.ErrorContains(t, cfg.handleTest(t.Context(), tt.args), tt.wantErr)
+		})
+	}
+}
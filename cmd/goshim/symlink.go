@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -45,7 +46,7 @@ func addSelfAsGoToPath(command Command) ([]string, string, func(), error) {
 	if err != nil {
 		return nil, "", nil, fmt.Errorf("set PATH: %w", err)
 	}
-	fmt.Printf("I am %s, added %s to PATH as a symlink\n", executable, updatedPath)
+	slog.Debug("Added self to PATH as go", slog.String("executable", executable), slog.String("dir", tmpDir))
 
 	updatedEnv := append([]string{"PATH=" + updatedPath, "GOSHIM_CALLED_BY=" + string(command)}, os.Environ()...)
 
@@ -3,54 +3,18 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
-)
 
-// hasGotestsum checks if gotestsum is available
-func (cfg *GoShimConfig) hasGotestsum() bool {
-	// Check if we can run gotestsum via go tool
-	goPath, err := cfg.findSafeGo()
-	if err != nil {
-		return false
-	}
-
-	cmd := exec.Command(goPath, "tool", "gotest.tools/gotestsum", "--version")
-	cmd.Dir = cfg.WorkspaceRoot
-	return cmd.Run() == nil
-}
-
-// runWithGotestsum runs tests using gotestsum from project tools
-func (cfg *GoShimConfig) runWithGotestsum(ctx context.Context, goArgs []string) error {
-	goPath, err := cfg.findSafeGo()
-	if err != nil {
-		return err
-	}
-
-	// Build gotestsum command - remove "test" from goArgs since gotestsum adds it
-	testArgs := goArgs[1:] // Skip the "test" command
-
-	args := []string{
-		"tool", "gotest.tools/gotestsum",
-		"--format", "pkgname",
-		"--format-icons", "hivis",
-		"--", // Separator for go test flags
-	}
-	args = append(args, testArgs...)
-
-	cmd := exec.CommandContext(ctx, goPath, args...)
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-	cmd.Stdin = stdin
-	cmd.Dir = cfg.WorkspaceRoot
-
-	return cmd.Run()
-}
+	slogctx "github.com/veqryn/slog-context"
+)
 
 // handleTest processes test commands
-func (cfg *GoShimConfig) handleTest(args []string) error {
+func (cfg *GoShimConfig) handleTest(ctx context.Context, args []string) error {
 	var functionCoverage bool
 	var force bool
 	var root bool
@@ -60,230 +24,284 @@ func (cfg *GoShimConfig) handleTest(args []string) error {
 	var codesignEntitlements arrayFlags
 	var codesignIdentity string
 	var codesignForce bool
-	var isCompileOnly bool
-	// var outputFile string
+	var junitFile string
+	var reportJSONFile string
+	var reruns int
+	var flakesFatal bool
+	var minCoverage []coverageThreshold
+	var keepCoverProfile bool
+	var coverageDiffRef string
+	var coverageDiffMin float64
+	var workspace bool
+	var changedRef string
+	var watch bool
+	var shardSpec string
+	shardBy := "package"
+	workspaceJobs := 1
 
 	isCalledByDap := isNestedBy(CommandDap)
 
-	// Parse only goshim-specific flags, pass everything else through
-	var goArgs []string
-	goArgs = append(goArgs, "test")
+	if len(args) > 1 && args[1] == "merge-reports" {
+		return cfg.handleMergeReports(args[1:])
+	}
 
-	var codesignAdditionalArgs []string
+	// Default test flags from config go first so explicit args override them
+	if len(cfg.TestFlags) > 0 {
+		args = append(append([]string{args[0]}, cfg.TestFlags...), args[1:]...)
+	}
+
+	// Separate goshim's flags from what is passed through to go test
+	ta, err := parseTestArgs(args[1:])
+	if err != nil {
+		return err
+	}
 
-	// Skip "test" and process remaining args
-	i := 1
-	for i < len(args) {
-		arg := args[i]
+	var codesignAdditionalArgs []string
 
-		switch arg {
+	for _, f := range ta.Goshim {
+		switch f.Name {
 		case "-function-coverage":
-			functionCoverage = true
+			functionCoverage = f.enabled()
 		case "-force":
-			force = true
+			force = f.enabled()
 		case "-root":
-			root = true
+			root = f.enabled()
 		case "-ide":
-			ide = true
+			ide = f.enabled()
 		case "-codesign":
-			codesign = true
+			codesign = f.enabled()
 		case "-codesign-entitlement":
-			// Handle -codesign-entitlement with next argument
-			if i+1 < len(args) {
-				codesignEntitlements = append(codesignEntitlements, args[i+1])
-				i++ // Skip the entitlement value
-			}
+			codesignEntitlements = append(codesignEntitlements, f.Value)
 		case "-codesign-identity":
-			// Handle -codesign-identity with next argument
-			if i+1 < len(args) {
-				codesignIdentity = args[i+1]
-				i++ // Skip the identity value
-			}
+			codesignIdentity = f.Value
 		case "-codesign-force":
-			codesignForce = true
-		case "-o":
-			// outputFile = args[i+1]
-			// i++ // Skip the exec value
-			goArgs = append(goArgs, arg)
-		case "-c":
-			// Compile test binary only (used by DAP debugging)
-			isCompileOnly = true
-			goArgs = append(goArgs, arg)
-		case "-target":
-			// Handle -target with next argument
-			if i+1 < len(args) {
-				targetDir = args[i+1]
-				i++ // Skip the target value
-			}
-		case "-run":
-			// Handle -run with special processing for subtest patterns
-			if i+1 < len(args) {
-				runPattern := args[i+1]
-				// Fix VS Code subtest patterns that incorrectly match multiple test functions
-				// Pattern like "^TestHarpoon/bun_version$" should only match TestHarpoon, not TestHarpoonOCI
-				if strings.Contains(runPattern, "/") {
-					// Extract the test function name (part before the first "/")
-					parts := strings.SplitN(runPattern, "/", 2)
-					if len(parts) == 2 {
-						testFunc := parts[0]
-						subtest := parts[1]
-
-						// Remove leading ^ if present
-						if strings.HasPrefix(testFunc, "^") {
-							testFunc = testFunc[1:]
-						}
-
-						// Create a more precise pattern that ensures exact test function match
-						// Pattern: ^TestFunc$/^subtest$ ensures TestFunc is matched exactly, not as prefix
-						fixedPattern := "^" + testFunc + "$/" + subtest
-						if cfg.Verbose {
-							fmt.Printf("🔧 Fixed -run pattern: %s -> %s\n", runPattern, fixedPattern)
-						}
-						goArgs = append(goArgs, "-run", fixedPattern)
-						i++ // Skip the run pattern value
-						break
-					}
+			codesignForce = f.enabled()
+		case "-rerun-fails":
+			// -rerun-fails takes an optional count, so only the = form sets it
+			reruns = defaultReruns
+			if f.HasValue {
+				n, err := strconv.Atoi(f.Value)
+				if err != nil || n < 0 {
+					return fmt.Errorf("invalid -rerun-fails value: %q", f.Value)
 				}
-				// If no "/" or pattern doesn't match expected format, pass through as-is
-				goArgs = append(goArgs, "-run", runPattern)
-				i++ // Skip the run pattern value
+				reruns = n
+			}
+		case "-rerun-fails-fatal-flakes":
+			flakesFatal = f.enabled()
+		case "-min-coverage":
+			threshold, err := parseCoverageThreshold(f.Value)
+			if err != nil {
+				return err
+			}
+			minCoverage = append(minCoverage, threshold)
+		case "-coverage-diff":
+			coverageDiffRef = f.Value
+		case "-coverage-diff-min":
+			min, err := parseCoverageThreshold(f.Value)
+			if err != nil || min.Pattern != "" {
+				return fmt.Errorf("invalid -coverage-diff-min value: %q", f.Value)
+			}
+			coverageDiffMin = min.Min
+		case "-workspace":
+			workspace = f.enabled()
+		case "-workspace-jobs":
+			n, err := strconv.Atoi(f.Value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid -workspace-jobs value: %q", f.Value)
 			}
-		default:
-			// Pass through all other arguments to go test
-			goArgs = append(goArgs, arg)
-			if arg == "-o" {
-				goArgs = append(goArgs, arg)
-				i++ // Skip the exec value
+			workspaceJobs = n
+		case "-keep-coverprofile":
+			keepCoverProfile = f.enabled()
+		case "-junit":
+			junitFile = f.Value
+		case "-report-json":
+			reportJSONFile = f.Value
+		case "-target":
+			targetDir = f.Value
+		case "-watch":
+			watch = f.enabled()
+		case "-shard":
+			shardSpec = f.Value
+		case "-shard-by":
+			if f.Value != "package" && f.Value != "test" {
+				return fmt.Errorf("invalid -shard-by value: %q (want package or test)", f.Value)
+			}
+			shardBy = f.Value
+		case "-changed":
+			// -changed takes an optional git ref, so only the = form sets it
+			changedRef = "HEAD"
+			if f.HasValue {
+				changedRef = f.Value
 			}
 		}
-		i++
+	}
+
+	// A file:line position runs exactly the test enclosing it
+	positionOut := stdout
+	if ide {
+		positionOut = io.Discard
+	}
+	targetDir, err = applyTestPosition(ta, targetDir, positionOut)
+	if err != nil {
+		return err
+	}
+
+	// Compile test binary only (used by DAP debugging)
+	isCompileOnly := ta.has("-c")
+
+	// Anchor the top-level test names of subtest patterns, which VS Code
+	// writes as "^TestHarpoon/bun_version$" and so also selects TestHarpoonOCI
+	for i, f := range ta.Flags {
+		if f.Name != "-run" && f.Name != "-skip" {
+			continue
+		}
+		fixed, notes := rewriteTestPattern(f.Value)
+		if fixed == f.Value {
+			continue
+		}
+		slogctx.Debug(ctx, "Rewrote "+f.Name+" pattern",
+			slog.String("from", f.Value),
+			slog.String("to", fixed),
+			slog.String("why", strings.Join(notes, "; ")))
+		ta.Flags[i] = f.withValue(fixed)
+	}
+
+	// Watching picks the packages of every run itself and needs goshim's
+	// own rendering of the results
+	if watch {
+		if workspace || changedRef != "" || ide {
+			return fmt.Errorf("-watch cannot be combined with -workspace, -changed or -ide")
+		}
+		if ta.has("-json") || isCompileOnly {
+			return fmt.Errorf("-watch cannot be combined with -json or -c")
+		}
+	}
+
+	var shard testShard
+	if shardSpec != "" {
+		if shard, err = parseTestShard(shardSpec); err != nil {
+			return err
+		}
+		if watch {
+			return fmt.Errorf("-shard cannot be combined with -watch")
+		}
+		if shardBy == "test" && ta.has("-run") {
+			return fmt.Errorf("-shard-by=test selects tests itself, -run is not supported")
+		}
 	}
 
 	if root && os.Geteuid() != 0 {
 		return fmt.Errorf("root is required for -root flag")
 	}
 
-	if isCalledByDap {
-		if cfg.Verbose {
-			fmt.Printf("🔧 Debug mode: compiling test binary with go test -c\n")
-		}
+	// Fall back to configured codesign defaults
+	if len(codesignEntitlements) == 0 {
+		codesignEntitlements = cfg.Codesign.Entitlements
+	}
+	if codesignIdentity == "" {
+		codesignIdentity = cfg.Codesign.Identity
+	}
+	codesignForce = codesignForce || cfg.Codesign.Force
+
+	// IDE consumers, callers asking for -json and go test -c (used by dap)
+	// read the output as data, so never truncate or filter it
+	if ide || ta.has("-json") || isCompileOnly {
+		cfg.disableOutputTruncation()
+		cfg.disableOutputFilters()
 	}
 
 	// For compile-only mode (debugging), skip goshim enhancements and pass through directly
 	if isCompileOnly {
-		if cfg.Verbose {
-			fmt.Printf("🔧 Debug mode: compiling test binary with go test -c\n")
-		}
-
-		ctx := context.Background()
+		slogctx.Debug(ctx, "Debug mode: compiling test binary with go test -c", slog.Bool("called_by_dap", isCalledByDap))
 
 		// Add codesign support for debug builds
 		if codesign {
 			// Run the compile first
-			if err := cfg.execSafeGo(ctx, goArgs...); err != nil {
+			if err := cfg.execSafeGo(ctx, ta.goArgs()...); err != nil {
 				return err
 			}
 
-			var outputFile string
-
-			// Find the output binary and sign it
-			for i, arg := range goArgs {
-				if arg == "-o" && i+1 < len(goArgs) {
-					outputFile = goArgs[i+1]
-					if cfg.Verbose {
-						fmt.Printf("🔐 Code signing debug binary: %s\n", outputFile)
-					}
-
-					// Use new codesign syntax
-					signArgs := []string{"tool", "github.com/walteh/go-extras/cmd/codesign", "-mode=sign", "-target=" + outputFile}
-
-					// Add entitlements if specified, otherwise use default
-					if len(codesignEntitlements) > 0 {
-						for _, ent := range codesignEntitlements {
-							signArgs = append(signArgs, "-entitlement="+ent)
-						}
-					} else {
-						signArgs = append(signArgs, "-entitlement=virtualization")
-					}
-
-					// Add identity if specified
-					if codesignIdentity != "" {
-						signArgs = append(signArgs, "-identity="+codesignIdentity)
-					}
-
-					// Add force if specified
-					if codesignForce {
-						signArgs = append(signArgs, "-force")
-					}
-
-					signArgs = append(signArgs, codesignAdditionalArgs...)
-
-					signCmd := exec.CommandContext(ctx, "go", signArgs...)
-					signCmd.Dir = cfg.WorkspaceRoot
-					signCmd.Stdout = stdout
-					signCmd.Stderr = stderr
-
-					err := signCmd.Run()
-					if err != nil {
-						return fmt.Errorf("signing debug binary: %w", err)
-					}
-
-					return nil
-				}
+			// Sign the output binary, if it was written to a known path
+			if !ta.has("-o") {
+				return nil
+			}
+			outputFile := ta.value("-o")
+			slogctx.Debug(ctx, "Code signing debug binary", slog.String("binary", outputFile))
+
+			// Use new codesign syntax
+			signArgs := []string{"-mode=sign", "-target=" + outputFile}
+
+			for _, ent := range codesignEntitlements {
+				signArgs = append(signArgs, "-entitlement="+ent)
+			}
+
+			// Add identity if specified
+			if codesignIdentity != "" {
+				signArgs = append(signArgs, "-identity="+codesignIdentity)
+			}
+
+			// Add force if specified
+			if codesignForce {
+				signArgs = append(signArgs, "-force")
+			}
+
+			signArgs = append(signArgs, codesignAdditionalArgs...)
+
+			if err := cfg.runTool(ctx, "github.com/walteh/go-extras/cmd/codesign", signArgs...); err != nil {
+				return fmt.Errorf("signing debug binary: %w", err)
 			}
 
 			return nil
 		}
 
-		return cfg.execSafeGo(ctx, goArgs...)
+		return cfg.execSafeGo(ctx, ta.goArgs()...)
 	}
 
 	// Add goshim-specific functionality for regular test runs
-	if functionCoverage {
-		coverDir, err := os.MkdirTemp("", "goshim-coverage-*")
-		if err != nil {
-			return fmt.Errorf("failed to create temp coverage dir: %w", err)
-		}
-		defer os.RemoveAll(coverDir)
-
-		coverFile := filepath.Join(coverDir, "coverage.out")
-		goArgs = append(goArgs, "-coverprofile="+coverFile, "-covermode=atomic")
-
-		defer func() {
-			fmt.Println("================================================")
-			fmt.Println("Function Coverage")
-			fmt.Println("------------------------------------------------")
-
-			goPath, err := cfg.findSafeGo()
+	coverOpts := coverageOptions{
+		functions:  functionCoverage,
+		thresholds: minCoverage,
+		keep:       keepCoverProfile,
+		diffRef:    coverageDiffRef,
+		diffMin:    coverageDiffMin,
+	}
+	userCoverFile := ta.value("-coverprofile")
+	var coverFile string
+	if coverOpts.enabled() {
+		// Analyze the caller's own profile if they asked for one, and keep it
+		coverFile = userCoverFile
+		if coverFile == "" {
+			coverDir, err := os.MkdirTemp("", "goshim-coverage-*")
 			if err != nil {
-				fmt.Printf("Error finding go executable: %v\n", err)
-				return
+				return fmt.Errorf("failed to create temp coverage dir: %w", err)
+			}
+			if !keepCoverProfile {
+				defer os.RemoveAll(coverDir)
 			}
 
-			coverCmd := exec.Command(goPath, "tool", "cover", "-func="+coverFile)
-			coverCmd.Stdout = stdout
-			coverCmd.Stderr = stderr
-			coverCmd.Run()
-
-			fmt.Println("================================================")
-		}()
+			coverFile = filepath.Join(coverDir, "coverage.out")
+			ta.add("-coverprofile", coverFile)
+			ta.add("-covermode", "atomic")
+		}
 	}
 
 	if force {
-		goArgs = append(goArgs, "-count=1")
+		ta.add("-count", "1")
 	}
 
 	if codesign {
+		// Build the codesign tool once instead of once per test binary
+		codesignCmd, cleanup, err := cfg.toolExecCommand(ctx, "github.com/walteh/ec1/tools/cmd/codesign")
+		if err != nil {
+			return fmt.Errorf("failed to prepare codesign tool: %w", err)
+		}
+		defer cleanup()
+
 		// Use new codesign test mode
-		execArgs := []string{"tool", "github.com/walteh/ec1/tools/cmd/codesign", "-mode=test"}
+		execArgs := []string{codesignCmd, "-mode=test"}
 
-		// Add entitlements if specified, otherwise use default
-		if len(codesignEntitlements) > 0 {
-			for _, ent := range codesignEntitlements {
-				execArgs = append(execArgs, "-entitlement="+ent)
-			}
-		} else {
-			execArgs = append(execArgs, "-entitlement=virtualization")
+		for _, ent := range codesignEntitlements {
+			execArgs = append(execArgs, "-entitlement="+ent)
 		}
 
 		// Add identity if specified
@@ -302,53 +320,165 @@ func (cfg *GoShimConfig) handleTest(args []string) error {
 
 		execArgs = append(execArgs, "--")
 
-		goArgs = append(goArgs, "-exec=go "+strings.Join(execArgs, " "))
+		ta.add("-exec", strings.Join(execArgs, " "))
 	}
 
 	// Add standard flags if not already present
 	hasVet := false
 	hasCover := false
-	for _, arg := range goArgs {
-		if strings.Contains(arg, "-vet") {
+	for _, f := range ta.Flags {
+		if f.Name == "-vet" {
 			hasVet = true
 		}
-		if strings.Contains(arg, "-cover") {
+		if strings.HasPrefix(f.Name, "-cover") {
 			hasCover = true
 		}
 	}
 
 	if !hasVet {
-		goArgs = append(goArgs, "-vet=all")
+		ta.add("-vet", "all")
 	}
 	if !hasCover {
-		goArgs = append(goArgs, "-cover")
+		ta.addBool("-cover")
+	}
+
+	// Select packages affected by git changes; the selection already spans
+	// every workspace module, so it replaces -workspace
+	if changedRef != "" {
+		if len(ta.Packages) > 0 || targetDir != "" {
+			return fmt.Errorf("-changed selects packages itself, package arguments and -target are not supported")
+		}
+		pkgs, err := cfg.changedPackages(ctx, changedRef)
+		if err != nil {
+			return err
+		}
+		if len(pkgs) == 0 {
+			return nil
+		}
+		ta.Packages = pkgs
+		workspace = false
 	}
 
 	// Add target directory if specified and no other targets present
+	if workspace {
+		if targetDir != "" {
+			return fmt.Errorf("-target cannot be combined with -workspace")
+		}
+		if len(ta.Packages) > 0 {
+			return fmt.Errorf("-workspace runs ./... in every module, package arguments are not supported: %s", strings.Join(ta.Packages, " "))
+		}
+	}
 	if targetDir != "" {
-		goArgs = append(goArgs, targetDir)
+		if len(ta.Packages) == 0 {
+			ta.Packages = []string{targetDir}
+		} else {
+			slogctx.Debug(ctx, "Ignoring -target, packages were given", slog.String("target", targetDir), slog.Any("packages", ta.Packages))
+		}
 	}
 
-	ctx := context.Background()
+	// Run one shard of the packages (or tests); every shard writes its own
+	// report for goshim test merge-reports
+	if shardSpec != "" {
+		if reportJSONFile == "" {
+			reportJSONFile = filepath.Join(cfg.WorkspaceRoot, ".log", "goshim", "test-report.json")
+		}
+		reportJSONFile = shard.reportPath(reportJSONFile)
+		if junitFile != "" {
+			junitFile = shard.reportPath(junitFile)
+		}
+		fmt.Fprintf(stdout, "📄 Shard report: %s\n", reportJSONFile)
 
-	// For IDE mode, run raw go test directly (VS Code needs this format)
-	if ide {
-		if cfg.Verbose {
-			fmt.Printf("🔧 Using raw go test for IDE compatibility\n")
+		ok, err := cfg.applyTestShard(ctx, ta, shard, shardBy == "test", workspace)
+		if err != nil {
+			return err
+		}
+		workspace = false
+		if !ok {
+			return cfg.writeTestReports(ctx, junitFile, reportJSONFile, newTestResults(), nil)
 		}
+	}
+	goArgs := ta.goArgs()
+
+	needsEvents := junitFile != "" || reportJSONFile != "" || coverOpts.enabled()
+
+	// Callers asking for -json themselves want the event stream untouched
+	if ta.has("-json") {
+		if workspace {
+			return fmt.Errorf("-json cannot be combined with -workspace")
+		}
+		return cfg.execSafeGo(ctx, goArgs...)
+	}
+
+	// For IDE mode, run raw go test directly (VS Code needs this format)
+	if ide && !needsEvents && !workspace {
+		slogctx.Debug(ctx, "Using raw go test for IDE compatibility")
 		return cfg.execSafeGo(ctx, goArgs...)
 	}
 
-	// Use gotestsum if available, otherwise fall back to raw go test
-	if cfg.hasGotestsum() {
-		if cfg.Verbose {
-			fmt.Printf("🧪 Using gotestsum for enhanced test output\n")
+	// run tests goArgs once, then reruns failures, checks coverage and writes
+	// reports; watch mode calls it again for every change
+	run := func(goArgs []string) (*testResults, error) {
+		// Run go test -json and render a compact per-package summary, or echo
+		// the raw output when an IDE is reading it but goshim needs the results
+		var renderer testRenderer = &pkgnameRenderer{out: stdout}
+		if ide {
+			renderer = &rawRenderer{out: stdout, errOut: stderr}
+		}
+
+		var err error
+		results := newTestResults()
+		if workspace {
+			err = cfg.runWorkspaceTests(ctx, goArgs, workspaceJobs, results, renderer)
+		} else {
+			err = cfg.runGoTestJSON(ctx, "", goArgs, results, renderer)
+		}
+		renderer.finish(results)
+
+		if histErr := cfg.recordTestHistory(results, goArgs, shardSpec); histErr != nil {
+			slogctx.Warn(ctx, "Recording test history failed", slogctx.Err(histErr))
+		}
+
+		// Rerun failures to tell flaky tests from real ones; only consistent
+		// failures (or flakes, if asked) fail the run
+		var outcome *rerunOutcome
+		if reruns > 0 && err != nil && results.Failed() {
+			var rerunErr error
+			if outcome, rerunErr = cfg.rerunFailedTests(ctx, goArgs, results, reruns); rerunErr != nil {
+				slogctx.Warn(ctx, "Rerunning failed tests failed", slogctx.Err(rerunErr))
+			} else {
+				printRerunSummary(stdout, outcome)
+				err = nil
+				if outcome.Failed(flakesFatal) {
+					err = fmt.Errorf("tests failed")
+				}
+			}
+		}
+
+		// Coverage of a run that did not build is meaningless, so skip it
+		if coverFile != "" {
+			if results.BuildFailed() {
+				fmt.Fprintln(stdout, "⚠️  Skipping coverage analysis: build failed")
+			} else if covErr := cfg.reportCoverage(ctx, coverOpts, coverFile); covErr != nil && err == nil {
+				err = covErr
+			}
+			if keepCoverProfile || userCoverFile != "" {
+				fmt.Fprintf(stdout, "📄 Coverage profile: %s\n", coverFile)
+			}
+		}
+
+		// Reports are written even when tests fail, that is when they matter most
+		if reportErr := cfg.writeTestReports(ctx, junitFile, reportJSONFile, results, outcome); reportErr != nil {
+			fmt.Fprintf(stderr, "❌ %v\n", reportErr)
+			if err == nil {
+				err = reportErr
+			}
 		}
-		return cfg.runWithGotestsum(ctx, goArgs)
+		return results, err
 	}
 
-	if cfg.Verbose {
-		fmt.Printf("🔧 Using raw go test (consider installing gotestsum for better output)\n")
+	if watch {
+		return cfg.watchTests(ctx, ta, run)
 	}
-	return cfg.execSafeGo(ctx, goArgs...)
+	_, err = run(goArgs)
+	return err
 }
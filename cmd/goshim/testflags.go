@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// testFlagDef describes how a go test or goshim test flag is spelled
+type testFlagDef struct {
+	value  bool // takes a value, as -flag v or -flag=v
+	goshim bool // handled by goshim, never passed to go test
+}
+
+// testFlagDefs lists the go test, go build and goshim test flags that take a
+// value, plus goshim's own boolean flags. Anything else starting with - is a
+// boolean go test flag (-v, -race, -short, ...) or left for go test to reject.
+// Boolean flags with an optional value (-rerun-fails=3) only take it with =.
+var testFlagDefs = map[string]testFlagDef{
+	// go test
+	"-bench":                {value: true},
+	"-benchtime":            {value: true},
+	"-blockprofile":         {value: true},
+	"-blockprofilerate":     {value: true},
+	"-count":                {value: true},
+	"-coverprofile":         {value: true},
+	"-cpu":                  {value: true},
+	"-cpuprofile":           {value: true},
+	"-exec":                 {value: true},
+	"-fuzz":                 {value: true},
+	"-fuzzminimizetime":     {value: true},
+	"-fuzztime":             {value: true},
+	"-list":                 {value: true},
+	"-memprofile":           {value: true},
+	"-memprofilerate":       {value: true},
+	"-mutexprofile":         {value: true},
+	"-mutexprofilefraction": {value: true},
+	"-o":                    {value: true},
+	"-outputdir":            {value: true},
+	"-parallel":             {value: true},
+	"-run":                  {value: true},
+	"-shuffle":              {value: true},
+	"-skip":                 {value: true},
+	"-timeout":              {value: true},
+	"-trace":                {value: true},
+	"-vet":                  {value: true},
+
+	// go build
+	"-C":             {value: true},
+	"-asmflags":      {value: true},
+	"-buildmode":     {value: true},
+	"-compiler":      {value: true},
+	"-covermode":     {value: true},
+	"-coverpkg":      {value: true},
+	"-gccgoflags":    {value: true},
+	"-gcflags":       {value: true},
+	"-installsuffix": {value: true},
+	"-ldflags":       {value: true},
+	"-mod":           {value: true},
+	"-modfile":       {value: true},
+	"-overlay":       {value: true},
+	"-p":             {value: true},
+	"-pgo":           {value: true},
+	"-pkgdir":        {value: true},
+	"-tags":          {value: true},
+	"-toolexec":      {value: true},
+
+	// goshim
+	"-changed":                  {goshim: true},
+	"-codesign":                 {goshim: true},
+	"-codesign-entitlement":     {goshim: true, value: true},
+	"-codesign-force":           {goshim: true},
+	"-codesign-identity":        {goshim: true, value: true},
+	"-coverage-diff":            {goshim: true, value: true},
+	"-coverage-diff-min":        {goshim: true, value: true},
+	"-force":                    {goshim: true},
+	"-function-coverage":        {goshim: true},
+	"-ide":                      {goshim: true},
+	"-junit":                    {goshim: true, value: true},
+	"-keep-coverprofile":        {goshim: true},
+	"-min-coverage":             {goshim: true, value: true},
+	"-report-json":              {goshim: true, value: true},
+	"-rerun-fails":              {goshim: true},
+	"-rerun-fails-fatal-flakes": {goshim: true},
+	"-root":                     {goshim: true},
+	"-shard":                    {goshim: true, value: true},
+	"-shard-by":                 {goshim: true, value: true},
+	"-target":                   {goshim: true, value: true},
+	"-watch":                    {goshim: true},
+	"-workspace":                {goshim: true},
+	"-workspace-jobs":           {goshim: true, value: true},
+}
+
+// testFlag is one flag of a test command line
+type testFlag struct {
+	Name     string // with a single leading dash
+	Value    string
+	HasValue bool
+	raw      []string // the flag as written, one or two arguments
+}
+
+// enabled reports whether a boolean flag is on: -flag or -flag=true
+func (f testFlag) enabled() bool {
+	if !f.HasValue {
+		return true
+	}
+	on, _ := strconv.ParseBool(f.Value)
+	return on
+}
+
+// withValue returns the flag set to value, written the way it was
+func (f testFlag) withValue(value string) testFlag {
+	f.Value, f.HasValue = value, true
+	if len(f.raw) == 2 {
+		f.raw = []string{f.raw[0], value}
+	} else {
+		f.raw = []string{f.Name + "=" + value}
+	}
+	return f
+}
+
+// newTestFlag returns name set to value, written as -name=value
+func newTestFlag(name, value string) testFlag {
+	return testFlag{Name: name, Value: value, HasValue: true, raw: []string{name + "=" + value}}
+}
+
+// testArgs is a go test command line taken apart: goshim's own flags, the
+// flags for go test, the package arguments and the arguments for the test
+// binary (-args and everything after it, or -- and everything after it)
+type testArgs struct {
+	Goshim     []testFlag
+	Flags      []testFlag
+	Packages   []string
+	BinaryArgs []string
+}
+
+// parseTestArgs splits the arguments following "go test". Packages may be
+// mixed with flags like go test allows; a value-taking flag consumes the
+// next argument unless it is written -flag=value.
+func parseTestArgs(args []string) (*testArgs, error) {
+	ta := &testArgs{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "-args" || arg == "--args":
+			ta.BinaryArgs = append(ta.BinaryArgs, args[i:]...)
+			return ta, nil
+		case arg == "--":
+			// like go test, the terminator itself reaches the test binary
+			ta.BinaryArgs = append(ta.BinaryArgs, args[i:]...)
+			return ta, nil
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			ta.Packages = append(ta.Packages, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		name = "-" + strings.TrimLeft(name, "-")
+		// go test also accepts its flags spelled the way the test binary
+		// takes them, e.g. -test.run=X
+		if short, ok := strings.CutPrefix(name, "-test."); ok && !testFlagDefs["-"+short].goshim {
+			name = "-" + short
+		}
+		flag := testFlag{Name: name, Value: value, HasValue: hasValue, raw: []string{arg}}
+
+		def := testFlagDefs[name]
+		if def.value && !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			flag.Value, flag.HasValue = args[i], true
+			flag.raw = append(flag.raw, args[i])
+		}
+
+		if def.goshim {
+			ta.Goshim = append(ta.Goshim, flag)
+		} else {
+			ta.Flags = append(ta.Flags, flag)
+		}
+	}
+	return ta, nil
+}
+
+// parseGoTestArgs parses a go command line ("test" followed by go test
+// arguments)
+func parseGoTestArgs(goArgs []string) (*testArgs, error) {
+	if len(goArgs) == 0 || goArgs[0] != "test" {
+		return nil, fmt.Errorf("not a go test command line: %q", goArgs)
+	}
+	ta, err := parseTestArgs(goArgs[1:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go test arguments: %w", err)
+	}
+	return ta, nil
+}
+
+// flagArgs returns the go test flags as written, -C first since the go
+// command rejects it anywhere else
+func (ta *testArgs) flagArgs() []string {
+	var out []string
+	for _, f := range ta.Flags {
+		if f.Name == "-C" {
+			out = append(out, f.raw...)
+		}
+	}
+	for _, f := range ta.Flags {
+		if f.Name != "-C" {
+			out = append(out, f.raw...)
+		}
+	}
+	return out
+}
+
+// insertGoFlags adds flags to a go command line right after the subcommand
+// and a leading -C, which must stay the first flag
+func insertGoFlags(goArgs []string, flags ...string) []string {
+	i := 1
+	if i < len(goArgs) {
+		switch name, _, hasValue := strings.Cut(goArgs[i], "="); {
+		case name != "-C" && name != "--C":
+		case hasValue:
+			i++
+		default:
+			i = min(i+2, len(goArgs))
+		}
+	}
+	out := append(slices.Clone(goArgs[:i]), flags...)
+	return append(out, goArgs[i:]...)
+}
+
+// goArgs returns the go command line: test, flags, packages and the test
+// binary arguments, which must come last
+func (ta *testArgs) goArgs() []string {
+	out := append([]string{"test"}, ta.flagArgs()...)
+	out = append(out, ta.Packages...)
+	return append(out, ta.BinaryArgs...)
+}
+
+// has reports whether the go test flag name is set
+func (ta *testArgs) has(name string) bool {
+	return slices.ContainsFunc(ta.Flags, func(f testFlag) bool { return f.Name == name })
+}
+
+// value returns the value of the last go test flag name, or ""
+func (ta *testArgs) value(name string) string {
+	value := ""
+	for _, f := range ta.Flags {
+		if f.Name == name {
+			value = f.Value
+		}
+	}
+	return value
+}
+
+// add appends the go test flag name=value
+func (ta *testArgs) add(name, value string) {
+	ta.Flags = append(ta.Flags, newTestFlag(name, value))
+}
+
+// addBool appends the boolean go test flag name
+func (ta *testArgs) addBool(name string) {
+	ta.Flags = append(ta.Flags, testFlag{Name: name, raw: []string{name}})
+}
+
+// clone returns a copy that can be changed without affecting ta
+func (ta *testArgs) clone() *testArgs {
+	c := *ta
+	c.Goshim = slices.Clone(ta.Goshim)
+	c.Flags = slices.Clone(ta.Flags)
+	c.Packages = slices.Clone(ta.Packages)
+	c.BinaryArgs = slices.Clone(ta.BinaryArgs)
+	return &c
+}
+
+// remove drops every occurrence of the named go test flags
+func (ta *testArgs) remove(names ...string) {
+	ta.Flags = slices.DeleteFunc(ta.Flags, func(f testFlag) bool { return slices.Contains(names, f.Name) })
+}
+
+// set replaces every occurrence of the go test flag name with name=value
+func (ta *testArgs) set(name, value string) {
+	ta.remove(name)
+	ta.add(name, value)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTestArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		goshim     []string
+		goArgs     []string
+		packages   []string
+		binaryArgs []string
+	}{
+		{
+			name:     "value flags take the next argument",
+			args:     []string{"-v", "-timeout", "5m", "-coverprofile=c.out", "./...", "-tags", "x", "example.com/pkg"},
+			goArgs:   []string{"test", "-v", "-timeout", "5m", "-coverprofile=c.out", "-tags", "x", "./...", "example.com/pkg"},
+			packages: []string{"./...", "example.com/pkg"},
+		},
+		{
+			name:     "build flags",
+			args:     []string{"-p", "4", "-coverpkg", "./...", "-exec", "sudo -E", "-o", "pkg.test", "-c", "./pkg"},
+			goArgs:   []string{"test", "-p", "4", "-coverpkg", "./...", "-exec", "sudo -E", "-o", "pkg.test", "-c", "./pkg"},
+			packages: []string{"./pkg"},
+		},
+		{
+			name:       "-args passes the rest to the test binary",
+			args:       []string{"./pkg", "-args", "-v", "./other"},
+			goArgs:     []string{"test", "./pkg", "-args", "-v", "./other"},
+			packages:   []string{"./pkg"},
+			binaryArgs: []string{"-args", "-v", "./other"},
+		},
+		{
+			name:       "-- passes the rest to the test binary",
+			args:       []string{"-run", "TestX", "./pkg", "--", "-flag"},
+			goArgs:     []string{"test", "-run", "TestX", "./pkg", "--", "-flag"},
+			packages:   []string{"./pkg"},
+			binaryArgs: []string{"--", "-flag"},
+		},
+		{
+			name:     "-C takes a directory and always comes first",
+			args:     []string{"-count=1", "-v", "-C", "sub", "./..."},
+			goArgs:   []string{"test", "-C", "sub", "-count=1", "-v", "./..."},
+			packages: []string{"./..."},
+		},
+		{
+			name:     "go test flags with the test binary's -test. prefix",
+			args:     []string{"-test.run", "TestX", "-test.count=2", "-test.watch", "./..."},
+			goArgs:   []string{"test", "-test.run", "TestX", "-test.count=2", "-test.watch", "./..."},
+			packages: []string{"./..."},
+		},
+		{
+			name:     "goshim flags are taken out in both forms",
+			args:     []string{"-force", "-junit", "out.xml", "-target=./cmd", "-rerun-fails=2", "--count", "3", "./..."},
+			goshim:   []string{"-force", "-junit", "-target", "-rerun-fails"},
+			goArgs:   []string{"test", "--count", "3", "./..."},
+			packages: []string{"./..."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ta, err := parseTestArgs(tt.args)
+			require.NoError(t, err)
+
+			var goshim []string
+			for _, f := range ta.Goshim {
+				goshim = append(goshim, f.Name)
+			}
+			assert.Equal(t, tt.goshim, goshim)
+			assert.Equal(t, tt.goArgs, ta.goArgs())
+			assert.Equal(t, tt.packages, ta.Packages)
+			assert.Equal(t, tt.binaryArgs, ta.BinaryArgs)
+		})
+	}
+
+	_, err := parseTestArgs([]string{"./...", "-timeout"})
+	assert.ErrorContains(t, err, "flag needs an argument: -timeout")
+
+	ta, err := parseTestArgs([]string{"-test.run=TestX", "--test.skip", "TestY", "-test.v"})
+	require.NoError(t, err)
+	assert.Equal(t, "TestX", ta.value("-run"), "-test. prefixed flags are normalized")
+	assert.Equal(t, "TestY", ta.value("-skip"))
+	assert.True(t, ta.has("-v"))
+}
+
+func TestParseGoTestArgs(t *testing.T) {
+	ta, err := parseGoTestArgs([]string{"test", "-v", "./..."})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./..."}, ta.Packages)
+
+	_, err = parseGoTestArgs([]string{"test", "-run"})
+	assert.ErrorContains(t, err, "flag needs an argument")
+	_, err = parseGoTestArgs([]string{"build", "./..."})
+	assert.Error(t, err)
+	_, err = parseGoTestArgs(nil)
+	assert.Error(t, err)
+}
+
+func TestTestArgs_values(t *testing.T) {
+	ta, err := parseTestArgs([]string{"-coverprofile", "a.out", "-v", "--coverprofile=b.out", "-count=1", "-race=false", "./..."})
+	require.NoError(t, err)
+
+	assert.True(t, ta.has("-coverprofile"), "-- prefixed flags are normalized")
+	assert.Equal(t, "b.out", ta.value("-coverprofile"), "the last value wins")
+	assert.Equal(t, "", ta.value("-run"))
+
+	ta.set("-coverprofile", "c.out")
+	ta.add("-vet", "all")
+	ta.addBool("-cover")
+	assert.Equal(t, []string{"test", "-v", "-count=1", "-race=false", "-coverprofile=c.out", "-vet=all", "-cover", "./..."}, ta.goArgs())
+
+	c := ta.clone()
+	c.remove("-v", "-count")
+	c.Packages = []string{"./pkg"}
+	assert.Equal(t, []string{"test", "-race=false", "-coverprofile=c.out", "-vet=all", "-cover", "./pkg"}, c.goArgs())
+	assert.Equal(t, "-v", ta.Flags[0].Name, "clones are independent")
+}
+
+func TestTestFlag(t *testing.T) {
+	ta, err := parseTestArgs([]string{"-run", "^TestA/b$", "-skip=TestB", "-codesign", "-ide=false"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"-run", "^TestA$/b$"}, ta.Flags[0].withValue("^TestA$/b$").raw, "the two argument form is kept")
+	assert.Equal(t, []string{"-skip=TestC"}, ta.Flags[1].withValue("TestC").raw)
+	assert.True(t, ta.Goshim[0].enabled())
+	assert.False(t, ta.Goshim[1].enabled())
+}
+
+func TestInsertGoFlags(t *testing.T) {
+	tests := []struct {
+		goArgs []string
+		want   []string
+	}{
+		{[]string{"test", "-v", "./..."}, []string{"test", "-json", "-v", "./..."}},
+		{[]string{"test", "-C", "sub", "-v", "."}, []string{"test", "-C", "sub", "-json", "-v", "."}},
+		{[]string{"test", "-C=sub", "."}, []string{"test", "-C=sub", "-json", "."}},
+		{[]string{"test"}, []string{"test", "-json"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, insertGoFlags(tt.goArgs, "-json"), "%q", tt.goArgs)
+	}
+}
+
+func TestGoShimConfig_handleTestChdir(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOTOOLCHAIN", "local")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"sub/go.mod":      "module example.com/sub\n\ngo 1.24\n",
+		"sub/sub_test.go": "package sub\n\nimport \"testing\"\n\nfunc TestSub(t *testing.T) {}\n",
+	})
+	t.Chdir(root)
+
+	var out bytes.Buffer
+	oldStdout := stdout
+	stdout = &out
+	defer func() { stdout = oldStdout }()
+
+	// config flags and -json are added by goshim, -C must still come first
+	cfg := &GoShimConfig{WorkspaceRoot: root, TestFlags: []string{"-count=1"}}
+	require.NoError(t, cfg.handleTest(t.Context(), []string{"test", "-C", "sub", "."}))
+	assert.Contains(t, out.String(), "example.com/sub")
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// Test results, matching the actions reported by go test -json
+const (
+	resultPass = "pass"
+	resultFail = "fail"
+	resultSkip = "skip"
+)
+
+// testEvent mirrors the TestEvent emitted by go test -json (cmd/test2json).
+// Build events (build-output, build-fail) use ImportPath instead of Package.
+type testEvent struct {
+	Time        time.Time `json:",omitempty"`
+	Action      string
+	Package     string  `json:",omitempty"`
+	Test        string  `json:",omitempty"`
+	Elapsed     float64 `json:",omitempty"`
+	Output      string  `json:",omitempty"`
+	ImportPath  string  `json:",omitempty"`
+	FailedBuild string  `json:",omitempty"`
+}
+
+// testCase is the outcome of a single test or subtest
+type testCase struct {
+	Package string
+	Name    string
+	Result  string
+	Elapsed time.Duration
+	Output  []string
+}
+
+// packageResult is the outcome of a single package
+type packageResult struct {
+	Name        string
+	Result      string
+	Elapsed     time.Duration
+	Cached      bool
+	NoTestFiles bool
+	Coverage    string
+	BuildFailed bool
+	Output      []string
+	BuildOutput []string
+
+	tests     map[string]*testCase
+	testOrder []string
+}
+
+// Tests returns the package's tests in the order they started
+func (p *packageResult) Tests() []*testCase {
+	tests := make([]*testCase, 0, len(p.testOrder))
+	for _, name := range p.testOrder {
+		tests = append(tests, p.tests[name])
+	}
+	return tests
+}
+
+// testResults aggregates go test -json events into per-package and
+// per-test outcomes. It is safe for concurrent use.
+type testResults struct {
+	mu       sync.Mutex
+	start    time.Time
+	packages map[string]*packageResult
+	order    []string
+}
+
+func newTestResults() *testResults {
+	return &testResults{
+		start:    time.Now(),
+		packages: map[string]*packageResult{},
+	}
+}
+
+// pkg returns the result for name, creating it on first use
+func (r *testResults) pkg(name string) *packageResult {
+	p, ok := r.packages[name]
+	if !ok {
+		p = &packageResult{Name: name, tests: map[string]*testCase{}}
+		r.packages[name] = p
+		r.order = append(r.order, name)
+	}
+	return p
+}
+
+// add records an event and returns the package result if the event
+// completed the package
+func (r *testResults) add(ev testEvent) *packageResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ev.Action {
+	case "build-output":
+		p := r.pkg(buildImportPath(ev.ImportPath))
+		p.BuildOutput = append(p.BuildOutput, ev.Output)
+		return nil
+	case "build-fail":
+		p := r.pkg(buildImportPath(ev.ImportPath))
+		p.BuildFailed = true
+		return nil
+	}
+
+	if ev.Package == "" {
+		return nil
+	}
+	p := r.pkg(ev.Package)
+
+	if ev.Test == "" {
+		switch ev.Action {
+		case "output":
+			p.Output = append(p.Output, ev.Output)
+			if strings.Contains(ev.Output, "[no test files]") {
+				p.NoTestFiles = true
+			}
+			if strings.Contains(ev.Output, "(cached)") {
+				p.Cached = true
+			}
+			if cov := parseCoverageLine(ev.Output); cov != "" {
+				p.Coverage = cov
+			}
+			if strings.Contains(ev.Output, "[build failed]") || strings.Contains(ev.Output, "[setup failed]") {
+				p.BuildFailed = true
+			}
+		case resultPass, resultFail, resultSkip:
+			p.Result = ev.Action
+			p.Elapsed = secondsToDuration(ev.Elapsed)
+			if ev.FailedBuild != "" {
+				p.BuildFailed = true
+			}
+			return p
+		}
+		return nil
+	}
+
+	tc, ok := p.tests[ev.Test]
+	if !ok {
+		tc = &testCase{Package: ev.Package, Name: ev.Test}
+		p.tests[ev.Test] = tc
+		p.testOrder = append(p.testOrder, ev.Test)
+	}
+
+	switch ev.Action {
+	case "output":
+		tc.Output = append(tc.Output, ev.Output)
+	case resultPass, resultFail, resultSkip:
+		tc.Result = ev.Action
+		tc.Elapsed = secondsToDuration(ev.Elapsed)
+	}
+
+	return nil
+}
+
+// Packages returns every package in the order it was first seen
+func (r *testResults) Packages() []*packageResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkgs := make([]*packageResult, 0, len(r.order))
+	for _, name := range r.order {
+		pkgs = append(pkgs, r.packages[name])
+	}
+	return pkgs
+}
+
+// testCounts summarizes test outcomes across all packages
+type testCounts struct {
+	Total   int
+	Passed  int
+	Failed  int
+	Skipped int
+}
+
+// Counts tallies test results; packages that failed without any failing
+// test (build failures, panics in TestMain) are counted as failures too
+func (r *testResults) Counts() testCounts {
+	var c testCounts
+	for _, p := range r.Packages() {
+		failedTests := 0
+		for _, tc := range p.Tests() {
+			c.Total++
+			switch tc.Result {
+			case resultPass:
+				c.Passed++
+			case resultSkip:
+				c.Skipped++
+			case resultFail:
+				c.Failed++
+				failedTests++
+			}
+		}
+		if (p.Result == resultFail || p.BuildFailed) && failedTests == 0 {
+			c.Failed++
+		}
+	}
+	return c
+}
+
+// Failed reports whether any package failed or failed to build
+func (r *testResults) Failed() bool {
+	for _, p := range r.Packages() {
+		if p.Result == resultFail || p.BuildFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildFailed reports whether any package failed to build
+func (r *testResults) BuildFailed() bool {
+	for _, p := range r.Packages() {
+		if p.BuildFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// buildImportPath strips the test variant suffix from a build event's
+// import path, e.g. "example.com/pkg [example.com/pkg.test]"
+func buildImportPath(importPath string) string {
+	if idx := strings.Index(importPath, " ["); idx >= 0 {
+		return importPath[:idx]
+	}
+	return importPath
+}
+
+// parseCoverageLine extracts the coverage percentage from package output
+func parseCoverageLine(line string) string {
+	idx := strings.Index(line, "coverage: ")
+	if idx < 0 {
+		return ""
+	}
+	rest := line[idx+len("coverage: "):]
+	if end := strings.Index(rest, " of statements"); end >= 0 {
+		return rest[:end]
+	}
+	return ""
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// testRenderer turns test events into terminal output
+type testRenderer interface {
+	// packageDone is called once each package finishes
+	packageDone(p *packageResult)
+	// finish is called after go test exits
+	finish(r *testResults)
+}
+
+// eventRenderer is implemented by renderers that want every raw event,
+// not just finished packages
+type eventRenderer interface {
+	event(ev testEvent)
+}
+
+// pkgnameRenderer prints one line per package followed by the output of
+// failing tests and a summary, like gotestsum's pkgname format with hivis
+// icons
+type pkgnameRenderer struct {
+	out io.Writer
+}
+
+func (pr *pkgnameRenderer) packageDone(p *packageResult) {
+	icon := "✅"
+	switch {
+	case p.Result == resultFail || p.BuildFailed:
+		icon = "❌"
+	case p.NoTestFiles:
+		icon = "∅ "
+	case p.Result == resultSkip:
+		icon = "➖"
+	}
+
+	line := fmt.Sprintf("%s %s", icon, p.Name)
+	switch {
+	case p.NoTestFiles:
+	case p.Cached:
+		line += " (cached)"
+	default:
+		line += fmt.Sprintf(" (%s)", formatElapsed(p.Elapsed))
+	}
+	if p.Coverage != "" {
+		line += fmt.Sprintf(" (coverage: %s)", p.Coverage)
+	}
+	fmt.Fprintln(pr.out, line)
+}
+
+func (pr *pkgnameRenderer) finish(r *testResults) {
+	pkgs := r.Packages()
+
+	// Build errors first, they explain why packages have no test results
+	var buildErrors []*packageResult
+	for _, p := range pkgs {
+		if len(p.BuildOutput) > 0 {
+			buildErrors = append(buildErrors, p)
+		}
+	}
+	if len(buildErrors) > 0 {
+		fmt.Fprintln(pr.out)
+		fmt.Fprintln(pr.out, "=== Errors")
+		for _, p := range buildErrors {
+			for _, line := range p.BuildOutput {
+				io.WriteString(pr.out, line)
+			}
+		}
+	}
+
+	var failed []*testCase
+	var failedPkgs []*packageResult
+	for _, p := range pkgs {
+		pkgFailedTests := 0
+		for _, tc := range p.Tests() {
+			if tc.Result == resultFail {
+				failed = append(failed, tc)
+				pkgFailedTests++
+			}
+		}
+		if p.Result == resultFail && pkgFailedTests == 0 && !p.BuildFailed {
+			failedPkgs = append(failedPkgs, p)
+		}
+	}
+
+	if len(failed) > 0 || len(failedPkgs) > 0 {
+		fmt.Fprintln(pr.out)
+		fmt.Fprintln(pr.out, "=== Failed")
+		for _, tc := range failed {
+			fmt.Fprintf(pr.out, "=== FAIL: %s %s (%s)\n", tc.Package, tc.Name, formatElapsed(tc.Elapsed))
+			for _, line := range tc.Output {
+				// the --- FAIL line is redundant with the header above
+				if strings.HasPrefix(strings.TrimSpace(line), "--- FAIL") {
+					continue
+				}
+				io.WriteString(pr.out, line)
+			}
+			fmt.Fprintln(pr.out)
+		}
+		for _, p := range failedPkgs {
+			fmt.Fprintf(pr.out, "=== FAIL: %s (%s)\n", p.Name, formatElapsed(p.Elapsed))
+			for _, line := range p.Output {
+				io.WriteString(pr.out, line)
+			}
+			fmt.Fprintln(pr.out)
+		}
+	}
+
+	c := r.Counts()
+	summary := fmt.Sprintf("DONE %d %s", c.Total, pluralize(c.Total, "test", "tests"))
+	if c.Skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", c.Skipped)
+	}
+	if c.Failed > 0 {
+		summary += fmt.Sprintf(", %d %s", c.Failed, pluralize(c.Failed, "failure", "failures"))
+	}
+	summary += fmt.Sprintf(" in %s", formatElapsed(time.Since(r.start)))
+
+	fmt.Fprintln(pr.out)
+	fmt.Fprintln(pr.out, summary)
+}
+
+// formatElapsed formats a duration like go test does
+func formatElapsed(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+// handleTestJSONLine records one line of go test -json output, passing lines
+// that are not events through unchanged
+func handleTestJSONLine(line []byte, results *testResults, renderer testRenderer) {
+	var ev testEvent
+	if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &ev) != nil {
+		fmt.Fprintf(stdout, "%s\n", line)
+		return
+	}
+
+	if er, ok := renderer.(eventRenderer); ok {
+		er.event(ev)
+	}
+	if done := results.add(ev); done != nil && renderer != nil {
+		renderer.packageDone(done)
+	}
+}
+
+// runGoTestJSON runs go test with -json in dir, feeding every event into
+// results and reporting finished packages to the renderer. Lines on stdout
+// that are not JSON events (e.g. "go: downloading ...") are passed through
+// unchanged; stderr is not parsed. The caller finishes the renderer so
+// several runs can share one summary.
+func (cfg *GoShimConfig) runGoTestJSON(ctx context.Context, dir string, goArgs []string, results *testResults, renderer testRenderer) error {
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		return err
+	}
+
+	args := insertGoFlags(goArgs, "-json")
+
+	slogctx.Debug(ctx, "Executing go command", slog.String("go", goPath), slog.Any("args", args), slog.String("dir", dir))
+
+	cmd := exec.CommandContext(ctx, goPath, args...)
+	cmd.Env = os.Environ()
+	cmd.Dir = dir
+	cmd.Stderr = stderr
+	cmd.Stdin = stdin
+
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := startCommand(cmd); err != nil {
+		return fmt.Errorf("failed to start go test: %w", err)
+	}
+	stop := forwardSignals(cmd)
+	defer stop()
+
+	// Lines are read whole however long they are (a test can log megabytes
+	// on one line), so no line ever fails the read
+	reader := bufio.NewReaderSize(pipe, 64*1024)
+	var readErr error
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+			handleTestJSONLine(line, results, renderer)
+		}
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+	}
+	if readErr != nil {
+		// drain what is left so go test does not block on a full pipe
+		io.Copy(io.Discard, pipe)
+	}
+
+	waitErr := cmd.Wait()
+	if readErr != nil {
+		return fmt.Errorf("failed to read go test output: %w", readErr)
+	}
+	return waitErr
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleTestEvents is a trimmed go test -json stream covering a passing
+// package, a failing subtest, a build failure and a package without tests
+const sampleTestEvents = `{"Action":"start","Package":"example.com/a"}
+{"Action":"run","Package":"example.com/a","Test":"TestOK"}
+{"Action":"output","Package":"example.com/a","Test":"TestOK","Output":"=== RUN   TestOK\n"}
+{"Action":"pass","Package":"example.com/a","Test":"TestOK","Elapsed":0.01}
+{"Action":"run","Package":"example.com/a","Test":"TestBad"}
+{"Action":"run","Package":"example.com/a","Test":"TestBad/sub_one"}
+{"Action":"output","Package":"example.com/a","Test":"TestBad/sub_one","Output":"    a_test.go:7: boom\n"}
+{"Action":"output","Package":"example.com/a","Test":"TestBad/sub_one","Output":"    --- FAIL: TestBad/sub_one (0.00s)\n"}
+{"Action":"fail","Package":"example.com/a","Test":"TestBad/sub_one","Elapsed":0}
+{"Action":"fail","Package":"example.com/a","Test":"TestBad","Elapsed":0.02}
+{"Action":"run","Package":"example.com/a","Test":"TestSkip"}
+{"Action":"skip","Package":"example.com/a","Test":"TestSkip","Elapsed":0}
+{"Action":"output","Package":"example.com/a","Output":"FAIL\n"}
+{"Action":"output","Package":"example.com/a","Output":"coverage: 71.4% of statements\n"}
+{"Action":"fail","Package":"example.com/a","Elapsed":0.5}
+{"ImportPath":"example.com/b [example.com/b.test]","Action":"build-output","Output":"# example.com/b [example.com/b.test]\n"}
+{"ImportPath":"example.com/b [example.com/b.test]","Action":"build-output","Output":"b/b_test.go:5:32: declared and not used: x\n"}
+{"ImportPath":"example.com/b [example.com/b.test]","Action":"build-fail"}
+{"Action":"start","Package":"example.com/b"}
+{"Action":"output","Package":"example.com/b","Output":"FAIL\texample.com/b [build failed]\n"}
+{"Action":"fail","Package":"example.com/b","Elapsed":0,"FailedBuild":"example.com/b [example.com/b.test]"}
+{"Action":"start","Package":"example.com/c"}
+{"Action":"output","Package":"example.com/c","Output":"?   \texample.com/c\t[no test files]\n"}
+{"Action":"skip","Package":"example.com/c","Elapsed":0}
+{"Action":"start","Package":"example.com/d"}
+{"Action":"output","Package":"example.com/d","Output":"ok  \texample.com/d\t(cached)\n"}
+{"Action":"pass","Package":"example.com/d","Elapsed":0}
+`
+
+func loadSampleResults(t *testing.T, renderer testRenderer) *testResults {
+	t.Helper()
+
+	results := newTestResults()
+	for _, line := range strings.Split(strings.TrimSpace(sampleTestEvents), "\n") {
+		var ev testEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &ev), "sample event should decode")
+		if done := results.add(ev); done != nil && renderer != nil {
+			renderer.packageDone(done)
+		}
+	}
+	return results
+}
+
+func TestTestResults_add(t *testing.T) {
+	results := loadSampleResults(t, nil)
+
+	pkgs := results.Packages()
+	require.Len(t, pkgs, 4, "build events should be merged into their package")
+
+	a := pkgs[0]
+	assert.Equal(t, "example.com/a", a.Name)
+	assert.Equal(t, resultFail, a.Result)
+	assert.Equal(t, "71.4%", a.Coverage)
+	require.Len(t, a.Tests(), 4, "subtests should be tracked")
+	assert.Equal(t, "TestBad/sub_one", a.Tests()[2].Name)
+	assert.Equal(t, resultFail, a.Tests()[2].Result)
+
+	b := pkgs[1]
+	assert.True(t, b.BuildFailed, "build failure should be recorded")
+	assert.Len(t, b.BuildOutput, 2)
+
+	assert.True(t, pkgs[2].NoTestFiles, "no test files should be detected")
+	assert.True(t, pkgs[3].Cached, "cached result should be detected")
+
+	counts := results.Counts()
+	assert.Equal(t, testCounts{Total: 4, Passed: 1, Failed: 3, Skipped: 1}, counts, "build failures count as one failure")
+	assert.True(t, results.Failed())
+}
+
+func TestPkgnameRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	renderer := &pkgnameRenderer{out: &buf}
+
+	results := loadSampleResults(t, renderer)
+	renderer.finish(results)
+
+	out := buf.String()
+	for _, want := range []string{
+		"❌ example.com/a (0.500s) (coverage: 71.4%)\n",
+		"❌ example.com/b (0.000s)\n",
+		"∅  example.com/c\n",
+		"✅ example.com/d (cached)\n",
+		"=== Errors\n# example.com/b [example.com/b.test]\n",
+		"=== FAIL: example.com/a TestBad/sub_one (0.000s)\n    a_test.go:7: boom\n",
+		"DONE 4 tests, 1 skipped, 3 failures in ",
+	} {
+		assert.Contains(t, out, want, "rendered output should contain %q", want)
+	}
+	assert.NotContains(t, out, "--- FAIL", "redundant --- FAIL lines should be dropped")
+	assert.NotContains(t, out, "TestOK (", "passing test output should not be shown")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// plainTestName matches a test name without regexp syntax
+var plainTestName = regexp.MustCompile(`^[\pL\pN_]+$`)
+
+// splitTestPattern splits a -run/-skip pattern at sep ('|' or '/') the way
+// the testing package does: separators inside brackets or parentheses, or
+// escaped with a backslash, do not split
+func splitTestPattern(pattern string, sep byte) []string {
+	var parts []string
+	brackets, parens := 0, 0
+	start := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '[':
+			brackets++
+		case ']':
+			brackets = max(brackets-1, 0)
+		case '(':
+			if brackets == 0 {
+				parens++
+			}
+		case ')':
+			if brackets == 0 {
+				parens--
+			}
+		case '\\':
+			i++
+		case sep:
+			if brackets == 0 && parens == 0 {
+				parts = append(parts, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, pattern[start:])
+}
+
+// anchorTestName anchors the top-level level of a pattern so it matches the
+// named tests exactly. It returns false for levels that are already anchored
+// or use regexp syntax beyond an alternation of test names.
+func anchorTestName(level string) (string, bool) {
+	body, hasCaret := strings.CutPrefix(level, "^")
+	body, hasDollar := strings.CutSuffix(body, "$")
+	if hasCaret && hasDollar && !strings.HasSuffix(body, `\`) {
+		return level, false
+	}
+
+	names := []string{body}
+	if inner, ok := strings.CutPrefix(body, "("); ok && strings.HasSuffix(inner, ")") {
+		names = splitTestPattern(strings.TrimSuffix(inner, ")"), '|')
+	}
+	for _, name := range names {
+		if !plainTestName.MatchString(name) {
+			return level, false
+		}
+	}
+	return "^" + body + "$", true
+}
+
+// rewriteTestPattern fixes -run and -skip patterns selecting subtests, as
+// VS Code and the Go extension emit them: in ^TestHarpoon/bun_version$ the
+// top-level TestHarpoon also matches TestHarpoonOCI. Every alternative of
+// the pattern with more than one level gets its top-level test name (or
+// group of names) anchored; alternatives that are already anchored, have a
+// single level or use other regexp syntax at the top level are kept. The
+// returned notes explain each change.
+func rewriteTestPattern(pattern string) (string, []string) {
+	var notes []string
+	alternatives := splitTestPattern(pattern, '|')
+	for i, alt := range alternatives {
+		levels := splitTestPattern(alt, '/')
+		if len(levels) < 2 {
+			continue
+		}
+		anchored, ok := anchorTestName(levels[0])
+		if !ok {
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("anchored %s as %s so it does not match longer test names", levels[0], anchored))
+		levels[0] = anchored
+		alternatives[i] = strings.Join(levels, "/")
+	}
+	return strings.Join(alternatives, "|"), notes
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitTestPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		sep     byte
+		want    []string
+	}{
+		{name: "levels", pattern: "^TestA/sub/leaf$", sep: '/', want: []string{"^TestA", "sub", "leaf$"}},
+		{name: "slash in brackets", pattern: "^TestA/[a/b]$", sep: '/', want: []string{"^TestA", "[a/b]$"}},
+		{name: "slash in parens", pattern: "^TestA/(x/y)$", sep: '/', want: []string{"^TestA", "(x/y)$"}},
+		{name: "escaped slash", pattern: `^TestA\/x/y`, sep: '/', want: []string{`^TestA\/x`, "y"}},
+		{name: "alternatives", pattern: "^TestA$/x|^TestB/y", sep: '|', want: []string{"^TestA$/x", "^TestB/y"}},
+		{name: "grouped alternation", pattern: "^(TestA|TestB)/x", sep: '|', want: []string{"^(TestA|TestB)/x"}},
+		{name: "bar in brackets", pattern: "Test[|]", sep: '|', want: []string{"Test[|]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitTestPattern(tt.pattern, tt.sep))
+		})
+	}
+}
+
+func TestRewriteTestPattern(t *testing.T) {
+	// Patterns as VS Code and the Go extension write them for "run test",
+	// "run subtest" and table cases, plus hand-written variants
+	tests := []struct {
+		name    string
+		pattern string
+		want    string
+		changed bool
+	}{
+		{name: "single test", pattern: "^TestFoo$", want: "^TestFoo$"},
+		{name: "several tests", pattern: "^(TestFoo|TestBar)$", want: "^(TestFoo|TestBar)$"},
+		{name: "subtest", pattern: "^TestFoo/bar_case$", want: "^TestFoo$/bar_case$", changed: true},
+		{name: "anchored subtest", pattern: "^TestFoo$/^bar_case$", want: "^TestFoo$/^bar_case$"},
+		{name: "half anchored subtest", pattern: "^TestFoo/^bar_case$", want: "^TestFoo$/^bar_case$", changed: true},
+		{name: "table case with spaces", pattern: "^TestFoo/returns_error_on_empty_input$", want: "^TestFoo$/returns_error_on_empty_input$", changed: true},
+		{name: "nested subtest", pattern: "^TestFoo/outer/inner$", want: "^TestFoo$/outer/inner$", changed: true},
+		{name: "suite method", pattern: "^TestSuite$/^TestMethod$", want: "^TestSuite$/^TestMethod$"},
+		{name: "unanchored subtest", pattern: "TestFoo/bar", want: "^TestFoo$/bar", changed: true},
+		{name: "grouped tests with subtest", pattern: "^(TestFoo|TestBar)/case$", want: "^(TestFoo|TestBar)$/case$", changed: true},
+		{name: "each alternative", pattern: "^TestFoo/a$|^TestBar/b$", want: "^TestFoo$/a$|^TestBar$/b$", changed: true},
+		{name: "mixed alternatives", pattern: "^TestFoo$/a|TestBar/b|TestBaz", want: "^TestFoo$/a|^TestBar$/b|TestBaz", changed: true},
+		{name: "slash inside brackets", pattern: "^TestFoo/[a/b]$", want: "^TestFoo$/[a/b]$", changed: true},
+		{name: "regexp top level kept", pattern: "Test.*/bar", want: "Test.*/bar"},
+		{name: "escaped dollar kept", pattern: `^TestFoo\$/bar`, want: `^TestFoo\$/bar`},
+		{name: "empty", pattern: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, notes := rewriteTestPattern(tt.pattern)
+			assert.Equal(t, tt.want, got)
+			if tt.changed {
+				assert.NotEmpty(t, notes, "a rewrite should explain itself")
+			} else {
+				assert.Empty(t, notes)
+			}
+		})
+	}
+}
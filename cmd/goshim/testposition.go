@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// testPositionArg matches a file:line (or file:line:col) package argument
+var testPositionArg = regexp.MustCompile(`^(.+\.go):(\d+)(?::\d+)?$`)
+
+// testPosition is a position in a test file, given instead of a package
+type testPosition struct {
+	File string
+	Line int
+}
+
+// parseTestPosition recognizes file.go:line arguments
+func parseTestPosition(arg string) (testPosition, bool) {
+	m := testPositionArg.FindStringSubmatch(arg)
+	if m == nil {
+		return testPosition{}, false
+	}
+	line, err := strconv.Atoi(m[2])
+	if err != nil || line < 1 {
+		return testPosition{}, false
+	}
+	return testPosition{File: m[1], Line: line}, true
+}
+
+// String returns the position as file:line
+func (p testPosition) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// Package returns the package directory of the file, spelled the way go test
+// needs a relative directory
+func (p testPosition) Package() string {
+	dir := filepath.Dir(p.File)
+	if filepath.IsAbs(dir) || dir == "." || dir == ".." || strings.HasPrefix(dir, "."+string(filepath.Separator)) || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		return dir
+	}
+	return "." + string(filepath.Separator) + dir
+}
+
+// positionTest is the test function enclosing a position and, for subtests
+// with literal names, the subtests enclosing it, outermost first
+type positionTest struct {
+	Func     string
+	Subtests []string
+}
+
+// Name returns the full test name as go test prints it
+func (pt positionTest) Name() string {
+	return strings.Join(append([]string{pt.Func}, pt.Subtests...), "/")
+}
+
+// Benchmark reports whether the test is a benchmark, selected with -bench
+func (pt positionTest) Benchmark() bool {
+	return strings.HasPrefix(pt.Func, "Benchmark")
+}
+
+// Pattern returns a -run (or -bench) pattern matching exactly this test:
+// every level anchored and quoted, e.g. ^TestFoo$/^empty_input$
+func (pt positionTest) Pattern() string {
+	levels := []string{"^" + regexp.QuoteMeta(pt.Func) + "$"}
+	for _, name := range pt.Subtests {
+		// like the testing package, a slash in a subtest name adds a level
+		for _, elem := range strings.Split(subtestName(name), "/") {
+			levels = append(levels, "^"+regexp.QuoteMeta(elem)+"$")
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// subtestName rewrites a t.Run name the way the testing package does:
+// spaces become underscores and unprintable runes are escaped
+func subtestName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			b.WriteByte('_')
+		case !strconv.IsPrint(r):
+			s := strconv.QuoteRune(r)
+			b.WriteString(s[1 : len(s)-1])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// isTestFunc reports whether name is a test, benchmark or fuzz function
+// name: the prefix followed by nothing or a rune that is not lower case
+func isTestFunc(name string) bool {
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz"} {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		if rest == "" {
+			return true
+		}
+		r, _ := utf8.DecodeRuneInString(rest)
+		return !unicode.IsLower(r)
+	}
+	return false
+}
+
+// findTestAt parses a test file and returns the test enclosing pos. Subtests
+// are only followed while their names are known statically: t.Run with a
+// string literal, or a table case (slice of keyed structs or a map with
+// string keys) ranged over by a loop that calls t.Run with the case name.
+func findTestAt(pos testPosition) (positionTest, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, pos.File, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return positionTest{}, fmt.Errorf("failed to parse %s: %w", pos.File, err)
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Body == nil || !isTestFunc(fn.Name.Name) || !containsLine(fset, fn, pos.Line) {
+			continue
+		}
+		pt := positionTest{Func: fn.Name.Name}
+		if tvar := firstParam(fn.Type); tvar != "" {
+			f := &subtestFinder{fset: fset, file: file, fn: fn, line: pos.Line}
+			pt.Subtests = f.subtestsAt(fn.Body, tvar)
+		}
+		return pt, nil
+	}
+	return positionTest{}, fmt.Errorf("no test, benchmark or fuzz function at %s", pos)
+}
+
+// applyTestPosition turns a file:line package argument (or -target value)
+// into the file's package and a -run pattern selecting the enclosing test, or
+// -bench for a benchmark. It returns the -target to use.
+func applyTestPosition(ta *testArgs, targetDir string, out io.Writer) (string, error) {
+	var positions []testPosition
+	for i, pkg := range ta.Packages {
+		if pos, ok := parseTestPosition(pkg); ok {
+			positions = append(positions, pos)
+			ta.Packages[i] = pos.Package()
+		}
+	}
+	if pos, ok := parseTestPosition(targetDir); ok {
+		positions = append(positions, pos)
+		targetDir = pos.Package()
+	}
+
+	switch {
+	case len(positions) == 0:
+		return targetDir, nil
+	case len(positions) > 1:
+		return "", fmt.Errorf("only one file:line position can be tested at a time, got %d", len(positions))
+	}
+
+	pt, err := findTestAt(positions[0])
+	if err != nil {
+		return "", err
+	}
+	selectFlag := "-run"
+	if pt.Benchmark() {
+		selectFlag = "-bench"
+	}
+	if ta.has(selectFlag) {
+		return "", fmt.Errorf("%s cannot be combined with a file:line position", selectFlag)
+	}
+	if pt.Benchmark() {
+		if ta.has("-run") {
+			return "", fmt.Errorf("a benchmark file:line position skips tests with -run=^$, -run is not supported")
+		}
+		ta.add("-run", "^$")
+	}
+	ta.add(selectFlag, pt.Pattern())
+
+	fmt.Fprintf(out, "🎯 %s at %s\n", pt.Name(), positions[0])
+	return targetDir, nil
+}
+
+// containsLine reports whether node spans line
+func containsLine(fset *token.FileSet, node ast.Node, line int) bool {
+	return fset.Position(node.Pos()).Line <= line && line <= fset.Position(node.End()).Line
+}
+
+// firstParam returns the name of a function's first parameter, or "" when it
+// is unnamed
+func firstParam(ft *ast.FuncType) string {
+	if ft.Params == nil || len(ft.Params.List) == 0 || len(ft.Params.List[0].Names) == 0 {
+		return ""
+	}
+	if name := ft.Params.List[0].Names[0].Name; name != "_" {
+		return name
+	}
+	return ""
+}
+
+// subtestFinder locates the subtests enclosing a line of a test file
+type subtestFinder struct {
+	fset *token.FileSet
+	file *ast.File
+	fn   *ast.FuncDecl // the test function
+	line int
+}
+
+// subtestsAt returns the names of the subtests of body (run through tvar)
+// enclosing the line, outermost first
+func (f *subtestFinder) subtestsAt(body *ast.BlockStmt, tvar string) []string {
+	if names, ok := f.tableCaseAt(body, tvar); ok {
+		return names
+	}
+
+	var names []string
+	done := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if done || n == nil || !containsLine(f.fset, n, f.line) {
+			return false
+		}
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fn, ok := subtestCall(call, tvar)
+		if !ok {
+			return true
+		}
+		// a subtest whose name is only known at run time runs whole
+		done = true
+		name, ok := stringLit(call.Args[0])
+		if !ok {
+			return false
+		}
+		names = append(names, name)
+		if inner := firstParam(fn.Type); inner != "" {
+			names = append(names, f.subtestsAt(fn.Body, inner)...)
+		}
+		return false
+	})
+	return names
+}
+
+// tableCaseAt finds a table case containing the line: an element of a
+// table literal ranged over by a loop in body, or in a subtest of body, that
+// runs a subtest per case. It returns the enclosing subtests and the case,
+// outermost first.
+func (f *subtestFinder) tableCaseAt(body *ast.BlockStmt, tvar string) ([]string, bool) {
+	var names []string
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			fn, ok := subtestCall(n, tvar)
+			if !ok {
+				return true
+			}
+			inner := firstParam(fn.Type)
+			if inner == "" {
+				return false
+			}
+			sub, ok := f.tableCaseAt(fn.Body, inner)
+			if !ok {
+				return false
+			}
+			// a group whose name is only known at run time runs whole
+			found = true
+			if name, ok := stringLit(n.Args[0]); ok {
+				names = append([]string{name}, sub...)
+			}
+			return false
+		case *ast.RangeStmt:
+			call := loopSubtest(n, tvar)
+			if call == nil {
+				return true
+			}
+			table := f.rangeTable(body, n.X)
+			if table == nil {
+				return true
+			}
+			for _, elt := range table.Elts {
+				if containsLine(f.fset, elt, f.line) {
+					name, ok := tableCaseName(table, elt, n, call.Args[0])
+					if ok {
+						names, found = []string{name}, true
+					}
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return names, found
+}
+
+// subtestCall reports whether call is tvar.Run(name, func(...) {...})
+func subtestCall(call *ast.CallExpr, tvar string) (*ast.FuncLit, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Run" || len(call.Args) != 2 {
+		return nil, false
+	}
+	if x, ok := sel.X.(*ast.Ident); !ok || x.Name != tvar {
+		return nil, false
+	}
+	fn, ok := call.Args[1].(*ast.FuncLit)
+	return fn, ok
+}
+
+// loopSubtest returns the subtest call directly in a loop body, not nested
+// in another function literal
+func loopSubtest(loop *ast.RangeStmt, tvar string) *ast.CallExpr {
+	var found *ast.CallExpr
+	ast.Inspect(loop.Body, func(n ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if _, ok := subtestCall(n, tvar); ok {
+				found = n
+				return false
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// rangeTable resolves the composite literal a loop ranges over: a literal
+// in place, or a variable assigned one in body, in the enclosing test
+// function or at package level
+func (f *subtestFinder) rangeTable(body *ast.BlockStmt, x ast.Expr) *ast.CompositeLit {
+	if lit, ok := x.(*ast.CompositeLit); ok {
+		return lit
+	}
+	ident, ok := x.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+
+	var table *ast.CompositeLit
+	match := func(name ast.Expr, value ast.Expr) {
+		id, ok := name.(*ast.Ident)
+		if lit, isLit := value.(*ast.CompositeLit); ok && isLit && id.Name == ident.Name && table == nil {
+			table = lit
+		}
+	}
+	visit := func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for i := range min(len(n.Lhs), len(n.Rhs)) {
+				match(n.Lhs[i], n.Rhs[i])
+			}
+		case *ast.ValueSpec:
+			for i := range min(len(n.Names), len(n.Values)) {
+				match(n.Names[i], n.Values[i])
+			}
+		}
+		return table == nil
+	}
+	ast.Inspect(body, visit)
+	if table == nil {
+		ast.Inspect(f.fn.Body, visit)
+	}
+	if table == nil {
+		for _, decl := range f.file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+				ast.Inspect(gen, visit)
+			}
+		}
+	}
+	return table
+}
+
+// tableCaseName returns the subtest name of a table element, as used by the
+// loop's t.Run: the map key when ranging over a map, or a struct field
+func tableCaseName(table *ast.CompositeLit, elt ast.Expr, loop *ast.RangeStmt, nameArg ast.Expr) (string, bool) {
+	var key ast.Expr
+	if kv, ok := elt.(*ast.KeyValueExpr); ok {
+		key, elt = kv.Key, kv.Value
+	}
+	if u, ok := elt.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		elt = u.X
+	}
+
+	switch arg := nameArg.(type) {
+	case *ast.Ident:
+		// for name, tc := range cases { t.Run(name, ...) }
+		if k, ok := loop.Key.(*ast.Ident); ok && k.Name == arg.Name && key != nil {
+			return stringLit(key)
+		}
+	case *ast.SelectorExpr:
+		// for _, tt := range tests { t.Run(tt.name, ...) }
+		x, ok := arg.X.(*ast.Ident)
+		if v, isIdent := loop.Value.(*ast.Ident); !ok || !isIdent || v.Name != x.Name {
+			return "", false
+		}
+		lit, ok := elt.(*ast.CompositeLit)
+		if !ok {
+			return "", false
+		}
+		return structField(table, lit, arg.Sel.Name)
+	}
+	return "", false
+}
+
+// structField returns a string field of a table element, by key or, for
+// tables of an anonymous struct type, by position
+func structField(table, lit *ast.CompositeLit, field string) (string, bool) {
+	for i, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			if k, ok := kv.Key.(*ast.Ident); ok && k.Name == field {
+				return stringLit(kv.Value)
+			}
+			continue
+		}
+		if fieldIndex(table, field) == i {
+			return stringLit(elt)
+		}
+	}
+	return "", false
+}
+
+// fieldIndex returns the position of field in the anonymous struct element
+// type of a slice or array table, or -1
+func fieldIndex(table *ast.CompositeLit, field string) int {
+	arr, ok := table.Type.(*ast.ArrayType)
+	if !ok {
+		return -1
+	}
+	st, ok := arr.Elt.(*ast.StructType)
+	if !ok {
+		return -1
+	}
+	i := 0
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			i++
+			continue
+		}
+		for _, name := range f.Names {
+			if name.Name == field {
+				return i
+			}
+			i++
+		}
+	}
+	return -1
+}
+
+// stringLit returns the value of a string literal
+func stringLit(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
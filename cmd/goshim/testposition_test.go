@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const positionTestFile = `package foo
+
+import "testing"
+
+func helper() {}
+
+func TestPlain(t *testing.T) {
+	helper() // plain body
+}
+
+func TestLiteral(t *testing.T) {
+	t.Run("first case", func(t *testing.T) {
+		t.Run("inner", func(t *testing.T) {
+			helper()
+		})
+	})
+}
+
+func TestTable(t *testing.T) {
+	tests := []struct {
+		name string
+		in   int
+	}{
+		{
+			name: "zero",
+			in:   0,
+		},
+		{name: "one/two", in: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = tt.in
+		})
+	}
+}
+
+func TestMap(t *testing.T) {
+	cases := map[string]int{
+		"a.b": 1,
+	}
+	for name, want := range cases {
+		t.Run(name, func(t *testing.T) { _ = want })
+	}
+}
+
+func TestUnkeyed(t *testing.T) {
+	for _, tt := range []struct {
+		in   int
+		name string
+	}{
+		{1, "unkeyed"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {})
+	}
+}
+
+func TestGrouped(t *testing.T) {
+	shared := []struct{ name string }{
+		{name: "shared case"},
+	}
+	t.Run("group", func(t *testing.T) {
+		for _, tt := range []struct{ name string }{
+			{name: "grouped case"},
+		} {
+			t.Run(tt.name, func(t *testing.T) {})
+		}
+		for _, tt := range shared {
+			t.Run(tt.name, func(t *testing.T) {})
+		}
+	})
+}
+
+func BenchmarkFoo(b *testing.B) {
+	helper()
+}
+
+func Testable(t *testing.T) {}
+`
+
+// lineOf returns the 1-based line of the first line containing s
+func lineOf(t *testing.T, src, s string) int {
+	t.Helper()
+	for i, line := range strings.Split(src, "\n") {
+		if strings.Contains(line, s) {
+			return i + 1
+		}
+	}
+	t.Fatalf("%q not found", s)
+	return 0
+}
+
+func TestFindTestAt(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "foo_test.go")
+	require.NoError(t, os.WriteFile(file, []byte(positionTestFile), 0o644))
+
+	tests := []struct {
+		name    string
+		at      string
+		want    string
+		pattern string
+		wantErr string
+	}{
+		{name: "test body", at: "// plain body", want: "TestPlain", pattern: "^TestPlain$"},
+		{name: "func line", at: "func TestPlain", want: "TestPlain", pattern: "^TestPlain$"},
+		{name: "literal subtest", at: `t.Run("first case"`, want: "TestLiteral/first case", pattern: "^TestLiteral$/^first_case$"},
+		{name: "nested literal subtest", at: `t.Run("inner"`, want: "TestLiteral/first case/inner", pattern: "^TestLiteral$/^first_case$/^inner$"},
+		{name: "keyed table case", at: `in:   0,`, want: "TestTable/zero", pattern: "^TestTable$/^zero$"},
+		{name: "table case with slash", at: `name: "one/two"`, want: "TestTable/one/two", pattern: "^TestTable$/^one$/^two$"},
+		{name: "table loop body", at: "_ = tt.in", want: "TestTable", pattern: "^TestTable$"},
+		{name: "map case", at: `"a.b": 1`, want: "TestMap/a.b", pattern: `^TestMap$/^a\.b$`},
+		{name: "unkeyed case", at: `{1, "unkeyed"}`, want: "TestUnkeyed/unkeyed", pattern: "^TestUnkeyed$/^unkeyed$"},
+		{name: "table case in a subtest", at: `{name: "grouped case"}`, want: "TestGrouped/group/grouped case", pattern: "^TestGrouped$/^group$/^grouped_case$"},
+		{name: "outer table ranged in a subtest", at: `{name: "shared case"}`, want: "TestGrouped/group/shared case", pattern: "^TestGrouped$/^group$/^shared_case$"},
+		{name: "benchmark", at: "func BenchmarkFoo", want: "BenchmarkFoo", pattern: "^BenchmarkFoo$"},
+		{name: "not a test", at: "func helper", wantErr: "no test, benchmark or fuzz function"},
+		{name: "lower case after prefix", at: "func Testable", wantErr: "no test, benchmark or fuzz function"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt, err := findTestAt(testPosition{File: file, Line: lineOf(t, positionTestFile, tt.at)})
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, pt.Name())
+			assert.Equal(t, tt.pattern, pt.Pattern())
+		})
+	}
+}
+
+func TestParseTestPosition(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want testPosition
+		ok   bool
+	}{
+		{arg: "./pkg/foo_test.go:42", want: testPosition{File: "./pkg/foo_test.go", Line: 42}, ok: true},
+		{arg: "foo_test.go:7:12", want: testPosition{File: "foo_test.go", Line: 7}, ok: true},
+		{arg: "./pkg/foo_test.go", ok: false},
+		{arg: "./pkg/...", ok: false},
+		{arg: "foo_test.go:0", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, ok := parseTestPosition(tt.arg)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTestPositionPackage(t *testing.T) {
+	assert.Equal(t, "./pkg/foo", testPosition{File: "pkg/foo/a_test.go"}.Package())
+	assert.Equal(t, "./pkg", testPosition{File: "./pkg/a_test.go"}.Package())
+	assert.Equal(t, ".", testPosition{File: "a_test.go"}.Package())
+	assert.Equal(t, "../pkg", testPosition{File: "../pkg/a_test.go"}.Package())
+	assert.Equal(t, "/abs/pkg", testPosition{File: "/abs/pkg/a_test.go"}.Package())
+}
+
+func TestApplyTestPosition(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "foo_test.go")
+	require.NoError(t, os.WriteFile(file, []byte(positionTestFile), 0o644))
+	at := func(s string) string {
+		return file + ":" + strconv.Itoa(lineOf(t, positionTestFile, s))
+	}
+
+	t.Run("package argument", func(t *testing.T) {
+		ta, err := parseTestArgs([]string{"-v", at(`in:   0,`)})
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		target, err := applyTestPosition(ta, "", &buf)
+		require.NoError(t, err)
+		assert.Empty(t, target)
+		assert.Equal(t, []string{"test", "-v", "-run=^TestTable$/^zero$", dir}, ta.goArgs())
+		assert.Contains(t, buf.String(), "🎯 TestTable/zero at "+file)
+	})
+
+	t.Run("target", func(t *testing.T) {
+		ta, err := parseTestArgs(nil)
+		require.NoError(t, err)
+		target, err := applyTestPosition(ta, at("func TestPlain"), &bytes.Buffer{})
+		require.NoError(t, err)
+		assert.Equal(t, dir, target)
+		assert.Equal(t, "^TestPlain$", ta.value("-run"))
+	})
+
+	t.Run("benchmark", func(t *testing.T) {
+		ta, err := parseTestArgs([]string{at("func BenchmarkFoo")})
+		require.NoError(t, err)
+		_, err = applyTestPosition(ta, "", &bytes.Buffer{})
+		require.NoError(t, err)
+		assert.Equal(t, "^$", ta.value("-run"))
+		assert.Equal(t, "^BenchmarkFoo$", ta.value("-bench"))
+	})
+
+	t.Run("explicit -run", func(t *testing.T) {
+		ta, err := parseTestArgs([]string{"-run", "X", at("func TestPlain")})
+		require.NoError(t, err)
+		_, err = applyTestPosition(ta, "", &bytes.Buffer{})
+		assert.ErrorContains(t, err, "-run cannot be combined")
+	})
+
+	t.Run("benchmark with explicit -run", func(t *testing.T) {
+		ta, err := parseTestArgs([]string{"-run", "X", at("func BenchmarkFoo")})
+		require.NoError(t, err)
+		_, err = applyTestPosition(ta, "", &bytes.Buffer{})
+		assert.ErrorContains(t, err, "-run is not supported")
+	})
+
+	t.Run("several positions", func(t *testing.T) {
+		ta, err := parseTestArgs([]string{at("func TestPlain"), at("func TestMap")})
+		require.NoError(t, err)
+		_, err = applyTestPosition(ta, "", &bytes.Buffer{})
+		assert.ErrorContains(t, err, "only one file:line position")
+	})
+
+	t.Run("no position", func(t *testing.T) {
+		ta, err := parseTestArgs([]string{"./..."})
+		require.NoError(t, err)
+		target, err := applyTestPosition(ta, "./pkg", &bytes.Buffer{})
+		require.NoError(t, err)
+		assert.Equal(t, "./pkg", target)
+		assert.Equal(t, []string{"test", "./..."}, ta.goArgs())
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// syncRenderer serializes a renderer shared by concurrent test runs
+type syncRenderer struct {
+	mu sync.Mutex
+	r  testRenderer
+}
+
+func (sr *syncRenderer) event(ev testEvent) {
+	if er, ok := sr.r.(eventRenderer); ok {
+		sr.mu.Lock()
+		defer sr.mu.Unlock()
+		er.event(ev)
+	}
+}
+
+func (sr *syncRenderer) packageDone(p *packageResult) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.r.packageDone(p)
+}
+
+func (sr *syncRenderer) finish(r *testResults) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.r.finish(r)
+}
+
+// moduleCoverFile returns the per-module coverprofile path for a merged profile
+func moduleCoverFile(coverFile string, index int) string {
+	return fmt.Sprintf("%s.%d", coverFile, index)
+}
+
+// runWorkspaceTests runs go test ./... in every workspace module (package
+// arguments in goArgs are ignored), at most jobs at a time, feeding all
+// events into one results set. If goArgs write a coverprofile, each module
+// writes its own and they are merged into the requested file afterwards.
+// The error reports how many modules failed.
+func (cfg *GoShimConfig) runWorkspaceTests(ctx context.Context, goArgs []string, jobs int, results *testResults, renderer testRenderer) error {
+	base, err := parseGoTestArgs(goArgs)
+	if err != nil {
+		return err
+	}
+
+	modules, err := cfg.workspaceModuleDirs()
+	if err != nil {
+		return err
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	// go test resolves -coverprofile against the module directory it runs
+	// in, so pin it to the current directory like a plain go test would
+	coverFile := base.value("-coverprofile")
+	if coverFile != "" {
+		if coverFile, err = filepath.Abs(coverFile); err != nil {
+			return fmt.Errorf("failed to resolve coverprofile: %w", err)
+		}
+	}
+	shared := &syncRenderer{r: renderer}
+
+	errs := make([]error, len(modules))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, dir := range modules {
+		ta := base.clone()
+		if coverFile != "" {
+			ta.set("-coverprofile", moduleCoverFile(coverFile, i))
+		}
+		ta.Packages = []string{"./..."}
+		args := ta.goArgs()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			ctx := slogctx.With(ctx, "module", cfg.relativeToWorkspace(dir))
+			slogctx.Debug(ctx, "Testing module")
+			errs[i] = cfg.runGoTestJSON(ctx, dir, args, results, shared)
+		}()
+	}
+	wg.Wait()
+
+	if coverFile != "" {
+		if err := mergeModuleCoverProfiles(coverFile, len(modules)); err != nil {
+			slogctx.Warn(ctx, "Merging module coverprofiles failed", slogctx.Err(err))
+		}
+	}
+
+	// exit with the highest status of any module, so a module killed by a
+	// signal or failing to build is not reported as a plain test failure
+	var failed []string
+	code := 0
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, cfg.relativeToWorkspace(modules[i]))
+			code = max(code, exitCode(err))
+		}
+	}
+	if len(failed) > 0 {
+		return withExitCode(fmt.Errorf("%d of %d %s failed: %s", len(failed), len(modules),
+			pluralize(len(modules), "module", "modules"), strings.Join(failed, ", ")), code)
+	}
+	return nil
+}
+
+// mergeModuleCoverProfiles merges the per-module profiles written by
+// runWorkspaceTests into coverFile and removes them. Modules that failed to
+// build may not have written a profile and are skipped.
+func mergeModuleCoverProfiles(coverFile string, count int) error {
+	var merged *coverProfile
+	for i := 0; i < count; i++ {
+		file := moduleCoverFile(coverFile, i)
+		if !fileExists(file) {
+			continue
+		}
+		cp, err := readCoverProfile(file)
+		os.Remove(file)
+		if err != nil {
+			return err
+		}
+		if merged == nil {
+			merged = cp
+			continue
+		}
+		if err := merged.merge(cp); err != nil {
+			return err
+		}
+	}
+	if merged == nil {
+		return fmt.Errorf("no module wrote a coverprofile")
+	}
+
+	f, err := os.Create(coverFile)
+	if err != nil {
+		return fmt.Errorf("failed to write merged coverprofile: %w", err)
+	}
+	defer f.Close()
+	return merged.write(f)
+}
+
+// relativeToWorkspace shortens dir for display
+func (cfg *GoShimConfig) relativeToWorkspace(dir string) string {
+	if rel, err := filepath.Rel(cfg.WorkspaceRoot, dir); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return dir
+}
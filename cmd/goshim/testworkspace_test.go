@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverProfile_mergeAndWrite(t *testing.T) {
+	a, err := parseCoverProfile(strings.NewReader("mode: set\nexample.com/a/a.go:1.1,2.2 1 0\n"))
+	require.NoError(t, err)
+	b, err := parseCoverProfile(strings.NewReader("mode: set\nexample.com/a/a.go:1.1,2.2 1 1\nexample.com/b/b.go:3.1,4.2 2 0\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, a.merge(b))
+
+	var buf bytes.Buffer
+	require.NoError(t, a.write(&buf))
+	assert.Equal(t, "mode: set\nexample.com/a/a.go:1.1,2.2 1 1\nexample.com/b/b.go:3.1,4.2 2 0\n", buf.String())
+
+	atomic, err := parseCoverProfile(strings.NewReader("mode: atomic\n"))
+	require.NoError(t, err)
+	assert.Error(t, a.merge(atomic), "profiles with different modes cannot be merged")
+}
+
+func TestMergeModuleCoverProfiles(t *testing.T) {
+	coverFile := filepath.Join(t.TempDir(), "coverage.out")
+	require.NoError(t, os.WriteFile(moduleCoverFile(coverFile, 0), []byte("mode: atomic\nexample.com/a/a.go:1.1,2.2 1 3\n"), 0644))
+	// module 1 failed to build and wrote no profile
+	require.NoError(t, os.WriteFile(moduleCoverFile(coverFile, 2), []byte("mode: atomic\nexample.com/tools/t.go:1.1,2.2 1 0\n"), 0644))
+
+	require.NoError(t, mergeModuleCoverProfiles(coverFile, 3))
+
+	cp, err := readCoverProfile(coverFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com/a/a.go", "example.com/tools/t.go"}, cp.FileNames())
+	assert.NoFileExists(t, moduleCoverFile(coverFile, 0), "per-module profiles should be removed")
+
+	assert.Error(t, mergeModuleCoverProfiles(filepath.Join(t.TempDir(), "none.out"), 2))
+}
+
+func TestGoShimConfig_runWorkspaceTests_relativeCoverprofile(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "")
+	t.Setenv("GOTOOLCHAIN", "local")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.work":       "go 1.24\n\nuse (\n\t./a\n\t./b\n)\n",
+		"a/go.mod":      "module example.com/a\n\ngo 1.24\n",
+		"a/a.go":        "package a\n\nfunc A() int { return 1 }\n",
+		"a/a_test.go":   "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) { A() }\n",
+		"b/go.mod":      "module example.com/b\n\ngo 1.24\n",
+		"b/b.go":        "package b\n\nfunc B() int { return 2 }\n",
+		"b/b_test.go":   "package b\n\nimport \"testing\"\n\nfunc TestB(t *testing.T) { B() }\n",
+		"reports/.keep": "",
+	})
+	t.Chdir(filepath.Join(root, "reports"))
+
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+	results := newTestResults()
+	require.NoError(t, cfg.runWorkspaceTests(t.Context(), []string{"test", "-coverprofile", "cover.out"}, 2, results, &pkgnameRenderer{out: io.Discard}))
+
+	cp, err := readCoverProfile(filepath.Join(root, "reports", "cover.out"))
+	require.NoError(t, err, "the merged profile should be written relative to the current directory")
+	assert.Equal(t, []string{"example.com/a/a.go", "example.com/b/b.go"}, cp.FileNames())
+	assert.NoFileExists(t, filepath.Join(root, "a", "cover.out.0"), "per-module profiles should not land in module directories")
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// toolCacheDir returns where prebuilt tool binaries are kept: GOSHIM_TOOL_CACHE
+// or goshim/tools in the user cache directory. "" means the cache is off.
+func toolCacheDir() (string, error) {
+	switch dir := os.Getenv("GOSHIM_TOOL_CACHE"); dir {
+	case "off":
+		return "", nil
+	case "":
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find user cache dir: %w", err)
+		}
+		return filepath.Join(base, "goshim", "tools"), nil
+	default:
+		return dir, nil
+	}
+}
+
+// toolCacheEntry describes a cached tool binary. Its key covers everything
+// that determines the binary: the tool, its module version, the go toolchain
+// and target it was built with, and the inputs selecting its dependencies
+// and build options (see toolBuildInputs).
+type toolCacheEntry struct {
+	Tool      string    `json:"tool"`
+	Module    string    `json:"module"`
+	Version   string    `json:"version"`
+	GoVersion string    `json:"go_version"`
+	Platform  string    `json:"platform"`
+	Inputs    string    `json:"inputs"`
+	Built     time.Time `json:"built"`
+
+	dir  string
+	size int64
+}
+
+// Key returns the content address of the entry
+func (e toolCacheEntry) Key() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{e.Tool, e.Module, e.Version, e.GoVersion, e.Platform, e.Inputs}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// binaryName returns the file name of a tool binary
+func binaryName(tool string) string {
+	name := toolName(tool)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// toolCacheable reports whether a tool's binary is fully determined by its
+// module version: std tools, workspace modules and replaced modules are not
+func toolCacheable(ws *workspace, tool workspaceTool) bool {
+	if tool.ModulePath == "" || tool.Version == "" {
+		return false
+	}
+	replaces := ws.Replaces
+	for _, m := range ws.Modules {
+		if m.Dir == tool.Dir {
+			replaces = append(replaces, m.Replaces...)
+		}
+	}
+	for _, r := range replaces {
+		if r.Old.Path == tool.ModulePath {
+			return false
+		}
+	}
+	return true
+}
+
+// buildTarget is what the go command builds for in a directory
+type buildTarget struct {
+	GoVersion string
+	Platform  string // GOOS/GOARCH and CGO_ENABLED
+	GoWork    string // the go.work file in use, empty without one
+	Env       string // GOFLAGS and GOEXPERIMENT, which change what is built
+}
+
+// goBuildTarget returns the build target of the go command in dir,
+// honouring toolchain switches
+func (cfg *GoShimConfig) goBuildTarget(ctx context.Context, dir string) (buildTarget, error) {
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		return buildTarget{}, err
+	}
+
+	cmd := exec.CommandContext(ctx, goPath, "env", "GOVERSION", "GOOS", "GOARCH", "CGO_ENABLED", "GOWORK", "GOFLAGS", "GOEXPERIMENT")
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	out, err := cmd.Output()
+	if err != nil {
+		return buildTarget{}, fmt.Errorf("failed to run go env: %w", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != 7 {
+		return buildTarget{}, fmt.Errorf("unexpected go env output: %q", out)
+	}
+
+	target := buildTarget{
+		GoVersion: lines[0],
+		Platform:  lines[1] + "/" + lines[2] + " cgo=" + lines[3],
+		Env:       "GOFLAGS=" + lines[5] + " GOEXPERIMENT=" + lines[6],
+	}
+	if lines[4] != "off" {
+		target.GoWork = lines[4]
+	}
+	return target, nil
+}
+
+// toolBuildInputs hashes what selects a tool's dependencies and build
+// options beyond its own version: the go.mod and go.sum of the module
+// declaring it (requirements and replacements), the go.work and go.work.sum
+// in use, and the build environment
+func toolBuildInputs(dir string, target buildTarget) (string, error) {
+	files := []string{filepath.Join(dir, "go.mod"), filepath.Join(dir, "go.sum")}
+	if target.GoWork != "" {
+		files = append(files, target.GoWork, target.GoWork+".sum")
+	}
+
+	h := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		fmt.Fprintf(h, "%s %d\n", filepath.Base(file), len(data))
+		h.Write(data)
+	}
+	fmt.Fprintf(h, "%s\n", target.Env)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachedToolBinary returns the path of the cached binary of a cacheable tool,
+// building it first if needed
+func (cfg *GoShimConfig) cachedToolBinary(ctx context.Context, cacheDir string, tool workspaceTool) (string, error) {
+	target, err := cfg.goBuildTarget(ctx, tool.Dir)
+	if err != nil {
+		return "", err
+	}
+	inputs, err := toolBuildInputs(tool.Dir, target)
+	if err != nil {
+		return "", err
+	}
+
+	entry := toolCacheEntry{Tool: tool.Path, Module: tool.ModulePath, Version: tool.Version,
+		GoVersion: target.GoVersion, Platform: target.Platform, Inputs: inputs}
+	dir := filepath.Join(cacheDir, entry.Key())
+	bin := filepath.Join(dir, binaryName(tool.Path))
+	if fileExists(bin) {
+		return bin, nil
+	}
+
+	slogctx.Debug(ctx, "Building tool into the tool cache", slog.String("tool", tool.Path), slog.String("version", tool.Version))
+
+	// build into a temporary directory and rename it into place, so
+	// concurrent invocations never see a partial binary
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create tool cache: %w", err)
+	}
+	tmp, err := os.MkdirTemp(cacheDir, "build-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create tool build dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := cfg.buildTool(ctx, tool, filepath.Join(tmp, binaryName(tool.Path))); err != nil {
+		return "", err
+	}
+
+	entry.Built = time.Now()
+	meta, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tool cache entry: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "tool.json"), meta, 0644); err != nil {
+		return "", fmt.Errorf("failed to write tool cache entry: %w", err)
+	}
+
+	if err := os.Rename(tmp, dir); err != nil && !fileExists(bin) {
+		return "", fmt.Errorf("failed to store tool binary: %w", err)
+	}
+	return bin, nil
+}
+
+// buildTool builds a tool package to out from its owning module
+func (cfg *GoShimConfig) buildTool(ctx context.Context, tool workspaceTool, out string) error {
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, goPath, "build", "-o", out, tool.Path)
+	cmd.Dir = tool.Dir
+	cmd.Env = os.Environ()
+	var errOut bytes.Buffer
+	cmd.Stderr = &errOut
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to build %s: %w: %s", tool.Path, err, strings.TrimSpace(errOut.String()))
+	}
+	return nil
+}
+
+// toolBinary returns a prebuilt binary for the tool directive named by name
+// (a path or short name). ok is false when the tool is not a cacheable tool
+// directive or the cache is off, and callers should use go tool instead.
+func (cfg *GoShimConfig) toolBinary(ctx context.Context, name string) (string, bool, error) {
+	cacheDir, err := toolCacheDir()
+	if err != nil || cacheDir == "" {
+		return "", false, err
+	}
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return "", false, nil
+	}
+
+	tools := workspaceTools(ws)
+	resolveToolVersions(ws, tools)
+	tool, ok, err := resolveTool(tools, name)
+	if err != nil || !ok || !toolCacheable(ws, tool) {
+		return "", false, err
+	}
+
+	bin, err := cfg.cachedToolBinary(ctx, cacheDir, tool)
+	if err != nil {
+		return "", false, err
+	}
+	return bin, true, nil
+}
+
+// runTool runs a tool directive from the tool cache, falling back to go tool
+// when it cannot be cached
+func (cfg *GoShimConfig) runTool(ctx context.Context, name string, args ...string) error {
+	bin, ok, err := cfg.toolBinary(ctx, name)
+	if err != nil {
+		slogctx.Warn(ctx, "Tool cache unavailable, using go tool", slogctx.Err(err))
+	}
+	if !ok {
+		return cfg.execSafeGo(ctx, append([]string{"tool", name}, args...)...)
+	}
+
+	slogctx.Debug(ctx, "Executing cached tool", slog.String("binary", bin), slog.Any("args", args))
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Stdin = stdin
+	return runCommand(cmd)
+}
+
+// toolExecCommand returns a command line running the tool, for flags like go
+// test -exec that run it many times. Tools the cache cannot hold (e.g. ones
+// from workspace modules) are built once into a temporary directory that the
+// returned cleanup removes.
+func (cfg *GoShimConfig) toolExecCommand(ctx context.Context, pkg string) (string, func(), error) {
+	noop := func() {}
+
+	bin, ok, err := cfg.toolBinary(ctx, pkg)
+	if err != nil {
+		return "", noop, err
+	}
+	if ok {
+		return bin, noop, nil
+	}
+
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return "go tool " + pkg, noop, nil
+	}
+	tool, ok, err := resolveTool(workspaceTools(ws), pkg)
+	if err != nil || !ok {
+		return "go tool " + pkg, noop, err
+	}
+
+	tmp, err := os.MkdirTemp("", "goshim-tool-*")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create tool build dir: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	bin = filepath.Join(tmp, binaryName(tool.Path))
+	if err := cfg.buildTool(ctx, tool, bin); err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	return bin, cleanup, nil
+}
+
+// readToolCache returns the entries of the tool cache, oldest first
+func readToolCache(cacheDir string) ([]toolCacheEntry, error) {
+	dirs, err := os.ReadDir(cacheDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tool cache: %w", err)
+	}
+
+	var entries []toolCacheEntry
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), "build-") {
+			continue
+		}
+		dir := filepath.Join(cacheDir, d.Name())
+		data, err := os.ReadFile(filepath.Join(dir, "tool.json"))
+		if err != nil {
+			continue
+		}
+		var e toolCacheEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			continue
+		}
+		e.dir = dir
+		if info, err := os.Stat(filepath.Join(dir, binaryName(e.Tool))); err == nil {
+			e.size = info.Size()
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Built.Before(entries[j].Built) })
+	return entries, nil
+}
+
+// formatSize formats a byte count, e.g. "12.3 MB"
+func formatSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// printToolCache lists cached tool binaries
+func printToolCache(out io.Writer, cacheDir string, entries []toolCacheEntry) {
+	if len(entries) == 0 {
+		fmt.Fprintf(out, "Tool cache %s is empty\n", cacheDir)
+		return
+	}
+
+	toolWidth, versionWidth, goWidth := len("TOOL"), len("VERSION"), len("GO")
+	var total int64
+	for _, e := range entries {
+		toolWidth = max(toolWidth, len(e.Tool))
+		versionWidth = max(versionWidth, len(e.Version))
+		goWidth = max(goWidth, len(e.GoVersion))
+		total += e.size
+	}
+
+	fmt.Fprintf(out, "%-*s  %-*s  %-*s  %9s  %s\n", toolWidth, "TOOL", versionWidth, "VERSION", goWidth, "GO", "SIZE", "BUILT")
+	for _, e := range entries {
+		fmt.Fprintf(out, "%-*s  %-*s  %-*s  %9s  %s\n", toolWidth, e.Tool, versionWidth, e.Version, goWidth, e.GoVersion,
+			formatSize(e.size), e.Built.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(out, "%d cached %s, %s in %s\n", len(entries), pluralize(len(entries), "binary", "binaries"), formatSize(total), cacheDir)
+}
+
+// handleToolCache processes goshim tool cache list/clean
+func (cfg *GoShimConfig) handleToolCache(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("tool cache subcommand required: list or clean")
+	}
+
+	cacheDir, err := toolCacheDir()
+	if err != nil {
+		return err
+	}
+	if cacheDir == "" {
+		return fmt.Errorf("the tool cache is disabled by GOSHIM_TOOL_CACHE=off")
+	}
+
+	entries, err := readToolCache(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		printToolCache(stdout, cacheDir, entries)
+		return nil
+	case "clean":
+		// with arguments, only entries of the named tools are removed
+		var removed int
+		var freed int64
+		for _, e := range entries {
+			if len(args) > 1 && !matchesToolName(args[1:], e.Tool) {
+				continue
+			}
+			if err := os.RemoveAll(e.dir); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", e.dir, err)
+			}
+			removed++
+			freed += e.size
+		}
+		if len(args) == 1 {
+			// also drop leftovers of interrupted builds
+			leftovers, _ := filepath.Glob(filepath.Join(cacheDir, "build-*"))
+			for _, dir := range leftovers {
+				os.RemoveAll(dir)
+			}
+		}
+		fmt.Fprintf(stdout, "🧹 Removed %d cached %s (%s)\n", removed, pluralize(removed, "binary", "binaries"), formatSize(freed))
+		return nil
+	default:
+		return fmt.Errorf("unknown tool cache subcommand: %s", args[0])
+	}
+}
+
+// matchesToolName reports whether names holds the tool's path or short name
+func matchesToolName(names []string, tool string) bool {
+	for _, name := range names {
+		if name == tool || name == toolName(tool) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func TestToolCacheEntry_Key(t *testing.T) {
+	entry := toolCacheEntry{Tool: "example.com/hello/cmd/hello", Module: "example.com/hello", Version: "v1.0.0", GoVersion: "go1.24.0", Platform: "linux/amd64 cgo=1"}
+	assert.Equal(t, entry.Key(), entry.Key())
+
+	built := entry
+	built.Built = time.Now()
+	assert.Equal(t, entry.Key(), built.Key(), "the build time is not part of the key")
+
+	for name, change := range map[string]func(e *toolCacheEntry){
+		"version":    func(e *toolCacheEntry) { e.Version = "v1.0.1" },
+		"go version": func(e *toolCacheEntry) { e.GoVersion = "go1.24.1" },
+		"platform":   func(e *toolCacheEntry) { e.Platform = "darwin/arm64 cgo=1" },
+		"inputs":     func(e *toolCacheEntry) { e.Inputs = "f00d" },
+	} {
+		other := entry
+		change(&other)
+		assert.NotEqual(t, entry.Key(), other.Key(), name)
+	}
+}
+
+func TestToolBuildInputs(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.work":       "go 1.24\n\nuse ./tools\n",
+		"tools/go.mod":  "module example.com/tools\n\ngo 1.24\n\ntool example.com/hello/cmd/hello\n\nrequire example.com/hello v1.0.0\n",
+		"tools/go.sum":  "example.com/hello v1.0.0 h1:aaa=\n",
+		"tools/tool.go": "package tools\n",
+	})
+	dir := filepath.Join(root, "tools")
+	target := buildTarget{GoVersion: "go1.24.0", Platform: "linux/amd64 cgo=1", GoWork: filepath.Join(root, "go.work"), Env: "GOFLAGS= GOEXPERIMENT="}
+
+	inputs := func(target buildTarget) string {
+		t.Helper()
+		sum, err := toolBuildInputs(dir, target)
+		require.NoError(t, err)
+		return sum
+	}
+	base := inputs(target)
+	assert.Equal(t, base, inputs(target))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tool.go"), []byte("package tools // edited\n"), 0644))
+	assert.Equal(t, base, inputs(target), "sources of the declaring module do not matter")
+
+	for name, change := range map[string]func(){
+		"go.sum": func() { writeFiles(t, root, map[string]string{"tools/go.sum": "example.com/hello v1.0.0 h1:bbb=\n"}) },
+		"replace": func() {
+			writeFiles(t, root, map[string]string{"tools/go.mod": "module example.com/tools\n\nreplace example.com/dep => ../dep\n"})
+		},
+		"go.work.sum": func() { writeFiles(t, root, map[string]string{"go.work.sum": "example.com/dep v1.0.0 h1:ccc=\n"}) },
+		"go.work":     func() { writeFiles(t, root, map[string]string{"go.work": "go 1.24\n\nuse (\n\t./tools\n\t./dep\n)\n"}) },
+	} {
+		change()
+		changed := inputs(target)
+		assert.NotEqual(t, base, changed, name)
+		base = changed
+	}
+
+	tagged := target
+	tagged.Env = "GOFLAGS=-tags=netgo GOEXPERIMENT="
+	assert.NotEqual(t, base, inputs(tagged), "build flags change the binary")
+
+	noWork := target
+	noWork.GoWork = ""
+	assert.NotEqual(t, base, inputs(noWork), "building outside the workspace changes the build list")
+}
+
+func TestToolCacheable(t *testing.T) {
+	replace := func(path string) *modfile.Replace {
+		return &modfile.Replace{Old: module.Version{Path: path}, New: module.Version{Path: "../" + path}}
+	}
+	ws := &workspace{
+		Replaces: []*modfile.Replace{replace("example.com/forked")},
+		Modules: []workspaceModule{
+			{Dir: "/ws/tools", Path: "example.com/ws/tools", Replaces: []*modfile.Replace{replace("example.com/local")}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		tool workspaceTool
+		want bool
+	}{
+		{"module version", workspaceTool{Path: "example.com/hello/cmd/hello", Dir: "/ws/tools", ModulePath: "example.com/hello", Version: "v1.0.0"}, true},
+		{"std", workspaceTool{Path: "cmd/test2json", Dir: "/ws/tools"}, false},
+		{"workspace module", workspaceTool{Path: "example.com/ws/tools/cmd/gen", Dir: "/ws/tools", ModulePath: "example.com/ws/tools"}, false},
+		{"replaced in go.work", workspaceTool{Path: "example.com/forked/cmd/x", Dir: "/ws/tools", ModulePath: "example.com/forked", Version: "v1.0.0"}, false},
+		{"replaced in go.mod", workspaceTool{Path: "example.com/local/cmd/y", Dir: "/ws/tools", ModulePath: "example.com/local", Version: "v1.0.0"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, toolCacheable(ws, tt.tool))
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 kB", formatSize(1500))
+	assert.Equal(t, "12.3 MB", formatSize(12_300_000))
+}
+
+func TestGoShimConfig_handleToolCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("GOSHIM_TOOL_CACHE", cacheDir)
+
+	for i, tool := range []string{"gotest.tools/gotestsum", "github.com/vektra/mockery/v2"} {
+		entry := toolCacheEntry{Tool: tool, Module: tool, Version: "v1.0.0", GoVersion: "go1.24.0", Built: time.Date(2025, 1, i+1, 0, 0, 0, 0, time.UTC)}
+		meta, err := json.Marshal(entry)
+		require.NoError(t, err)
+		writeFiles(t, filepath.Join(cacheDir, entry.Key()), map[string]string{
+			"tool.json":      string(meta),
+			binaryName(tool): "binary",
+		})
+	}
+	writeFiles(t, filepath.Join(cacheDir, "build-123"), map[string]string{"partial": ""})
+
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	cfg := &GoShimConfig{}
+	require.NoError(t, cfg.handleToolCache([]string{"list"}))
+	assert.Contains(t, buf.String(), "gotest.tools/gotestsum        v1.0.0   go1.24.0")
+	assert.Contains(t, buf.String(), "2 cached binaries, 12 B in "+cacheDir)
+
+	buf.Reset()
+	require.NoError(t, cfg.handleToolCache([]string{"clean", "mockery"}))
+	assert.Contains(t, buf.String(), "Removed 1 cached binary (6 B)")
+	entries, err := readToolCache(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "gotest.tools/gotestsum", entries[0].Tool)
+	assert.DirExists(t, filepath.Join(cacheDir, "build-123"), "a partial clean keeps in-flight builds")
+
+	buf.Reset()
+	require.NoError(t, cfg.handleToolCache([]string{"clean"}))
+	assert.Contains(t, buf.String(), "Removed 1 cached binary")
+	assert.NoDirExists(t, filepath.Join(cacheDir, "build-123"))
+
+	t.Setenv("GOSHIM_TOOL_CACHE", "off")
+	assert.ErrorContains(t, cfg.handleToolCache([]string{"list"}), "disabled")
+}
+
+func TestGoShimConfig_toolBinary(t *testing.T) {
+	proxy := t.TempDir()
+	writeProxyModuleFiles(t, proxy, "example.com/hello", map[string]string{
+		"cmd/hello/main.go": "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc main() { fmt.Println(\"hello\", os.Args[1:]) }\n",
+	}, "v1.0.0")
+
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(proxy))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOFLAGS", "-modcacherw")
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GOTOOLCHAIN", "local")
+	t.Setenv("GOWORK", "")
+	cacheDir := t.TempDir()
+	t.Setenv("GOSHIM_TOOL_CACHE", cacheDir)
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":   "module example.com/ws\n\ngo 1.24\n",
+		"tools.go": "package ws\n",
+	})
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	require.NoError(t, cfg.runToolAdd(t.Context(), []string{"example.com/hello/cmd/hello@v1.0.0"}))
+
+	ctx := t.Context()
+	bin, ok, err := cfg.toolBinary(ctx, "hello")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, cacheDir, filepath.Dir(filepath.Dir(bin)))
+	info, err := os.Stat(bin)
+	require.NoError(t, err)
+
+	again, ok, err := cfg.toolBinary(ctx, "example.com/hello/cmd/hello")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, bin, again)
+	reused, err := os.Stat(again)
+	require.NoError(t, err)
+	assert.Equal(t, info.ModTime(), reused.ModTime(), "a cached binary is not rebuilt")
+
+	t.Setenv("GOFLAGS", "-modcacherw -tags=netgo")
+	tagged, ok, err := cfg.toolBinary(ctx, "hello")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.NotEqual(t, bin, tagged, "build flags are part of the cache key")
+	t.Setenv("GOFLAGS", "-modcacherw")
+
+	buf.Reset()
+	require.NoError(t, cfg.runTool(ctx, "hello", "a", "b"))
+	assert.Equal(t, "hello [a b]\n", buf.String())
+
+	_, ok, err = cfg.toolBinary(ctx, "test2json")
+	require.NoError(t, err)
+	assert.False(t, ok, "tools that are not directives use go tool")
+
+	t.Setenv("GOSHIM_TOOL_CACHE", "off")
+	_, ok, err = cfg.toolBinary(ctx, "hello")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
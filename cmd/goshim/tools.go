@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	slogctx "github.com/veqryn/slog-context"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// workspaceTool is a tool directive of a workspace module
+type workspaceTool struct {
+	Path       string // package path
+	Dir        string // owning workspace module
+	ModulePath string // module providing the package, empty for std
+	Version    string // required version of ModulePath, empty for workspace modules
+}
+
+// Name returns the short name of a tool: the last path element, skipping a
+// major version suffix, the way go tool and go install name binaries
+func (t workspaceTool) Name() string {
+	return toolName(t.Path)
+}
+
+// toolName returns the short name of a tool package path
+func toolName(pkg string) string {
+	name := path.Base(pkg)
+	if _, pathMajor, ok := module.SplitPathVersion(pkg); ok && strings.HasPrefix(pathMajor, "/") {
+		name = path.Base(path.Dir(pkg))
+	}
+	return name
+}
+
+// workspaceTools returns the tool directives of every workspace module
+func workspaceTools(ws *workspace) []workspaceTool {
+	var tools []workspaceTool
+	for _, m := range ws.Modules {
+		for _, pkg := range m.Tools {
+			tools = append(tools, workspaceTool{Path: pkg, Dir: m.Dir})
+		}
+	}
+	sort.SliceStable(tools, func(i, j int) bool { return tools[i].Path < tools[j].Path })
+	return tools
+}
+
+// providingModule returns the longest module path that is a prefix of pkg
+func providingModule(pkg string, modulePaths []string) string {
+	best := ""
+	for _, mp := range modulePaths {
+		if (pkg == mp || strings.HasPrefix(pkg, mp+"/")) && len(mp) > len(best) {
+			best = mp
+		}
+	}
+	return best
+}
+
+// resolveToolVersions fills in the providing module and version of each
+// tool from the workspace's requirements. Workspace builds select the
+// highest version any module requires, so that is the version reported.
+func resolveToolVersions(ws *workspace, tools []workspaceTool) {
+	versions := map[string]string{}
+	var paths []string
+	for _, m := range ws.Modules {
+		versions[m.Path] = ""
+		paths = append(paths, m.Path)
+		for _, req := range m.Requires {
+			v, seen := versions[req.Mod.Path]
+			if !seen {
+				paths = append(paths, req.Mod.Path)
+			}
+			if !seen || semver.Compare(req.Mod.Version, v) > 0 {
+				versions[req.Mod.Path] = req.Mod.Version
+			}
+		}
+	}
+	for i := range tools {
+		tools[i].ModulePath = providingModule(tools[i].Path, paths)
+		tools[i].Version = versions[tools[i].ModulePath]
+	}
+}
+
+// resolveTool finds the tool directive named by name, either its full
+// package path or its short name. ok is false when nothing matches. A tool
+// declared by several workspace modules resolves to the first of them.
+func resolveTool(tools []workspaceTool, name string) (workspaceTool, bool, error) {
+	byPath := map[string]workspaceTool{}
+	var paths []string
+	for _, t := range tools {
+		if t.Path != name && t.Name() != name {
+			continue
+		}
+		if _, seen := byPath[t.Path]; seen {
+			continue
+		}
+		byPath[t.Path] = t
+		paths = append(paths, t.Path)
+	}
+
+	if p, ok := byPath[name]; ok {
+		return p, true, nil
+	}
+	switch len(paths) {
+	case 0:
+		return workspaceTool{}, false, nil
+	case 1:
+		return byPath[paths[0]], true, nil
+	default:
+		return workspaceTool{}, false, fmt.Errorf("tool name %q is ambiguous: %s", name, strings.Join(paths, ", "))
+	}
+}
+
+// resolveToolArg expands a short tool name to its full package path. Names
+// that are paths, flags or unknown (e.g. builtin tools like vet) are kept.
+func (cfg *GoShimConfig) resolveToolArg(ctx context.Context, name string) (string, error) {
+	if name == "" || strings.Contains(name, "/") || strings.HasPrefix(name, "-") {
+		return name, nil
+	}
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return name, nil
+	}
+
+	tool, ok, err := resolveTool(workspaceTools(ws), name)
+	if err != nil || !ok {
+		return name, err
+	}
+	slogctx.Debug(ctx, "Resolved tool", slog.String("name", name), slog.String("tool", tool.Path))
+	return tool.Path, nil
+}
+
+// printTools lists the tools with their version and owning module
+func (cfg *GoShimConfig) printTools(out io.Writer, tools []workspaceTool) {
+	if len(tools) == 0 {
+		fmt.Fprintln(out, "No tool directives in workspace modules")
+		return
+	}
+
+	nameWidth, pathWidth, versionWidth := len("NAME"), len("TOOL"), len("VERSION")
+	for _, t := range tools {
+		nameWidth = max(nameWidth, len(t.Name()))
+		pathWidth = max(pathWidth, len(t.Path))
+		versionWidth = max(versionWidth, len(toolVersion(t)))
+	}
+
+	fmt.Fprintf(out, "%-*s  %-*s  %-*s  %s\n", nameWidth, "NAME", pathWidth, "TOOL", versionWidth, "VERSION", "MODULE")
+	for _, t := range tools {
+		fmt.Fprintf(out, "%-*s  %-*s  %-*s  %s\n", nameWidth, t.Name(), pathWidth, t.Path, versionWidth, toolVersion(t), cfg.relativeToWorkspace(t.Dir))
+	}
+}
+
+// toolVersion describes the version a tool is built at
+func toolVersion(t workspaceTool) string {
+	switch {
+	case t.ModulePath == "" && !strings.Contains(strings.SplitN(t.Path, "/", 2)[0], "."):
+		return "std"
+	case t.Version == "":
+		return "(workspace)"
+	default:
+		return t.Version
+	}
+}
+
+// runToolList prints the tool directives of every workspace module
+func (cfg *GoShimConfig) runToolList(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments to tool list: %s", strings.Join(args, " "))
+	}
+
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return err
+	}
+	tools := workspaceTools(ws)
+	resolveToolVersions(ws, tools)
+	cfg.printTools(stdout, tools)
+	return nil
+}
+
+// toolModuleDir picks the module a new tool is added to: the one given with
+// -module (a module path or a directory relative to the root), else one
+// already requiring the tool's module, else the module with the most tool
+// directives (e.g. tools/)
+func toolModuleDir(ws *workspace, pkg, moduleFlag string) (string, error) {
+	if moduleFlag != "" {
+		dir := moduleFlag
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(ws.Root, dir)
+		}
+		for _, m := range ws.Modules {
+			if m.Dir == dir || m.Path == moduleFlag {
+				return m.Dir, nil
+			}
+		}
+		return "", fmt.Errorf("%s is not a workspace module", moduleFlag)
+	}
+
+	for _, m := range ws.Modules {
+		var required []string
+		for _, req := range m.Requires {
+			required = append(required, req.Mod.Path)
+		}
+		if providingModule(pkg, required) != "" {
+			return m.Dir, nil
+		}
+	}
+
+	best := ws.Modules[0]
+	for _, m := range ws.Modules[1:] {
+		if len(m.Tools) > len(best.Tools) {
+			best = m
+		}
+	}
+	return best.Dir, nil
+}
+
+// runToolAdd adds a tool directive with go get -tool
+func (cfg *GoShimConfig) runToolAdd(ctx context.Context, args []string) error {
+	var moduleFlag string
+	var pkgs []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-module" && i+1 < len(args):
+			moduleFlag = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "-module="):
+			moduleFlag = strings.TrimPrefix(arg, "-module=")
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown tool add flag: %s", arg)
+		default:
+			pkgs = append(pkgs, arg)
+		}
+	}
+	if len(pkgs) == 0 {
+		return fmt.Errorf("usage: goshim tool add [-module dir] <package>[@version]...")
+	}
+
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return err
+	}
+
+	pkg, _, _ := strings.Cut(pkgs[0], "@")
+	dir, err := toolModuleDir(ws, pkg, moduleFlag)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.runGoIn(ctx, dir, append([]string{"get", "-tool"}, pkgs...)...); err != nil {
+		return fmt.Errorf("failed to add %s: %w", strings.Join(pkgs, ", "), err)
+	}
+	fmt.Fprintf(stdout, "🔧 Added %s to %s\n", strings.Join(pkgs, ", "), cfg.relativeToWorkspace(dir))
+	return nil
+}
+
+// runToolRemove drops tool directives, by full path or short name, from every
+// module declaring them and tidies those modules
+func (cfg *GoShimConfig) runToolRemove(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: goshim tool remove <tool>...")
+	}
+
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return err
+	}
+	tools := workspaceTools(ws)
+
+	byDir := map[string][]string{}
+	var dirs []string
+	for _, name := range args {
+		tool, ok, err := resolveTool(tools, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("no tool directive matches %s", name)
+		}
+		for _, t := range tools {
+			if t.Path != tool.Path || slices.Contains(byDir[t.Dir], t.Path) {
+				continue
+			}
+			if _, seen := byDir[t.Dir]; !seen {
+				dirs = append(dirs, t.Dir)
+			}
+			byDir[t.Dir] = append(byDir[t.Dir], t.Path)
+		}
+	}
+
+	for _, dir := range dirs {
+		editArgs := []string{"mod", "edit"}
+		for _, pkg := range byDir[dir] {
+			editArgs = append(editArgs, "-droptool="+pkg)
+		}
+		if err := cfg.runGoIn(ctx, dir, editArgs...); err != nil {
+			return fmt.Errorf("failed to remove tools from %s: %w", cfg.relativeToWorkspace(dir), err)
+		}
+		if r := cfg.tidyModule(ctx, dir, false, stdout); r.Err != nil {
+			return fmt.Errorf("failed to tidy %s: %w", cfg.relativeToWorkspace(dir), r.Err)
+		}
+		fmt.Fprintf(stdout, "🔧 Removed %s from %s\n", strings.Join(byDir[dir], ", "), cfg.relativeToWorkspace(dir))
+	}
+	return nil
+}
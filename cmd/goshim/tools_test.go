@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func TestToolName(t *testing.T) {
+	tests := map[string]string{
+		"gotest.tools/gotestsum":              "gotestsum",
+		"github.com/vektra/mockery/v2":        "mockery",
+		"github.com/go-task/task/v3/cmd/task": "task",
+		"cmd/test2json":                       "test2json",
+		"gopkg.in/yaml.v3":                    "yaml.v3",
+	}
+	for pkg, want := range tests {
+		assert.Equal(t, want, toolName(pkg), pkg)
+	}
+}
+
+func TestResolveTool(t *testing.T) {
+	tools := []workspaceTool{
+		{Path: "gotest.tools/gotestsum", Dir: "/ws/tools"},
+		{Path: "github.com/ogen-go/ogen/cmd/ogen", Dir: "/ws/tools"},
+		{Path: "example.com/a/cmd/gen", Dir: "/ws"},
+		{Path: "example.com/b/cmd/gen", Dir: "/ws/tools"},
+	}
+
+	tool, ok, err := resolveTool(tools, "gotestsum")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "gotest.tools/gotestsum", tool.Path)
+
+	tool, ok, err = resolveTool(tools, "example.com/b/cmd/gen")
+	require.NoError(t, err)
+	assert.True(t, ok, "full paths always resolve")
+	assert.Equal(t, "/ws/tools", tool.Dir)
+
+	_, ok, err = resolveTool(tools, "vet")
+	require.NoError(t, err)
+	assert.False(t, ok, "unknown names are left to go tool")
+
+	_, _, err = resolveTool(tools, "gen")
+	assert.ErrorContains(t, err, "ambiguous")
+
+	// the same tool declared by two workspace modules is not ambiguous
+	shared := append(tools, workspaceTool{Path: "gotest.tools/gotestsum", Dir: "/ws/other"})
+	tool, ok, err = resolveTool(shared, "gotestsum")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "/ws/tools", tool.Dir, "the first declaration wins")
+}
+
+func TestResolveToolVersions(t *testing.T) {
+	req := func(path, version string) *modfile.Require {
+		return &modfile.Require{Mod: module.Version{Path: path, Version: version}}
+	}
+	ws := &workspace{Modules: []workspaceModule{
+		{Dir: "/ws", Path: "example.com/ws", Tools: []string{"example.com/ws/cmd/gen"},
+			Requires: []*modfile.Require{req("github.com/ogen-go/ogen", "v1.2.0")}},
+		{Dir: "/ws/tools", Path: "example.com/ws/tools", Tools: []string{"cmd/test2json", "github.com/ogen-go/ogen/cmd/ogen"},
+			Requires: []*modfile.Require{req("github.com/ogen-go/ogen", "v1.10.0")}},
+	}}
+
+	tools := workspaceTools(ws)
+	resolveToolVersions(ws, tools)
+
+	require.Len(t, tools, 3)
+	assert.Equal(t, "std", toolVersion(tools[0]))
+	assert.Equal(t, "example.com/ws", tools[1].ModulePath)
+	assert.Equal(t, "(workspace)", toolVersion(tools[1]))
+	assert.Equal(t, "github.com/ogen-go/ogen", tools[2].ModulePath)
+	assert.Equal(t, "v1.10.0", tools[2].Version, "the highest requirement is selected")
+}
+
+func TestToolModuleDir(t *testing.T) {
+	ws := &workspace{Root: "/ws", Modules: []workspaceModule{
+		{Dir: "/ws", Path: "example.com/ws", Tools: []string{"example.com/ws/cmd/gen"}},
+		{Dir: "/ws/tools", Path: "example.com/ws/tools", Tools: []string{"a.com/x", "b.com/y"},
+			Requires: []*modfile.Require{{Mod: module.Version{Path: "a.com/x", Version: "v1.0.0"}}}},
+	}}
+
+	dir, err := toolModuleDir(ws, "c.com/new", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/ws/tools", dir, "new tools go to the module with the most tools")
+
+	dir, err = toolModuleDir(ws, "c.com/new", ".")
+	require.NoError(t, err)
+	assert.Equal(t, "/ws", dir)
+
+	dir, err = toolModuleDir(ws, "c.com/new", "example.com/ws")
+	require.NoError(t, err)
+	assert.Equal(t, "/ws", dir)
+
+	_, err = toolModuleDir(ws, "c.com/new", "missing")
+	assert.Error(t, err)
+}
+
+func TestGoShimConfig_toolAddRemove(t *testing.T) {
+	proxy := t.TempDir()
+	writeProxyModuleFiles(t, proxy, "example.com/hello", map[string]string{
+		"cmd/hello/main.go": "package main\n\nfunc main() {}\n",
+	}, "v1.0.0")
+
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(proxy))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOFLAGS", "-modcacherw")
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GOTOOLCHAIN", "local")
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.work":        "go 1.24\n\nuse (\n\t.\n\t./tools\n)\n",
+		"go.mod":         "module example.com/ws\n\ngo 1.24\n",
+		"tools/go.mod":   "module example.com/ws/tools\n\ngo 1.24\n\ntool cmd/test2json\n",
+		"tools/tools.go": "package tools\n",
+	})
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+
+	require.NoError(t, cfg.runToolAdd(t.Context(), []string{"example.com/hello/cmd/hello@v1.0.0"}))
+	data, err := os.ReadFile(filepath.Join(root, "tools", "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "example.com/hello/cmd/hello")
+
+	name, err := cfg.resolveToolArg(t.Context(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/hello/cmd/hello", name)
+
+	// declared by both modules, remove drops it from each of them
+	require.NoError(t, cfg.runToolAdd(t.Context(), []string{"-module", ".", "example.com/hello/cmd/hello@v1.0.0"}))
+
+	var out bytes.Buffer
+	oldStdout := stdout
+	stdout = &out
+	defer func() { stdout = oldStdout }()
+
+	require.NoError(t, cfg.runToolRemove(t.Context(), []string{"hello"}))
+	data, err = os.ReadFile(filepath.Join(root, "tools", "go.mod"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "example.com/hello")
+	assert.Contains(t, string(data), "cmd/test2json")
+	data, err = os.ReadFile(filepath.Join(root, "go.mod"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "example.com/hello")
+	assert.Equal(t, 2, strings.Count(out.String(), "Removed example.com/hello/cmd/hello"), "each module should be reported")
+
+	assert.ErrorContains(t, cfg.runToolRemove(t.Context(), []string{"hello"}), "no tool directive matches hello")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// truncateWriter caps the number of lines written to a stream by keeping
+// the first and last lines and spilling everything in between to a file.
+// Head lines are written immediately; tail lines are held in a ring buffer
+// until Close.
+type truncateWriter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	stream   string
+	spillDir string
+	maxHead  int
+	maxTail  int
+
+	// passthrough disables truncation, e.g. for IDE raw mode
+	passthrough bool
+
+	partial   []byte
+	headLines int
+	tail      []string
+	tailStart int
+
+	spill     *os.File
+	spillPath string
+	elided    int
+	spillErr  error
+}
+
+// newTruncateWriter wraps out so that at most maxLines lines are written,
+// split evenly between the head and the tail of the output
+func newTruncateWriter(out io.Writer, stream string, maxLines int, spillDir string) *truncateWriter {
+	head := maxLines / 2
+	return &truncateWriter{
+		out:      out,
+		stream:   stream,
+		spillDir: spillDir,
+		maxHead:  head,
+		maxTail:  maxLines - head,
+	}
+}
+
+// Write emits head lines directly and buffers the rest
+func (tw *truncateWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.passthrough {
+		return tw.out.Write(p)
+	}
+
+	tw.partial = append(tw.partial, p...)
+	for {
+		idx := bytes.IndexByte(tw.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		line := string(tw.partial[:idx+1])
+		tw.partial = tw.partial[idx+1:]
+
+		if err := tw.addLine(line); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// addLine routes a complete line to the head, the tail ring or the spill file
+func (tw *truncateWriter) addLine(line string) error {
+	if tw.headLines < tw.maxHead {
+		tw.headLines++
+		_, err := io.WriteString(tw.out, line)
+		return err
+	}
+
+	if tw.maxTail == 0 {
+		tw.spillLine(line)
+		return nil
+	}
+
+	if len(tw.tail) < tw.maxTail {
+		tw.tail = append(tw.tail, line)
+		return nil
+	}
+
+	// ring is full, evict the oldest tail line into the spill file
+	tw.spillLine(tw.tail[tw.tailStart])
+	tw.tail[tw.tailStart] = line
+	tw.tailStart = (tw.tailStart + 1) % len(tw.tail)
+	return nil
+}
+
+// spillLine writes an elided line to the spill file, creating it on first use
+func (tw *truncateWriter) spillLine(line string) {
+	tw.elided++
+
+	if tw.spillErr != nil {
+		return
+	}
+
+	if tw.spill == nil {
+		if err := os.MkdirAll(tw.spillDir, 0755); err != nil {
+			tw.spillErr = fmt.Errorf("failed to create spill directory: %w", err)
+			return
+		}
+
+		timestamp := fmt.Sprintf("%s_%d", time.Now().Format("2006-01-02_15-04-05.000000"), os.Getpid())
+		path := filepath.Join(tw.spillDir, fmt.Sprintf("%s_%s-truncated.log", timestamp, tw.stream))
+
+		file, err := os.Create(path)
+		if err != nil {
+			tw.spillErr = fmt.Errorf("failed to create spill file: %w", err)
+			return
+		}
+		tw.spill = file
+		tw.spillPath = path
+	}
+
+	if _, err := tw.spill.WriteString(line); err != nil {
+		tw.spillErr = fmt.Errorf("failed to write spill file: %w", err)
+	}
+}
+
+// tailLines returns the buffered tail in output order
+func (tw *truncateWriter) tailLines() []string {
+	return append(append([]string{}, tw.tail[tw.tailStart:]...), tw.tail[:tw.tailStart]...)
+}
+
+// Disable flushes anything buffered and passes all further writes through
+func (tw *truncateWriter) Disable() error {
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.passthrough = true
+	return nil
+}
+
+// Close writes the elision notice and the buffered tail
+func (tw *truncateWriter) Close() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.passthrough {
+		return nil
+	}
+
+	if len(tw.partial) > 0 {
+		line := string(tw.partial)
+		tw.partial = nil
+		if err := tw.addLine(line); err != nil {
+			return err
+		}
+	}
+
+	if tw.elided > 0 {
+		var notice string
+		switch {
+		case tw.spillErr != nil:
+			notice = fmt.Sprintf("✂️  goshim: %d %s elided from %s (%v)\n", tw.elided, pluralize(tw.elided, "line", "lines"), tw.stream, tw.spillErr)
+		default:
+			notice = fmt.Sprintf("✂️  goshim: %d %s elided from %s, full output in %s\n", tw.elided, pluralize(tw.elided, "line", "lines"), tw.stream, tw.spillPath)
+		}
+		if _, err := io.WriteString(tw.out, notice); err != nil {
+			return err
+		}
+	}
+
+	for _, line := range tw.tailLines() {
+		if _, err := io.WriteString(tw.out, line); err != nil {
+			return err
+		}
+	}
+
+	if tw.spill != nil {
+		tw.spill.Close()
+		tw.spill = nil
+	}
+
+	tw.tail = nil
+	tw.tailStart = 0
+	tw.headLines = 0
+	tw.elided = 0
+
+	return nil
+}
+
+// setupOutputTruncation wraps the global stdout and stderr writers so each
+// stream is capped at MaxLines lines. A MaxLines of zero or less disables it.
+func (cfg *GoShimConfig) setupOutputTruncation() {
+	if cfg.MaxLines <= 0 {
+		return
+	}
+
+	if cfg.footer == nil {
+		cfg.footer = stderr
+	}
+
+	spillDir := filepath.Join(cfg.WorkspaceRoot, ".log", "goshim")
+	cfg.stdoutTruncate = newTruncateWriter(stdout, "stdout", cfg.MaxLines, spillDir)
+	cfg.stderrTruncate = newTruncateWriter(stderr, "stderr", cfg.MaxLines, spillDir)
+
+	stdout = cfg.stdoutTruncate
+	stderr = cfg.stderrTruncate
+}
+
+// flushOutputTruncation ends the current truncation window: the elision
+// notice and the buffered tail are written and the next line starts a new
+// head. Long running commands call it after each unit of output.
+func (cfg *GoShimConfig) flushOutputTruncation() {
+	for _, tw := range []*truncateWriter{cfg.stdoutTruncate, cfg.stderrTruncate} {
+		if tw != nil {
+			tw.Close()
+		}
+	}
+}
+
+// disableOutputTruncation turns truncation off for the rest of the run
+func (cfg *GoShimConfig) disableOutputTruncation() {
+	for _, tw := range []*truncateWriter{cfg.stdoutTruncate, cfg.stderrTruncate} {
+		if tw != nil {
+			tw.Disable()
+		}
+	}
+}
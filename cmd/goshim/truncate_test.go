@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func numberedLines(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	return sb.String()
+}
+
+func TestTruncateWriter(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxLines   int
+		input      string
+		wantPrefix string
+		wantSuffix string
+		wantElided int
+	}{
+		{
+			name:       "under the limit passes through",
+			maxLines:   10,
+			input:      numberedLines(5),
+			wantPrefix: numberedLines(5),
+			wantSuffix: numberedLines(5),
+			wantElided: 0,
+		},
+		{
+			name:       "exactly at the limit passes through",
+			maxLines:   4,
+			input:      numberedLines(4),
+			wantPrefix: numberedLines(4),
+			wantSuffix: numberedLines(4),
+			wantElided: 0,
+		},
+		{
+			name:       "keeps head and tail",
+			maxLines:   4,
+			input:      numberedLines(10),
+			wantPrefix: "line 1\nline 2\n✂️  goshim: 6 lines elided from stdout",
+			wantSuffix: "line 9\nline 10\n",
+			wantElided: 6,
+		},
+		{
+			name:       "odd limit gives the extra line to the tail",
+			maxLines:   3,
+			input:      numberedLines(5),
+			wantPrefix: "line 1\n✂️  goshim: 2 lines elided from stdout",
+			wantSuffix: "line 4\nline 5\n",
+			wantElided: 2,
+		},
+		{
+			name:       "unterminated last line is kept",
+			maxLines:   2,
+			input:      "a\nb\nc\nd",
+			wantPrefix: "a\n✂️  goshim: 2 lines elided from stdout",
+			wantSuffix: "d",
+			wantElided: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spillDir := t.TempDir()
+			var buf bytes.Buffer
+			tw := newTruncateWriter(&buf, "stdout", tt.maxLines, spillDir)
+
+			_, err := tw.Write([]byte(tt.input))
+			require.NoError(t, err, "write should succeed")
+			require.NoError(t, tw.Close(), "close should succeed")
+
+			out := buf.String()
+			assert.True(t, strings.HasPrefix(out, tt.wantPrefix), "output should start with %q, got %q", tt.wantPrefix, out)
+			assert.True(t, strings.HasSuffix(out, tt.wantSuffix), "output should end with %q, got %q", tt.wantSuffix, out)
+
+			entries, err := os.ReadDir(spillDir)
+			require.NoError(t, err, "spill dir should be readable")
+			if tt.wantElided == 0 {
+				assert.Empty(t, entries, "no spill file should be created")
+				return
+			}
+
+			require.Len(t, entries, 1, "one spill file should be created")
+			assert.Contains(t, out, filepath.Join(spillDir, entries[0].Name()), "notice should include spill path")
+
+			spilled, err := os.ReadFile(filepath.Join(spillDir, entries[0].Name()))
+			require.NoError(t, err, "spill file should be readable")
+			assert.Equal(t, tt.wantElided, strings.Count(string(spilled), "\n"), "spill file should hold the elided lines")
+		})
+	}
+}
+
+func TestTruncateWriter_Disable(t *testing.T) {
+	var buf bytes.Buffer
+	tw := newTruncateWriter(&buf, "stderr", 2, t.TempDir())
+
+	require.NoError(t, tw.Disable(), "disable should succeed")
+
+	_, err := tw.Write([]byte(numberedLines(10)))
+	require.NoError(t, err, "write should succeed")
+	require.NoError(t, tw.Close(), "close should succeed")
+
+	assert.Equal(t, numberedLines(10), buf.String(), "disabled writer should pass everything through")
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// watchPollInterval is how often -watch checks the workspace for changes
+var watchPollInterval = 500 * time.Millisecond
+
+// watchDebounce is how long changes must settle before -watch reruns tests,
+// so saving several files (or a formatter rewriting them) runs once
+var watchDebounce = 300 * time.Millisecond
+
+// fileStamp identifies a version of a watched file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchedFile reports whether a change to the file at rel (relative to the
+// workspace root) can change test results: Go sources, module files and
+// anything in a testdata directory
+func watchedFile(rel string) bool {
+	if filepath.Ext(rel) == ".go" || moduleFiles[filepath.Base(rel)] {
+		return true
+	}
+	return slices.Contains(strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/"), "testdata")
+}
+
+// scanWatchedFiles stamps every watched file beneath root, skipping what
+// ./... skips apart from testdata (vendor and directories starting with . or
+// _) and node_modules, which can be huge and never holds Go packages
+func scanWatchedFiles(root string) (map[string]fileStamp, error) {
+	files := map[string]fileStamp{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// files may disappear while walking, the next scan sees the result
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || !watchedFile(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// diffWatchedFiles returns the files added, removed or modified between two
+// scans, sorted
+func diffWatchedFiles(before, after map[string]fileStamp) []string {
+	var changed []string
+	for path, stamp := range after {
+		if old, ok := before[path]; !ok || !old.modTime.Equal(stamp.modTime) || old.size != stamp.size {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// fileWatcher polls the module directories of a workspace, and the go.work
+// files at its root, for changes to watched files
+type fileWatcher struct {
+	root  string
+	dirs  []string
+	files map[string]fileStamp
+}
+
+// newFileWatcher takes the first scan of the module directories dirs of the
+// workspace at root
+func newFileWatcher(root string, dirs []string) (*fileWatcher, error) {
+	w := &fileWatcher{root: root}
+	if err := w.setDirs(dirs); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// setDirs changes the watched module directories and takes a new first scan.
+// Directories inside another one are walked as part of it.
+func (w *fileWatcher) setDirs(dirs []string) error {
+	w.dirs = nil
+	for _, dir := range slices.Sorted(slices.Values(dirs)) {
+		if n := len(w.dirs); n > 0 && (dir == w.dirs[n-1] || strings.HasPrefix(dir, w.dirs[n-1]+string(filepath.Separator))) {
+			continue
+		}
+		w.dirs = append(w.dirs, dir)
+	}
+	files, err := w.scan()
+	if err != nil {
+		return err
+	}
+	w.files = files
+	return nil
+}
+
+// scan stamps the go.work files and every watched file of the module
+// directories
+func (w *fileWatcher) scan() (map[string]fileStamp, error) {
+	files := map[string]fileStamp{}
+	for _, name := range []string{"go.work", "go.work.sum"} {
+		path := filepath.Join(w.root, name)
+		if info, err := os.Stat(path); err == nil {
+			files[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	for _, dir := range w.dirs {
+		dirFiles, err := scanWatchedFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(files, dirFiles)
+	}
+	return files, nil
+}
+
+// next blocks until watched files changed and then stayed unchanged for
+// watchDebounce, and returns every file changed since the last call
+func (w *fileWatcher) next(ctx context.Context) ([]string, error) {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	pending := map[string]bool{}
+	var lastChange time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		files, err := w.scan()
+		if err != nil {
+			return nil, err
+		}
+		changed := diffWatchedFiles(w.files, files)
+		w.files = files
+		for _, path := range changed {
+			pending[path] = true
+		}
+		if len(changed) > 0 {
+			lastChange = time.Now()
+		}
+
+		if len(pending) > 0 && time.Since(lastChange) >= watchDebounce {
+			return slices.Sorted(maps.Keys(pending)), nil
+		}
+	}
+}
+
+// needsRelist reports whether changed files can change the import graph
+// listed in pkgs: module files, non-test Go files and test files of
+// directories that held no package yet. Other test files and testdata only
+// change what their own package tests.
+func needsRelist(pkgs []listedPackage, changed []string) bool {
+	dirs := map[string]bool{}
+	for _, p := range pkgs {
+		if !p.DepOnly && p.Dir != "" {
+			dirs[p.Dir] = true
+		}
+	}
+	for _, file := range changed {
+		base := filepath.Base(file)
+		switch {
+		case moduleFiles[base]:
+			return true
+		case filepath.Ext(base) != ".go":
+		case !strings.HasSuffix(base, "_test.go"), !dirs[filepath.Dir(file)]:
+			return true
+		}
+	}
+	return false
+}
+
+// watchStatus is the latest outcome of a package while watching
+type watchStatus struct {
+	Result string
+	At     time.Time
+}
+
+// watchDashboard keeps the latest outcome of every package tested while
+// watching, so each run can show the state of all of them
+type watchDashboard struct {
+	out    io.Writer
+	runs   int
+	status map[string]watchStatus
+}
+
+func newWatchDashboard(out io.Writer) *watchDashboard {
+	return &watchDashboard{out: out, status: map[string]watchStatus{}}
+}
+
+// update records the packages of a finished run
+func (d *watchDashboard) update(results *testResults, at time.Time) {
+	d.runs++
+	for _, p := range results.Packages() {
+		result := p.Result
+		switch {
+		case p.BuildFailed:
+			result = resultFail
+		case p.NoTestFiles:
+			result = resultSkip
+		}
+		// a test binary that failed to build is reported as pkg.test
+		d.status[strings.TrimSuffix(p.Name, ".test")] = watchStatus{Result: result, At: at}
+	}
+}
+
+// print shows pass/fail counts of every package seen so far and lists the
+// failing ones with the time they last ran
+func (d *watchDashboard) print() {
+	var passed, skipped int
+	var failing []string
+	for name, st := range d.status {
+		switch st.Result {
+		case resultFail:
+			failing = append(failing, name)
+		case resultSkip:
+			skipped++
+		default:
+			passed++
+		}
+	}
+	slices.Sort(failing)
+
+	fmt.Fprintln(d.out)
+	fmt.Fprintf(d.out, "==== Watch run %d ====\n", d.runs)
+	line := fmt.Sprintf("✅ %d passing  ❌ %d failing", passed, len(failing))
+	if skipped > 0 {
+		line += fmt.Sprintf("  ➖ %d without tests", skipped)
+	}
+	fmt.Fprintln(d.out, line)
+	for _, name := range failing {
+		fmt.Fprintf(d.out, "   ❌ %s (%s)\n", name, d.status[name].At.Format(time.TimeOnly))
+	}
+	fmt.Fprintln(d.out)
+}
+
+// watchTests runs the given packages (if any), then reruns the packages
+// affected by every change to the workspace until interrupted. Packages
+// given on the command line limit what is rerun; without them every
+// workspace package is watched. Output is truncated per run, so a long run
+// never holds back the dashboards of later ones.
+func (cfg *GoShimConfig) watchTests(ctx context.Context, ta *testArgs, run func(goArgs []string) (*testResults, error)) error {
+	ctx, stop := signal.NotifyContext(ctx, forwardedSignals...)
+	defer stop()
+
+	// scan before the first run, so edits made while it runs are picked up
+	dirs, err := cfg.workspaceModuleDirs()
+	if err != nil {
+		return err
+	}
+	watcher, err := newFileWatcher(cfg.WorkspaceRoot, dirs)
+	if err != nil {
+		return err
+	}
+
+	var scope map[string]bool
+	var pkgs []listedPackage
+	dashboard := newWatchDashboard(stdout)
+	if len(ta.Packages) > 0 {
+		paths, err := cfg.listImportPaths(ctx, ta.value("-C"), ta.Packages)
+		if err != nil {
+			return err
+		}
+		scope = map[string]bool{}
+		for _, path := range paths {
+			scope[path] = true
+		}
+		results, err := run(ta.goArgs())
+		cfg.flushOutputTruncation()
+		if err != nil {
+			slogctx.Debug(ctx, "Watch run failed", slogctx.Err(err))
+		}
+		dashboard.update(results, time.Now())
+		dashboard.print()
+	}
+
+	for {
+		fmt.Fprintf(stdout, "👀 Watching %d %s in %s for changes (Ctrl+C to stop)\n",
+			len(watcher.files), pluralize(len(watcher.files), "file", "files"), cfg.WorkspaceRoot)
+
+		changed, err := watcher.next(ctx)
+		if ctx.Err() != nil {
+			fmt.Fprintln(stdout, "👋 Stopped watching")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		slogctx.Debug(ctx, "Watched files changed", slog.Any("files", changed))
+
+		// go.work may use other modules now, so watch those instead
+		if slices.ContainsFunc(changed, func(f string) bool { return filepath.Base(f) == "go.work" }) {
+			if dirs, err := cfg.workspaceModuleDirs(); err != nil {
+				fmt.Fprintf(stderr, "❌ %v\n", err)
+			} else if err := watcher.setDirs(dirs); err != nil {
+				return err
+			}
+		}
+
+		// the import graph is only listed again when the change can affect it
+		if pkgs == nil || needsRelist(pkgs, changed) {
+			if pkgs, err = cfg.listWorkspacePackages(ctx); err != nil {
+				fmt.Fprintf(stderr, "❌ %v\n", err)
+				continue
+			}
+			slogctx.Debug(ctx, "Listed workspace packages", slog.Int("packages", len(pkgs)))
+		}
+		selected, fallback := selectAffectedPackages(pkgs, changed)
+		if scope != nil {
+			selected = slices.DeleteFunc(selected, func(p affectedPackage) bool { return !scope[p.ImportPath] })
+		}
+		printAffectedPackages(stdout, "the last run", selected, fallback, cfg.WorkspaceRoot)
+		if len(selected) == 0 {
+			continue
+		}
+
+		runArgs := ta.clone()
+		runArgs.Packages = nil
+		for _, p := range selected {
+			runArgs.Packages = append(runArgs.Packages, p.ImportPath)
+		}
+		results, err := run(runArgs.goArgs())
+		cfg.flushOutputTruncation()
+		if ctx.Err() != nil {
+			fmt.Fprintln(stdout, "👋 Stopped watching")
+			return nil
+		}
+		if err != nil {
+			slogctx.Debug(ctx, "Watch run failed", slogctx.Err(err))
+		}
+		dashboard.update(results, time.Now())
+		dashboard.print()
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchedFile(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{rel: "pkg/a.go", want: true},
+		{rel: "pkg/a_test.go", want: true},
+		{rel: "go.mod", want: true},
+		{rel: "tools/go.sum", want: true},
+		{rel: "go.work", want: true},
+		{rel: "pkg/testdata/golden.txt", want: true},
+		{rel: "pkg/testdata/nested/input.json", want: true},
+		{rel: "README.md", want: false},
+		{rel: "pkg/notes.txt", want: false},
+		{rel: "testdata.txt", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			assert.Equal(t, tt.want, watchedFile(filepath.FromSlash(tt.rel)))
+		})
+	}
+}
+
+func TestScanWatchedFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":               "module example.com/w\n",
+		"a/a.go":               "package a\n",
+		"a/testdata/in.txt":    "input\n",
+		"a/README.md":          "docs\n",
+		"vendor/x/x.go":        "package x\n",
+		".git/hooks/h.go":      "package h\n",
+		"node_modules/x/x.go":  "package x\n",
+		"_scratch/scratch.go":  "package scratch\n",
+		"b/nested/deep/b.go":   "package deep\n",
+		"b/nested/deep/b.json": "{}\n",
+	})
+
+	files, err := scanWatchedFiles(root)
+	require.NoError(t, err)
+	var rels []string
+	for path := range files {
+		rel, err := filepath.Rel(root, path)
+		require.NoError(t, err)
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	assert.ElementsMatch(t, []string{"go.mod", "a/a.go", "a/testdata/in.txt", "b/nested/deep/b.go"}, rels)
+}
+
+func TestFileWatcherScan(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.work":          "go 1.24\n\nuse ./a\n",
+		"a/go.mod":         "module example.com/a\n",
+		"a/a.go":           "package a\n",
+		"a/tools/go.mod":   "module example.com/a/tools\n",
+		"a/tools/tools.go": "package tools\n",
+		"other/other.go":   "package other\n",
+	})
+
+	// only the module directories are walked, nested ones as part of their parent
+	w, err := newFileWatcher(root, []string{filepath.Join(root, "a", "tools"), filepath.Join(root, "a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "a")}, w.dirs)
+	var rels []string
+	for path := range w.files {
+		rel, err := filepath.Rel(root, path)
+		require.NoError(t, err)
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	assert.ElementsMatch(t, []string{"go.work", "a/go.mod", "a/a.go", "a/tools/go.mod", "a/tools/tools.go"}, rels)
+}
+
+func TestNeedsRelist(t *testing.T) {
+	pkgs := []listedPackage{
+		{ImportPath: "example.com/w/a", Dir: "/w/a"},
+		{ImportPath: "example.com/dep", Dir: "/mod/dep", DepOnly: true},
+	}
+	tests := []struct {
+		name    string
+		changed []string
+		want    bool
+	}{
+		{name: "test file", changed: []string{"/w/a/a_test.go"}, want: false},
+		{name: "testdata", changed: []string{"/w/a/testdata/in.txt"}, want: false},
+		{name: "source file", changed: []string{"/w/a/a_test.go", "/w/a/a.go"}, want: true},
+		{name: "module file", changed: []string{"/w/go.sum"}, want: true},
+		{name: "test file of a new package", changed: []string{"/w/b/b_test.go"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, needsRelist(pkgs, tt.changed))
+		})
+	}
+}
+
+func TestDiffWatchedFiles(t *testing.T) {
+	now := time.Now()
+	before := map[string]fileStamp{
+		"/w/same.go":    {modTime: now, size: 1},
+		"/w/touched.go": {modTime: now, size: 1},
+		"/w/resized.go": {modTime: now, size: 1},
+		"/w/removed.go": {modTime: now, size: 1},
+	}
+	after := map[string]fileStamp{
+		"/w/same.go":    {modTime: now, size: 1},
+		"/w/touched.go": {modTime: now.Add(time.Second), size: 1},
+		"/w/resized.go": {modTime: now, size: 2},
+		"/w/added.go":   {modTime: now, size: 1},
+	}
+	assert.Equal(t, []string{"/w/added.go", "/w/removed.go", "/w/resized.go", "/w/touched.go"}, diffWatchedFiles(before, after))
+	assert.Empty(t, diffWatchedFiles(after, after))
+}
+
+func TestFileWatcherNext(t *testing.T) {
+	oldInterval, oldDebounce := watchPollInterval, watchDebounce
+	watchPollInterval, watchDebounce = 10*time.Millisecond, 50*time.Millisecond
+	defer func() { watchPollInterval, watchDebounce = oldInterval, oldDebounce }()
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a/a.go": "package a\n"})
+	w, err := newFileWatcher(root, []string{root})
+	require.NoError(t, err)
+
+	// several writes in a row are debounced into one batch
+	go func() {
+		for _, name := range []string{"a/a.go", "a/b.go", "a/c.go"} {
+			os.WriteFile(filepath.Join(root, name), []byte("package a\n\n// edited\n"), 0o644)
+			time.Sleep(15 * time.Millisecond)
+		}
+	}()
+
+	changed, err := w.next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "a/a.go"), filepath.Join(root, "a/b.go"), filepath.Join(root, "a/c.go")}, changed)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err = w.next(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWatchDashboard(t *testing.T) {
+	var buf bytes.Buffer
+	d := newWatchDashboard(&buf)
+	first := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	results := newTestResults()
+	results.pkg("example.com/w/a").Result = resultPass
+	results.pkg("example.com/w/b").Result = resultFail
+	results.pkg("example.com/w/c").NoTestFiles = true
+	d.update(results, first)
+
+	// a later run fixes b and breaks the build of a
+	results = newTestResults()
+	results.pkg("example.com/w/b").Result = resultPass
+	results.pkg("example.com/w/a.test").BuildFailed = true
+	d.update(results, first.Add(time.Minute))
+	d.print()
+
+	assert.Equal(t, strings.Join([]string{
+		"",
+		"==== Watch run 2 ====",
+		"✅ 1 passing  ❌ 1 failing  ➖ 1 without tests",
+		"   ❌ example.com/w/a (10:01:00)",
+		"",
+		"",
+	}, "\n"), buf.String())
+}
+
+func TestGoShimConfig_watchTests(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOTOOLCHAIN", "local")
+	oldInterval, oldDebounce := watchPollInterval, watchDebounce
+	watchPollInterval, watchDebounce = 10*time.Millisecond, 20*time.Millisecond
+	defer func() { watchPollInterval, watchDebounce = oldInterval, oldDebounce }()
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":      "module example.com/w\n\ngo 1.24\n",
+		"a/a.go":      "package a\n\nfunc A() int { return 1 }\n",
+		"b/b.go":      "package b\n\nimport \"example.com/w/a\"\n\nfunc B() int { return a.A() }\n",
+		"c/c.go":      "package c\n",
+		"b/b_test.go": "package b\n",
+	})
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	require.NoError(t, os.Chdir(root))
+
+	var buf bytes.Buffer
+	oldStdout := stdout
+	stdout = &buf
+	defer func() { stdout = oldStdout }()
+
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+	ta, err := parseTestArgs([]string{"-v", "./a", "./b"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	var runs [][]string
+	run := func(goArgs []string) (*testResults, error) {
+		runs = append(runs, goArgs)
+		if len(runs) == 1 {
+			// c is outside the watched packages, so only a and b rerun
+			writeFiles(t, root, map[string]string{
+				"a/a.go": "package a\n\nfunc A() int { return 2 }\n",
+				"c/c.go": "package c\n\n// edited\n",
+			})
+		} else {
+			cancel()
+		}
+		return newTestResults(), nil
+	}
+
+	require.NoError(t, cfg.watchTests(ctx, ta, run))
+	assert.Equal(t, [][]string{
+		{"test", "-v", "./a", "./b"},
+		{"test", "-v", "example.com/w/a", "example.com/w/b"},
+	}, runs)
+	assert.Contains(t, buf.String(), "example.com/w/b  imports example.com/w/a")
+	assert.Contains(t, buf.String(), "👋 Stopped watching")
+}
+
+func TestGoShimConfig_watchTests_truncation(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOTOOLCHAIN", "local")
+	oldInterval, oldDebounce := watchPollInterval, watchDebounce
+	watchPollInterval, watchDebounce = 10*time.Millisecond, 20*time.Millisecond
+	defer func() { watchPollInterval, watchDebounce = oldInterval, oldDebounce }()
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod": "module example.com/w\n\ngo 1.24\n",
+		"a/a.go": "package a\n",
+	})
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	require.NoError(t, os.Chdir(root))
+
+	var buf bytes.Buffer
+	oldStdout, oldStderr := stdout, stderr
+	stdout, stderr = &buf, io.Discard
+	defer func() { stdout, stderr = oldStdout, oldStderr }()
+
+	cfg := &GoShimConfig{WorkspaceRoot: root, MaxLines: 10}
+	cfg.setupOutputTruncation()
+	ta, err := parseTestArgs([]string{"./a"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	runs := 0
+	run := func(goArgs []string) (*testResults, error) {
+		runs++
+		for i := 0; i < 50; i++ {
+			fmt.Fprintf(stdout, "run %d line %d\n", runs, i)
+		}
+		if runs == 1 {
+			writeFiles(t, root, map[string]string{"a/a.go": "package a\n\n// edited\n"})
+		} else {
+			cancel()
+		}
+		return newTestResults(), nil
+	}
+
+	require.NoError(t, cfg.watchTests(ctx, ta, run))
+
+	// nothing may be held back until exit: every run ends its window
+	out := buf.String()
+	dashboard := strings.Index(out, "==== Watch run 1 ====")
+	require.GreaterOrEqual(t, dashboard, 0, "the dashboard should be written after more than -max-lines lines")
+	assert.Less(t, strings.Index(out, "run 1 line 49\n"), dashboard, "the tail of the run comes before its dashboard")
+	assert.Contains(t, out, "👀 Watching")
+	assert.Contains(t, out, "run 2 line 49\n")
+	assert.Contains(t, out, "👋 Stopped watching")
+	assert.Equal(t, 2, strings.Count(out, "lines elided from stdout"), "each run is truncated on its own")
+}
+
+func TestGoShimConfig_handleTestWatchConflicts(t *testing.T) {
+	cfg := &GoShimConfig{WorkspaceRoot: t.TempDir()}
+	for _, args := range [][]string{
+		{"test", "-watch", "-workspace"},
+		{"test", "-watch", "-changed"},
+		{"test", "-watch", "-ide"},
+		{"test", "-watch", "-json", "./..."},
+		{"test", "-watch", "-c", "."},
+	} {
+		err := cfg.handleTest(t.Context(), args)
+		assert.ErrorContains(t, err, "-watch cannot be combined", "%v", args)
+	}
+}
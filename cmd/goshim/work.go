@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// handleWork processes the work commands goshim implements itself
+func (cfg *GoShimConfig) handleWork(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("work subcommand required")
+	}
+
+	switch args[1] {
+	case "discover":
+		return cfg.runWorkDiscover(ctx, args[2:])
+	case "link":
+		return cfg.runWorkLink(ctx, args[2:])
+	case "unlink":
+		return cfg.runWorkUnlink(ctx, args[2:])
+	default:
+		return fmt.Errorf("unknown work subcommand: %s", args[1])
+	}
+}
+
+// runGoIn runs the go command in dir with goshim's stdio
+func (cfg *GoShimConfig) runGoIn(ctx context.Context, dir string, args ...string) error {
+	goPath, err := cfg.findSafeGo()
+	if err != nil {
+		return err
+	}
+
+	slogctx.Debug(ctx, "Executing go command", slog.String("go", goPath), slog.Any("args", args), slog.String("dir", dir))
+
+	cmd := exec.CommandContext(ctx, goPath, args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return runCommand(cmd)
+}
+
+// discoverModules returns the directories beneath root holding a go.mod. It
+// skips what ./... skips (directories starting with . or _, testdata and
+// vendor) and, inside a git repository, whatever git ignores.
+func discoverModules(ctx context.Context, root string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" {
+				return filepath.SkipDir
+			}
+		}
+		if !d.IsDir() && d.Name() == "go.mod" {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	ignored, err := gitIgnored(ctx, root, dirs)
+	if err != nil {
+		return nil, err
+	}
+	kept := dirs[:0]
+	for _, dir := range dirs {
+		if !ignored[dir] {
+			kept = append(kept, dir)
+		}
+	}
+	return kept, nil
+}
+
+// gitIgnored returns which of the paths beneath root git ignores. Outside a
+// git repository nothing is ignored.
+func gitIgnored(ctx context.Context, root string, paths []string) (map[string]bool, error) {
+	ignored := map[string]bool{}
+	if len(paths) == 0 {
+		return ignored, nil
+	}
+
+	var in bytes.Buffer
+	byRel := map[string]string{}
+	for _, path := range paths {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		byRel[rel] = path
+		fmt.Fprintln(&in, rel)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "check-ignore", "--stdin")
+	cmd.Dir = root
+	cmd.Stdin = &in
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		// 1 means no path is ignored, 128 that root is not in a repository
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && (exitErr.ExitCode() == 1 || exitErr.ExitCode() == 128) {
+			return ignored, nil
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return ignored, nil
+		}
+		return nil, fmt.Errorf("git check-ignore failed: %w", err)
+	}
+
+	for _, line := range strings.Split(out.String(), "\n") {
+		if path, ok := byRel[strings.TrimSpace(line)]; ok {
+			ignored[path] = true
+		}
+	}
+	return ignored, nil
+}
+
+// runWorkDiscover adds every module beneath the workspace root that go.work
+// does not use yet, creating go.work when there is none
+func (cfg *GoShimConfig) runWorkDiscover(ctx context.Context, args []string) error {
+	dryRun := false
+	for _, arg := range args {
+		switch arg {
+		case "-dry-run":
+			dryRun = true
+		default:
+			return fmt.Errorf("unknown work discover flag: %s", arg)
+		}
+	}
+	if os.Getenv("GOWORK") == "off" {
+		return fmt.Errorf("workspaces are disabled by GOWORK=off")
+	}
+
+	discovered, err := discoverModules(ctx, cfg.WorkspaceRoot)
+	if err != nil {
+		return err
+	}
+
+	used := map[string]bool{}
+	hasWorkFile := false
+	if ws, err := cfg.loadWorkspace(); err == nil && ws.WorkFile != "" {
+		hasWorkFile = true
+		for _, dir := range ws.Dirs() {
+			used[dir] = true
+		}
+	}
+
+	var missing []string
+	for _, dir := range discovered {
+		if !used[dir] {
+			missing = append(missing, dir)
+		}
+	}
+
+	fmt.Fprintf(stdout, "📦 Found %d %s, %d not in go.work\n",
+		len(discovered), pluralize(len(discovered), "module", "modules"), len(missing))
+	var rels []string
+	for _, dir := range missing {
+		rel := localModulePath(cfg.WorkspaceRoot, dir)
+		fmt.Fprintf(stdout, "  + %s\n", rel)
+		rels = append(rels, rel)
+	}
+	if len(missing) == 0 || dryRun {
+		return nil
+	}
+
+	goArgs := append([]string{"work", "use"}, rels...)
+	if !hasWorkFile {
+		goArgs = append([]string{"work", "init"}, rels...)
+	}
+	if err := cfg.runGoIn(ctx, cfg.WorkspaceRoot, goArgs...); err != nil {
+		return fmt.Errorf("failed to update go.work: %w", err)
+	}
+	fmt.Fprintf(stdout, "📦 Added %d %s to go.work\n", len(missing), pluralize(len(missing), "module", "modules"))
+	return nil
+}
+
+// localModulePath returns dir relative to base as go.work use and replace
+// directives expect it: a local directory must start with ./ or ../
+func localModulePath(base, dir string) string {
+	rel, err := filepath.Rel(base, dir)
+	if err != nil {
+		return dir
+	}
+	rel = filepath.ToSlash(rel)
+	if rel != "." && rel != ".." && !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+// linkEditArgs returns the go command that edits the workspace's replaces:
+// go work edit with a go.work, otherwise go mod edit on the root module
+func linkEditArgs(ws *workspace) (string, []string) {
+	if ws.WorkFile != "" {
+		return "go.work", []string{"work", "edit"}
+	}
+	return "go.mod", []string{"mod", "edit"}
+}
+
+// runWorkLink replaces a module with a local checkout
+func (cfg *GoShimConfig) runWorkLink(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: goshim work link <module-path> <dir>")
+	}
+	modulePath := args[0]
+
+	dir, err := filepath.Abs(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", args[1], err)
+	}
+	m, err := readWorkspaceModule(dir)
+	if err != nil {
+		return err
+	}
+	if m.Path != modulePath {
+		return fmt.Errorf("%s is module %s, not %s", args[1], m.Path, modulePath)
+	}
+
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return err
+	}
+	for _, used := range ws.Modules {
+		if used.Path == modulePath {
+			return fmt.Errorf("%s is already a workspace module", modulePath)
+		}
+	}
+
+	base := ws.Root
+	if ws.WorkFile != "" {
+		base = filepath.Dir(ws.WorkFile)
+	}
+	target := localModulePath(base, dir)
+
+	file, editArgs := linkEditArgs(ws)
+	if err := cfg.runGoIn(ctx, base, append(editArgs, "-replace="+modulePath+"="+target)...); err != nil {
+		return fmt.Errorf("failed to link %s: %w", modulePath, err)
+	}
+	fmt.Fprintf(stdout, "🔗 Linked %s => %s in %s\n", modulePath, target, file)
+	return nil
+}
+
+// runWorkUnlink drops the replace of a module added by work link
+func (cfg *GoShimConfig) runWorkUnlink(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: goshim work unlink <module-path>")
+	}
+	modulePath := args[0]
+
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return err
+	}
+
+	replaces := ws.Replaces
+	base := ws.Root
+	if ws.WorkFile != "" {
+		base = filepath.Dir(ws.WorkFile)
+	} else {
+		replaces = ws.Modules[0].Replaces
+	}
+
+	// a replace of a specific version is dropped by path@version
+	file, editArgs := linkEditArgs(ws)
+	var drops []string
+	for _, r := range replaces {
+		if r.Old.Path != modulePath {
+			continue
+		}
+		old := r.Old.Path
+		if r.Old.Version != "" {
+			old += "@" + r.Old.Version
+		}
+		drops = append(drops, "-dropreplace="+old)
+	}
+	if len(drops) == 0 {
+		return fmt.Errorf("%s has no replace for %s", file, modulePath)
+	}
+
+	if err := cfg.runGoIn(ctx, base, append(editArgs, drops...)...); err != nil {
+		return fmt.Errorf("failed to unlink %s: %w", modulePath, err)
+	}
+	fmt.Fprintf(stdout, "🔗 Unlinked %s in %s\n", modulePath, file)
+	return nil
+}
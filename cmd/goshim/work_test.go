@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalModulePath(t *testing.T) {
+	assert.Equal(t, ".", localModulePath("/ws", "/ws"))
+	assert.Equal(t, "./tools", localModulePath("/ws", "/ws/tools"))
+	assert.Equal(t, "../lib", localModulePath("/ws", "/lib"))
+}
+
+func TestDiscoverModules(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":                  "module example.com/root\n",
+		"tools/go.mod":            "module example.com/root/tools\n",
+		"nested/deep/go.mod":      "module example.com/root/nested/deep\n",
+		"testdata/fixture/go.mod": "module example.com/fixture\n",
+		"_scratch/go.mod":         "module example.com/scratch\n",
+		".cache/go.mod":           "module example.com/cache\n",
+		"build/generated/go.mod":  "module example.com/generated\n",
+		".gitignore":              "build/\n",
+	})
+	require.NoError(t, exec.Command("git", "-C", root, "init", "-q").Run())
+
+	dirs, err := discoverModules(context.Background(), root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{root, filepath.Join(root, "nested", "deep"), filepath.Join(root, "tools")}, dirs)
+}
+
+func TestGoShimConfig_workCommands(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "")
+	t.Setenv("GOTOOLCHAIN", "local")
+
+	parent := t.TempDir()
+	root := filepath.Join(parent, "ws")
+	writeFiles(t, parent, map[string]string{
+		"ws/go.mod":       "module example.com/ws\n\ngo 1.24\n",
+		"ws/tools/go.mod": "module example.com/ws/tools\n\ngo 1.24\n",
+		"lib/go.mod":      "module example.com/lib\n\ngo 1.24\n",
+	})
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+
+	require.NoError(t, cfg.runWorkDiscover(t.Context(), []string{"-dry-run"}))
+	assert.NoFileExists(t, filepath.Join(root, "go.work"), "-dry-run must not create go.work")
+
+	require.NoError(t, cfg.runWorkDiscover(t.Context(), nil))
+	ws, err := cfg.loadWorkspace()
+	require.NoError(t, err)
+	assert.Equal(t, []string{root, filepath.Join(root, "tools")}, ws.Dirs())
+
+	err = cfg.runWorkLink(t.Context(), []string{"example.com/other", filepath.Join(parent, "lib")})
+	assert.ErrorContains(t, err, "is module example.com/lib")
+
+	require.NoError(t, cfg.runWorkLink(t.Context(), []string{"example.com/lib", filepath.Join(parent, "lib")}))
+	data, err := os.ReadFile(filepath.Join(root, "go.work"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "replace example.com/lib => ../lib")
+
+	require.NoError(t, cfg.runWorkUnlink(t.Context(), []string{"example.com/lib"}))
+	data, err = os.ReadFile(filepath.Join(root, "go.work"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "example.com/lib")
+
+	assert.ErrorContains(t, cfg.runWorkUnlink(t.Context(), []string{"example.com/lib"}), "no replace for example.com/lib")
+}
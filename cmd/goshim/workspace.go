@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+)
+
+// workspaceModule is one module of the workspace, read from its go.mod
+type workspaceModule struct {
+	Dir       string // absolute
+	Path      string
+	GoVersion string
+	Toolchain string
+	Requires  []*modfile.Require
+	Replaces  []*modfile.Replace
+	Tools     []string // tool directive package paths
+}
+
+// workspace is the set of modules goshim operates on: those used by a go.work
+// file, or a single module when workspaces are not in use
+type workspace struct {
+	Root      string
+	WorkFile  string // absolute path of the go.work file, empty without one
+	GoVersion string
+	Toolchain string
+	Godebug   []*modfile.Godebug
+	Replaces  []*modfile.Replace // go.work replaces, which override module ones
+	Modules   []workspaceModule
+}
+
+// Dirs returns the directories of the workspace's modules
+func (ws *workspace) Dirs() []string {
+	dirs := make([]string, 0, len(ws.Modules))
+	for _, m := range ws.Modules {
+		dirs = append(dirs, m.Dir)
+	}
+	return dirs
+}
+
+// workspaceRootFrom returns the workspace root for dir the way the go command
+// finds the workspace: GOWORK names the go.work file or disables workspaces
+// with "off", otherwise the nearest go.work above dir is used. Without a
+// workspace the nearest go.mod is the root, and dir itself without either.
+func workspaceRootFrom(dir, gowork string) string {
+	switch gowork {
+	case "off":
+	case "":
+		if root, ok := findUp(dir, "go.work"); ok {
+			return root
+		}
+	default:
+		if abs, err := filepath.Abs(gowork); err == nil {
+			return filepath.Dir(abs)
+		}
+	}
+
+	if root, ok := findUp(dir, "go.mod"); ok {
+		return root
+	}
+	return dir
+}
+
+// findUp returns the nearest directory at or above dir containing name
+func findUp(dir, name string) (string, bool) {
+	for {
+		if fileExists(filepath.Join(dir, name)) {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// workFilePath returns the go.work file used for root, honouring GOWORK, or
+// "" when workspaces are off or root has no go.work
+func workFilePath(root, gowork string) string {
+	switch gowork {
+	case "off":
+		return ""
+	case "":
+		if path := filepath.Join(root, "go.work"); fileExists(path) {
+			return path
+		}
+		return ""
+	default:
+		if abs, err := filepath.Abs(gowork); err == nil {
+			return abs
+		}
+		return gowork
+	}
+}
+
+// loadWorkspace reads the go.work (or go.mod) of root and the go.mod of every
+// module it uses. gowork is the value of the GOWORK environment variable.
+func loadWorkspace(root, gowork string) (*workspace, error) {
+	ws := &workspace{Root: root, WorkFile: workFilePath(root, gowork)}
+
+	if ws.WorkFile == "" {
+		if !fileExists(filepath.Join(root, "go.mod")) {
+			return nil, fmt.Errorf("no go.work or go.mod found in %s", root)
+		}
+		m, err := readWorkspaceModule(root)
+		if err != nil {
+			return nil, err
+		}
+		ws.GoVersion, ws.Toolchain = m.GoVersion, m.Toolchain
+		ws.Modules = []workspaceModule{m}
+		return ws, nil
+	}
+
+	data, err := os.ReadFile(ws.WorkFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read go.work: %w", err)
+	}
+	wf, err := modfile.ParseWork(ws.WorkFile, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go.work: %w", err)
+	}
+
+	if wf.Go != nil {
+		ws.GoVersion = wf.Go.Version
+	}
+	if wf.Toolchain != nil {
+		ws.Toolchain = wf.Toolchain.Name
+	}
+	ws.Godebug = wf.Godebug
+	ws.Replaces = wf.Replace
+
+	// use paths are relative to the go.work file, not the root
+	workDir := filepath.Dir(ws.WorkFile)
+	for _, use := range wf.Use {
+		dir := filepath.FromSlash(use.Path)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(workDir, dir)
+		}
+		m, err := readWorkspaceModule(filepath.Clean(dir))
+		if err != nil {
+			return nil, err
+		}
+		ws.Modules = append(ws.Modules, m)
+	}
+	if len(ws.Modules) == 0 {
+		return nil, fmt.Errorf("go.work in %s does not use any modules", workDir)
+	}
+	return ws, nil
+}
+
+// readWorkspaceModule reads the go.mod in dir
+func readWorkspaceModule(dir string) (workspaceModule, error) {
+	path := filepath.Join(dir, "go.mod")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return workspaceModule{}, fmt.Errorf("failed to read go.mod: %w", err)
+	}
+	mf, err := modfile.Parse(path, data, nil)
+	if err != nil {
+		return workspaceModule{}, fmt.Errorf("failed to parse go.mod: %w", err)
+	}
+
+	m := workspaceModule{Dir: dir, Requires: mf.Require, Replaces: mf.Replace}
+	if mf.Module != nil {
+		m.Path = mf.Module.Mod.Path
+	}
+	if mf.Go != nil {
+		m.GoVersion = mf.Go.Version
+	}
+	if mf.Toolchain != nil {
+		m.Toolchain = mf.Toolchain.Name
+	}
+	for _, tool := range mf.Tool {
+		m.Tools = append(m.Tools, tool.Path)
+	}
+	return m, nil
+}
+
+// loadWorkspace loads the workspace at the configured root
+func (cfg *GoShimConfig) loadWorkspace() (*workspace, error) {
+	return loadWorkspace(cfg.WorkspaceRoot, os.Getenv("GOWORK"))
+}
+
+// workspaceModuleDirs returns the absolute directories of the modules used by
+// the workspace's go.work, or just the workspace root when there is no go.work
+func (cfg *GoShimConfig) workspaceModuleDirs() ([]string, error) {
+	ws, err := cfg.loadWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	return ws.Dirs(), nil
+}
+
+// parseWorkspaceModules extracts the use paths from go.work content
+func parseWorkspaceModules(content string) []string {
+	modules := make([]string, 0)
+	wf, err := modfile.ParseWork("go.work", []byte(content), nil)
+	if err != nil {
+		return modules
+	}
+	for _, use := range wf.Use {
+		modules = append(modules, use.Path)
+	}
+	return modules
+}
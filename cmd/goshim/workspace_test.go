@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles writes name -> content pairs under root
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestGoShimConfig_workspaceModuleDirs(t *testing.T) {
+	t.Setenv("GOWORK", "")
+	root := t.TempDir()
+	cfg := &GoShimConfig{WorkspaceRoot: root}
+
+	_, err := cfg.workspaceModuleDirs()
+	assert.Error(t, err, "a directory without go.work or go.mod is not a workspace")
+
+	writeFiles(t, root, map[string]string{"go.mod": "module example.com/root\n"})
+	dirs, err := cfg.workspaceModuleDirs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{root}, dirs, "a single module is its own workspace")
+
+	writeFiles(t, root, map[string]string{
+		"go.work":      "go 1.24\n\nuse (\n\t.\n\t./tools\n)\n",
+		"tools/go.mod": "module example.com/tools\n",
+	})
+	dirs, err = cfg.workspaceModuleDirs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{root, filepath.Join(root, "tools")}, dirs)
+
+	writeFiles(t, root, map[string]string{"go.work": "go 1.24\n\nuse ./missing\n"})
+	_, err = cfg.workspaceModuleDirs()
+	assert.Error(t, err, "a used module without go.mod is an error")
+}
+
+func TestLoadWorkspace(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.work": `go 1.24.3
+
+toolchain go1.24.4
+
+godebug default=go1.21
+
+use .
+use ./tools
+
+replace example.com/dep => ./dep
+`,
+		"go.mod":       "module example.com/root\n\ngo 1.24\n\nreplace example.com/old => example.com/new v1.2.0\n",
+		"tools/go.mod": "module example.com/root/tools\n\ngo 1.23\n\ntoolchain go1.23.5\n",
+	})
+
+	ws, err := loadWorkspace(root, "")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "go.work"), ws.WorkFile)
+	assert.Equal(t, "1.24.3", ws.GoVersion)
+	assert.Equal(t, "go1.24.4", ws.Toolchain)
+	require.Len(t, ws.Godebug, 1)
+	assert.Equal(t, "default", ws.Godebug[0].Key)
+	require.Len(t, ws.Replaces, 1)
+	assert.Equal(t, "example.com/dep", ws.Replaces[0].Old.Path)
+
+	require.Len(t, ws.Modules, 2)
+	assert.Equal(t, root, ws.Modules[0].Dir)
+	assert.Equal(t, "example.com/root", ws.Modules[0].Path)
+	assert.Equal(t, "1.24", ws.Modules[0].GoVersion)
+	require.Len(t, ws.Modules[0].Replaces, 1)
+	assert.Equal(t, "example.com/new", ws.Modules[0].Replaces[0].New.Path)
+	assert.Equal(t, "example.com/root/tools", ws.Modules[1].Path)
+	assert.Equal(t, "go1.23.5", ws.Modules[1].Toolchain)
+
+	t.Run("GOWORK=off", func(t *testing.T) {
+		ws, err := loadWorkspace(root, "off")
+		require.NoError(t, err)
+		assert.Empty(t, ws.WorkFile)
+		assert.Equal(t, []string{root}, ws.Dirs())
+		assert.Equal(t, "1.24", ws.GoVersion)
+	})
+
+	t.Run("GOWORK path", func(t *testing.T) {
+		other := t.TempDir()
+		writeFiles(t, other, map[string]string{"ci.work": "go 1.24\n\nuse " + filepath.ToSlash(filepath.Join(root, "tools")) + "\n"})
+
+		ws, err := loadWorkspace(root, filepath.Join(other, "ci.work"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(root, "tools")}, ws.Dirs())
+	})
+}
+
+func TestWorkspaceRootFrom(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.work":           "go 1.24\n\nuse ./a\n",
+		"a/go.mod":          "module example.com/a\n",
+		"a/pkg/sub/file.go": "package sub\n",
+		"other/ci.work":     "go 1.24\n",
+	})
+	loose := t.TempDir()
+	sub := filepath.Join(root, "a", "pkg", "sub")
+
+	tests := []struct {
+		name   string
+		dir    string
+		gowork string
+		want   string
+	}{
+		{name: "nearest go.work", dir: sub, want: root},
+		{name: "GOWORK off falls back to go.mod", dir: sub, gowork: "off", want: filepath.Join(root, "a")},
+		{name: "GOWORK names the work file", dir: sub, gowork: filepath.Join(root, "other", "ci.work"), want: filepath.Join(root, "other")},
+		{name: "no module", dir: loose, want: loose},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, workspaceRootFrom(tt.dir, tt.gowork))
+		})
+	}
+}